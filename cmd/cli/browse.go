@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// SearchAlbums searches albums and keeps them as the album list, for
+// OpenAlbum by number
+func (m *MusicPlayer) SearchAlbums(query string) ([]catalog.Album, error) {
+	res, err := m.catalog.Search(m.ctx, query, catalog.SearchOptions{Type: catalog.SearchAlbum})
+	if err != nil {
+		return nil, err
+	}
+	m.Albums = res.Albums
+	return m.Albums, nil
+}
+
+// SearchArtists searches artists and keeps them as the artist list, for
+// OpenArtist by number
+func (m *MusicPlayer) SearchArtists(query string) ([]catalog.Artist, error) {
+	res, err := m.catalog.Search(m.ctx, query, catalog.SearchOptions{Type: catalog.SearchArtist})
+	if err != nil {
+		return nil, err
+	}
+	m.Artists = res.Artists
+	return m.Artists, nil
+}
+
+// OpenAlbum replaces the results with an album's tracks, all volumes in
+// order. Nothing starts playing; the playing track carries on.
+func (m *MusicPlayer) OpenAlbum(id int) (*catalog.Album, error) {
+	album, err := m.catalog.AlbumWithTracks(m.ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var tracks []catalog.Track
+	for _, volume := range album.Volumes {
+		tracks = append(tracks, volume...)
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("album %q has no tracks", album.Title)
+	}
+	m.openResults(tracks)
+	return album, nil
+}
+
+// OpenArtist replaces the results with an artist's popular tracks and the
+// album list with the artist's discography, own releases first.
+func (m *MusicPlayer) OpenArtist(id int) (*catalog.ArtistPage, error) {
+	page, err := m.catalog.ArtistPage(m.ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.openResults(m.dislike.Filter(m.ctx, page.PopularTracks))
+	m.Albums = append(append([]catalog.Album{}, page.Albums...), page.AppearsOn...)
+	return page, nil
+}
+
+// openResults replaces the results without playing them. PlayNext then
+// starts at the first one.
+func (m *MusicPlayer) openResults(tracks []catalog.Track) {
+	m.stopRadio()
+	m.Results = tracks
+	m.idx = -1
+	m.query = ""
+	m.pager = catalog.Pager{}
+}
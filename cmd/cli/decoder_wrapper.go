@@ -1,28 +1,94 @@
 package main
 
-/*
-// This is a wrapper for mp3 decoder that signals a channel message on eof.
+// This is a wrapper for the mp3 decoder that keeps track of what the
+// player has read, so position, end of stream and stalls can be told.
 
 import (
+	"errors"
 	"io"
-
-	"github.com/hajimehoshi/go-mp3"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// DecoderWrapper wraps an io.Reader and signals a channel message on EOF.
+// DecoderWrapper sits between the mp3 decoder and the player. The player
+// reads from its own goroutine and doesn't hold its lock while doing so,
+// so Read and Seek are serialized here; the counters are atomic so they
+// can be checked without waiting on the network.
 type DecoderWrapper struct {
-	reader  io.Reader
-	decoder *mp3.Decoder
-	eofChan chan struct{}
+	mu      sync.Mutex
+	decoder io.ReadSeeker
+
+	offset       atomic.Int64 // Position in the decoded stream
+	eof          atomic.Bool  // The decoder returned io.EOF
+	readingSince atomic.Int64 // UnixNano start of the Read in progress, 0 if none
 }
 
 // NewDecoderWrapper creates a new DecoderWrapper.
-func NewDecoderWrapper(r io.Reader) *DecoderWrapper {
-	decoder := mp3.NewDecoder(r)
-	return &DecoderWrapper{
-		reader:  r,
-		decoder: decoder,
-		eofChan: make(chan struct{}),
+func NewDecoderWrapper(decoder io.ReadSeeker) *DecoderWrapper {
+	return &DecoderWrapper{decoder: decoder}
+}
+
+func (w *DecoderWrapper) Read(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.readingSince.Store(time.Now().UnixNano())
+	n, err := w.decoder.Read(p)
+	w.readingSince.Store(0)
+	w.offset.Add(int64(n))
+	if err == io.EOF {
+		w.eof.Store(true)
+	}
+	return n, err
+}
+
+// Seek lets the player seek the decoder.
+func (w *DecoderWrapper) Seek(offset int64, whence int) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pos, err := w.decoder.Seek(offset, whence)
+	if err == nil {
+		w.offset.Store(pos)
+		w.eof.Store(false)
+	}
+	return pos, err
+}
+
+// Swap replaces the decoder with one for the same stream, e.g. one that
+// can seek, and seeks it to the current offset. size is the new decoder's
+// length; once the reads are past it the old decoder is kept. Swap waits
+// for a Read in progress, so the old decoder is no longer in use when it
+// returns.
+func (w *DecoderWrapper) Swap(decoder io.ReadSeeker, size int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	off := w.offset.Load()
+	if off >= size {
+		return errors.New("already read to the end")
+	}
+	if _, err := decoder.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	w.decoder = decoder
+	return nil
+}
+
+// Offset returns how many decoded bytes into the stream the reads are.
+func (w *DecoderWrapper) Offset() int64 {
+	return w.offset.Load()
+}
+
+// EOF reports whether the whole stream has been read.
+func (w *DecoderWrapper) EOF() bool {
+	return w.eof.Load()
+}
+
+// Stalled returns how long the Read in progress has been waiting, or 0.
+// start identifies the Read.
+func (w *DecoderWrapper) Stalled() (start int64, d time.Duration) {
+	start = w.readingSince.Load()
+	if start == 0 {
+		return 0, 0
 	}
+	return start, time.Since(time.Unix(0, start))
 }
-*/
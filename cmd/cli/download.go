@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/id3"
+	"go_yandex_music/internal/naming"
+)
+
+const (
+	downloadWorkers  = 4                      // Tracks downloaded at once
+	downloadPageSize = 100                    // Artist tracks fetched per request
+	progressInterval = 500 * time.Millisecond // How often the progress line is redrawn
+)
+
+// DownloadResult is the outcome of downloading one track.
+type DownloadResult struct {
+	Track   catalog.Track
+	Path    string
+	Skipped bool // The file already existed
+	Err     error
+}
+
+// AlbumDownload returns an album's name and tracks for DownloadTracks
+func (m *MusicPlayer) AlbumDownload(id int) (string, []catalog.Track, error) {
+	album, err := m.catalog.AlbumWithTracks(m.ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	var tracks []catalog.Track
+	for _, volume := range album.Volumes {
+		tracks = append(tracks, volume...)
+	}
+	return catalog.ArtistNames(album.Artists) + " - " + album.Title, tracks, nil
+}
+
+// PlaylistDownload returns a playlist's name and tracks for DownloadTracks.
+// owner 0 is the account itself.
+func (m *MusicPlayer) PlaylistDownload(owner, kind int) (string, []catalog.Track, error) {
+	p, err := m.catalog.Playlist(m.ctx, owner, kind)
+	if err != nil {
+		return "", nil, err
+	}
+	return p.Title, p.Tracks, nil
+}
+
+// ArtistDownload returns an artist's name and all of their tracks for
+// DownloadTracks
+func (m *MusicPlayer) ArtistDownload(id int) (string, []catalog.Track, error) {
+	page, err := m.catalog.ArtistPage(m.ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	var tracks []catalog.Track
+	for n := 0; ; n++ {
+		tp, err := m.catalog.ArtistTracks(m.ctx, id, n, downloadPageSize)
+		if err != nil {
+			return "", nil, err
+		}
+		tracks = append(tracks, tp.Tracks...)
+		if !tp.Pager.HasMore() {
+			break
+		}
+	}
+	return page.Artist.Name, tracks, nil
+}
+
+// DownloadTracks downloads tracks into dir with a bounded pool of workers,
+// reporting to progress. Files that already exist are skipped. Download
+// URLs expire, so each one is requested right before its track is
+// fetched. The results are in the order of tracks.
+func (m *MusicPlayer) DownloadTracks(dir string, tracks []catalog.Track, progress *downloadProgress) []DownloadResult {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		results := make([]DownloadResult, len(tracks))
+		for i, t := range tracks {
+			results[i] = DownloadResult{Track: t, Err: err}
+		}
+		return results
+	}
+
+	paths := m.trackPaths(tracks)
+	results := make([]DownloadResult, len(tracks))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < downloadWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = m.downloadOne(filepath.Join(dir, paths[i]), i, tracks[i], progress)
+				progress.finish(i, results[i])
+			}
+		}()
+	}
+feed:
+	for i := range tracks {
+		select {
+		case jobs <- i:
+		case <-m.ctx.Done():
+			for ; i < len(tracks); i++ {
+				results[i] = DownloadResult{Track: tracks[i], Err: m.ctx.Err()}
+			}
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// downloadOne downloads track number i of a bulk download to path.
+func (m *MusicPlayer) downloadOne(path string, i int, track catalog.Track, progress *downloadProgress) DownloadResult {
+	res := DownloadResult{Track: track, Path: path}
+	if _, err := os.Stat(res.Path); err == nil {
+		res.Skipped = true
+		return res
+	}
+	if !track.Available {
+		res.Err = fmt.Errorf("not available")
+		return res
+	}
+	if err := os.MkdirAll(filepath.Dir(res.Path), 0o755); err != nil {
+		res.Err = err
+		return res
+	}
+	progress.start(i, track.FullTitle())
+	url, err := m.catalog.DownloadURL(m.ctx, track.ID)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Err = m.fetchFile(res.Path, url, m.trackTag(track), func(read, size int64) {
+		progress.update(i, read, size)
+	})
+	return res
+}
+
+// fetchFile downloads url into filename, with tag in front of the audio if
+// not nil. The data goes to a .part file that is renamed once complete, so
+// an interrupted download never looks finished. onProgress, if not nil,
+// is called as the body is read; size is -1 when unknown.
+func (m *MusicPlayer) fetchFile(filename, url string, tag *id3.Tag, onProgress func(read, size int64)) error {
+	req, err := http.NewRequestWithContext(m.ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("error: %s", resp.Status)
+	}
+	part := filename + ".part"
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	var body io.Reader = resp.Body
+	if onProgress != nil {
+		body = &progressReader{r: resp.Body, size: resp.ContentLength, report: onProgress}
+	}
+	_, err = id3.Copy(out, body, tag)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, filename)
+}
+
+// progressReader reports how much of a body has been read.
+type progressReader struct {
+	r      io.Reader
+	read   int64
+	size   int64
+	report func(read, size int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	p.report(p.read, p.size)
+	return n, err
+}
+
+// downloadProgress shows a bulk download on the terminal: a line per
+// finished track, and below them a status line with the overall count and
+// each running download, redrawn in place.
+type downloadProgress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	total   int
+	done    int
+	active  map[int]*fileProgress
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+type fileProgress struct {
+	name       string
+	read, size int64
+}
+
+// newDownloadProgress starts showing the progress of total downloads on
+// out. Call close when done.
+func newDownloadProgress(out io.Writer, total int) *downloadProgress {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &downloadProgress{out: out, total: total, active: make(map[int]*fileProgress), stop: cancel, stopped: make(chan struct{})}
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.draw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return p
+}
+
+func (p *downloadProgress) start(i int, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active[i] = &fileProgress{name: name, size: -1}
+}
+
+func (p *downloadProgress) update(i int, read, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if f, ok := p.active[i]; ok {
+		f.read, f.size = read, size
+	}
+}
+
+// finish prints the outcome of download i above the status line.
+func (p *downloadProgress) finish(i int, res DownloadResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, i)
+	p.done++
+	status := "done"
+	switch {
+	case res.Err != nil:
+		status = "FAILED: " + res.Err.Error()
+	case res.Skipped:
+		status = "exists, skipped"
+	}
+	fmt.Fprintf(p.out, "\r\x1b[K[%d/%d] %s - %s\n", p.done, p.total, res.Track.FullTitle(), status)
+	p.draw()
+}
+
+// draw redraws the status line. p.mu must be held.
+func (p *downloadProgress) draw() {
+	running := make([]int, 0, len(p.active))
+	for i := range p.active {
+		running = append(running, i)
+	}
+	sort.Ints(running)
+	line := fmt.Sprintf("%d of %d done", p.done, p.total)
+	for _, i := range running {
+		f := p.active[i]
+		if f.size > 0 {
+			line += fmt.Sprintf(" | %s %d%%", f.name, f.read*100/f.size)
+		} else {
+			line += fmt.Sprintf(" | %s %d KB", f.name, f.read>>10)
+		}
+	}
+	fmt.Fprint(p.out, "\r\x1b[K"+line)
+}
+
+// close stops redrawing and clears the status line.
+func (p *downloadProgress) close() {
+	p.stop()
+	<-p.stopped
+	fmt.Fprint(p.out, "\r\x1b[K")
+}
+
+// trackPath is the path, relative to a download folder, a track is
+// downloaded to.
+func (m *MusicPlayer) trackPath(track catalog.Track) string {
+	return m.trackName(track) + ".mp3"
+}
+
+func (m *MusicPlayer) trackName(track catalog.Track) string {
+	return filepath.FromSlash(m.names.Execute(naming.TrackFields(track)))
+}
+
+// trackPaths returns the paths for a bulk download of tracks. The same
+// title on two albums, or a template without {track}, can name two tracks
+// alike; later ones get " (2)", " (3)", ... so that no two workers write
+// the same file. Names differing only in case count as the same, as they
+// do on Windows and macOS.
+func (m *MusicPlayer) trackPaths(tracks []catalog.Track) []string {
+	paths := make([]string, len(tracks))
+	used := make(map[string]bool)
+	for i, t := range tracks {
+		name := m.trackName(t)
+		unique := name
+		for n := 2; used[strings.ToLower(unique)]; n++ {
+			unique = fmt.Sprintf("%s (%d)", name, n)
+		}
+		used[strings.ToLower(unique)] = true
+		paths[i] = unique + ".mp3"
+	}
+	return paths
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/naming"
+)
+
+// TestDownloadTracksSameName tests that tracks whose names collide are
+// downloaded to separate files
+func TestDownloadTracksSameName(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "audio of %s", r.URL.Path)
+	}))
+	defer cdn.Close()
+
+	m := newTestPlayer(0)
+	fake := m.catalog.(*catalog.Fake)
+	m.client = cdn.Client()
+	m.names, _ = naming.Parse("{title}")
+	var tracks []catalog.Track
+	for id, title := range []string{"Intro", "intro", "Outro", "Intro"} {
+		fake.DownloadURLs[id+1] = fmt.Sprintf("%s/%d.mp3", cdn.URL, id+1)
+		track := testTrack(id + 1)
+		track.Title = title
+		tracks = append(tracks, track)
+	}
+
+	dir := t.TempDir()
+	progress := newDownloadProgress(io.Discard, len(tracks))
+	results := m.DownloadTracks(dir, tracks, progress)
+	progress.close()
+
+	want := []string{"Intro.mp3", "intro (2).mp3", "Outro.mp3", "Intro (3).mp3"}
+	for i, res := range results {
+		if res.Err != nil || res.Skipped {
+			t.Fatalf("Track %d: err %v, skipped %v", i+1, res.Err, res.Skipped)
+		}
+		if res.Path != filepath.Join(dir, want[i]) {
+			t.Errorf("Track %d: path %s, want %s", i+1, res.Path, want[i])
+		}
+		data, err := os.ReadFile(res.Path)
+		if err != nil || !strings.HasSuffix(string(data), fmt.Sprintf("audio of /%d.mp3", i+1)) {
+			t.Errorf("Track %d: file holds %q, %v", i+1, data, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+const (
+	watchInterval  = 100 * time.Millisecond // How often playback is checked
+	bufferingAfter = time.Second            // Stall before EventBuffering
+	eventBuffer    = 16                     // Events held for a slow reader
+)
+
+// EventType says what happened to playback.
+type EventType int
+
+const (
+	EventStarted   EventType = iota // A track started playing
+	EventFinished                   // The track played to its end
+	EventError                      // Playback failed; Event.Err says why
+	EventBuffering                  // Playback is waiting on the network
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventFinished:
+		return "finished"
+	case EventError:
+		return "error"
+	case EventBuffering:
+		return "buffering"
+	}
+	return "unknown"
+}
+
+// Event is a playback event from StreamPlayer.Events.
+type Event struct {
+	Type EventType
+	Err  error // For EventError
+}
+
+// watcher follows one track's playback and reports how it goes. It only
+// touches the oto player and the decoder wrapper, both safe for concurrent
+// use, so it never needs the StreamPlayer lock.
+type watcher struct {
+	done   chan struct{}
+	exited chan struct{}
+}
+
+// watch starts a watcher for a track that just started playing.
+func watch(player *oto.Player, decoder *DecoderWrapper, events chan<- Event) *watcher {
+	w := &watcher{done: make(chan struct{}), exited: make(chan struct{})}
+	go func() {
+		defer close(w.exited)
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		var stalledRead int64 // Read already reported as buffering
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			if err := player.Err(); err != nil {
+				send(events, Event{Type: EventError, Err: err})
+				return
+			}
+			if decoder.EOF() && player.BufferedSize() == 0 && !player.IsPlaying() {
+				send(events, Event{Type: EventFinished})
+				return
+			}
+			if start, d := decoder.Stalled(); d > bufferingAfter && start != stalledRead {
+				stalledRead = start
+				send(events, Event{Type: EventBuffering})
+			}
+		}
+	}()
+	return w
+}
+
+// stop stops the watcher and waits for it to exit, so it sends nothing
+// more.
+func (w *watcher) stop() {
+	close(w.done)
+	<-w.exited
+}
+
+// send delivers an event unless nobody is keeping up with them.
+func send(events chan<- Event, ev Event) {
+	select {
+	case events <- ev:
+	default:
+	}
+}
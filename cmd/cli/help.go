@@ -4,11 +4,57 @@ import "fmt"
 
 var help = `
 Commands:
-  s, search <term> - Search for a track and play it
+  s, search <term> - Search for a track, list the results and play the
+                    first one that is available. Any other input is
+                    searched for too, including a command word followed
+                    by words it doesn't take, as in 'radio gaga'
+  list, ls        - List the results again, numbered
+  play <N>        - Play result number N; * marks the playing one,
+                    [E] explicit and [unavailable] unplayable tracks
   n, next         - Play the next track in the queue
   p, previous     - Play the previous track in the queue
   pp, pause       - Pause or resume playback
+  seek <m:ss>     - Jump to a position in the current track
+  ff [seconds]    - Skip forward, 10 seconds by default
+  rw [seconds]    - Skip back, 10 seconds by default
+  q, queue        - Show the queue; queued tracks play before the results
+                    continue and are kept across searches
+  queue add [N]   - Queue search result N, or the current track
+  queue next [N]  - Same, but play it next
+  queue add album [id]          - Queue an album, the current one by default
+  queue add playlist <kind>     - Queue a playlist (<owner>:<kind> for others')
+  queue rm <N>    - Remove entry N from the queue
+  queue mv <from> <to> - Move a queue entry
+  queue clear     - Empty the queue
+  queue shuffle   - Shuffle the queue; 'queue unshuffle' restores the order
+  repeat [off|all|one] - Show or set what happens when a track ends:
+                    stop after the last result, start over, or
+                    repeat the track
+  more            - Load the next page of search results
+  albums <query>  - Search albums
+  artists <query> - Search artists
+  album [N]       - Open album N of the last listing, 'album id <id>', or
+                    the current track's album; tracks are listed by disc
+  artist [N]      - Open artist N of the last search, 'artist id <id>', or
+                    the current track's artist: popular tracks and albums
+  playlists       - List your playlists with their kinds
+  playlist <kind> - Play one of your playlists (<owner>:<kind> for others')
+  add <kind>      - Add the current track to one of your playlists
+  like [album|artist]   - Like the current track, its album or its artist
+  unlike [album|artist] - Remove the like
+  dislike         - Dislike the current track and skip it
+  stations        - List the radio stations
+  radio [station] - Play a station: My Wave by default, a station ID from
+                    'stations', or 'artist'/'track' for one based on the
+                    current track
+  lyrics          - Show the current track's lyrics; synced lyrics are
+                    printed line by line as the track plays
+  lyrics off      - Stop printing synced lyrics
   dl, download    - Download the current track
+  download album <id>       - Download a whole album,
+  download playlist <kind>  - playlist (<owner>:<kind> for others')
+  download artist <id>      - or all tracks of an artist into a folder of
+                              its own; existing files are skipped
   exit           - Exit the program
 `
 
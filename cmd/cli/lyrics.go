@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// lyricsPoll is how often the playback position is checked while
+// following synced lyrics.
+const lyricsPoll = 100 * time.Millisecond
+
+// Lyrics fetches the current track's lyrics
+func (m *MusicPlayer) Lyrics() (*catalog.Lyrics, error) {
+	track, ok := m.CurrentTrack()
+	if !ok {
+		return nil, fmt.Errorf("nothing is playing")
+	}
+	return m.catalog.Lyrics(m.ctx, track.ID)
+}
+
+// FollowLyrics prints the lines of synced lyrics as playback reaches them,
+// starting with the line being sung now. It stops at the last line, when
+// the track changes or on StopLyrics.
+func (m *MusicPlayer) FollowLyrics(lyrics *catalog.Lyrics, print func(line string)) {
+	m.StopLyrics()
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.stopLyrics = cancel
+	go func() {
+		ticker := time.NewTicker(lyricsPoll)
+		defer ticker.Stop()
+		next := 0 // Index of the line to print next
+		for next < len(lyrics.Lines) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// Jumps, forward or back, resync on the line now being sung
+			i := lyrics.LineAt(m.player.Position())
+			if i >= next || i < next-1 {
+				if i >= 0 {
+					print(lyrics.Lines[i].Text)
+				}
+				next = i + 1
+			}
+		}
+	}()
+}
+
+// StopLyrics stops following synced lyrics
+func (m *MusicPlayer) StopLyrics() {
+	if m.stopLyrics != nil {
+		m.stopLyrics()
+		m.stopLyrics = nil
+	}
+}
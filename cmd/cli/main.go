@@ -4,20 +4,28 @@ import (
 	"bufio"
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/denizsincar29/goerror"
 	"github.com/joho/godotenv"
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/naming"
 )
 
 //go:embed version.txt
 var version string
 
+// defaultNameTemplate names downloaded files unless NAME_TEMPLATE is set
+const defaultNameTemplate = "{title} ({artist})"
+
 func main() {
 	l := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	e := goerror.NewError(l)
@@ -34,30 +42,57 @@ func main() {
 	token := os.Getenv("YA_MUSIC_TOKEN")
 	uid, err := strconv.Atoi(os.Getenv("YA_MUSIC_ID"))
 	e.Must(err)
-	player, err := NewPlayer(ctx, uid, token)
+	// File names for downloads, see internal/naming
+	nameTemplate := defaultNameTemplate
+	if v := os.Getenv("NAME_TEMPLATE"); v != "" {
+		nameTemplate = v
+	}
+	names, err := naming.Parse(nameTemplate)
+	e.Must(err)
+	player, err := NewPlayer(ctx, uid, token, names)
 	e.Must(err)
 	defer player.Close()
 	printWelcome()
-	stdin := bufio.NewScanner(os.Stdin)
+	// Commands and playback events are handled on this goroutine only
+	lines := make(chan string)
+	go func() {
+		stdin := bufio.NewScanner(os.Stdin)
+		for stdin.Scan() {
+			lines <- stdin.Text()
+		}
+		close(lines)
+	}()
 	for {
-		stdin.Scan()
-		// check for ctrl+c
-		//playing_done := player.finished
+		var input string
 		select {
 		case <-ctx.Done():
 			fmt.Println("Exiting...")
 			return
-			//case <-playing_done:
-			//	fmt.Println("Playing done")
-		//	player.PlayNext()
-		default:
-			// continue
+		case ev := <-player.Events():
+			handlePlayerEvent(player, ev)
+			continue
+		case line, ok := <-lines:
+			if !ok {
+				fmt.Println("Exiting...")
+				return
+			}
+			input = line
 		}
-		input := stdin.Text()
 		cmd := strings.SplitN(input, " ", 2)
+		// A command that takes no arguments followed by more words is a search
+		if noArgCommands[cmd[0]] && len(cmd) > 1 && strings.TrimSpace(cmd[1]) != "" {
+			runSearch(player, input)
+			continue
+		}
 		switch cmd[0] {
 		case "h", "help":
 			printHelp()
+		case "s", "search":
+			query := ""
+			if len(cmd) > 1 {
+				query = strings.TrimSpace(cmd[1])
+			}
+			runSearch(player, query)
 		case "n":
 			err := player.PlayNext()
 			if err != nil {
@@ -82,30 +117,783 @@ func main() {
 				player.Resume()
 				fmt.Println("Playing")
 			}
+		case "seek":
+			if len(cmd) < 2 {
+				runSearch(player, input)
+				continue
+			}
+			offset, err := parseTimestamp(strings.TrimSpace(cmd[1]))
+			if err != nil {
+				runSearch(player, input)
+				continue
+			}
+			if err := player.Seek(offset); err != nil {
+				fmt.Println("Error seeking:", err)
+				continue
+			}
+			printPosition(player)
+		case "ff", "rw":
+			secs := 10
+			if len(cmd) > 1 {
+				n, err := strconv.Atoi(strings.TrimSpace(cmd[1]))
+				if err != nil || n <= 0 {
+					runSearch(player, input)
+					continue
+				}
+				secs = n
+			}
+			delta := time.Duration(secs) * time.Second
+			if cmd[0] == "rw" {
+				delta = -delta
+			}
+			if err := player.SeekBy(delta); err != nil {
+				fmt.Println("Error seeking:", err)
+				continue
+			}
+			printPosition(player)
+		case "queue", "q":
+			args := []string{}
+			if len(cmd) > 1 {
+				args = strings.Fields(cmd[1])
+			}
+			if errors.Is(runQueueCommand(player, args), errNotCommand) {
+				runSearch(player, input)
+			}
+		case "repeat":
+			if len(cmd) > 1 {
+				mode, err := ParseRepeatMode(strings.TrimSpace(cmd[1]))
+				if err != nil {
+					runSearch(player, input)
+					continue
+				}
+				player.SetRepeat(mode)
+			}
+			fmt.Println("Repeat:", player.Repeat())
 		case "dl", "download":
+			if len(cmd) > 1 && strings.TrimSpace(cmd[1]) != "" {
+				if errors.Is(runDownloadCommand(player, strings.Fields(cmd[1])), errNotCommand) {
+					runSearch(player, input)
+				}
+				continue
+			}
 			title, artist := player.GetCurrentTrack()
 			fmt.Printf("Downloading: %s - %s\n", title, artist)
 			err := player.DownloadTrack("downloads/")
 			e.Check(err)
 			fmt.Println("Download complete.")
-		case "exit", "":
-			fmt.Println("Exiting...")
-			return
-		default:
-			// if the input is <3 letters, skip it
-			if len(input) < 3 {
-				fmt.Println("The input is too short.")
+		case "more":
+			tracks, err := player.MoreResults()
+			if err != nil {
+				fmt.Println("Error loading more results:", err)
+				continue
+			}
+			printResults(player, len(player.Results)-len(tracks))
+			fmt.Printf("Loaded %d more tracks (%d of %d)\n", len(tracks), len(player.Results), player.TotalResults())
+		case "list", "ls":
+			if len(player.Results) == 0 {
+				fmt.Println("No results, search for something first.")
+				continue
+			}
+			printResults(player, 0)
+		case "play":
+			if len(cmd) < 2 {
+				runSearch(player, input)
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(cmd[1]))
+			if err != nil {
+				runSearch(player, input)
+				continue
+			}
+			if n < 1 || n > len(player.Results) {
+				fmt.Printf("Pick a result between 1 and %d\n", len(player.Results))
+				continue
+			}
+			if err := player.PlayIndex(n - 1); err != nil {
+				fmt.Println("Error playing track:", err)
+				continue
+			}
+			title, artist := player.GetCurrentTrack()
+			fmt.Printf("Now playing: %s - %s\n", title, artist)
+		case "albums", "artists":
+			if len(cmd) < 2 || strings.TrimSpace(cmd[1]) == "" {
+				runSearch(player, input)
+				continue
+			}
+			query := strings.TrimSpace(cmd[1])
+			if cmd[0] == "albums" {
+				albums, err := player.SearchAlbums(query)
+				if err != nil {
+					fmt.Println("Error searching albums:", err)
+					continue
+				}
+				if len(albums) == 0 {
+					fmt.Println("No albums found.")
+					continue
+				}
+				printAlbums(albums, 0)
+				fmt.Println("Type 'album N' to open one.")
+				continue
+			}
+			artists, err := player.SearchArtists(query)
+			if err != nil {
+				fmt.Println("Error searching artists:", err)
+				continue
+			}
+			if len(artists) == 0 {
+				fmt.Println("No artists found.")
+				continue
+			}
+			for i, a := range artists {
+				fmt.Printf("%4d. %s\n", i+1, a.Name)
+			}
+			fmt.Println("Type 'artist N' to open one.")
+		case "album":
+			id, err := pickID(player, cmd, len(player.Albums), func(i int) int { return player.Albums[i].ID }, func(t catalog.Track) (int, bool) {
+				if len(t.Albums) == 0 {
+					return 0, false
+				}
+				return t.Albums[0].ID, true
+			})
+			if errors.Is(err, errNotCommand) {
+				runSearch(player, input)
+				continue
+			}
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			album, err := player.OpenAlbum(id)
+			if err != nil {
+				fmt.Println("Error loading album:", err)
+				continue
+			}
+			printAlbum(player, album)
+		case "artist":
+			id, err := pickID(player, cmd, len(player.Artists), func(i int) int { return player.Artists[i].ID }, func(t catalog.Track) (int, bool) {
+				if len(t.Artists) == 0 {
+					return 0, false
+				}
+				return t.Artists[0].ID, true
+			})
+			if errors.Is(err, errNotCommand) {
+				runSearch(player, input)
 				continue
 			}
-			_, err := player.SearchTracks(input)
 			if err != nil {
-				fmt.Println("Error searching tracks:", err)
+				fmt.Println(err)
+				continue
+			}
+			page, err := player.OpenArtist(id)
+			if err != nil {
+				fmt.Println("Error loading artist:", err)
+				continue
+			}
+			fmt.Println(page.Artist.Name)
+			if len(player.Results) > 0 {
+				fmt.Println("Popular tracks:")
+				printResults(player, 0)
+			}
+			if len(page.Albums) > 0 {
+				fmt.Println("Discography:")
+				printAlbums(player.Albums[:len(page.Albums)], 0)
+			}
+			if len(page.AppearsOn) > 0 {
+				fmt.Println("Appears on:")
+				printAlbums(player.Albums[len(page.Albums):], len(page.Albums))
+			}
+			fmt.Println("Type 'play N' for a track or 'album N' to open an album.")
+		case "playlists":
+			lists, err := player.Playlists()
+			if err != nil {
+				fmt.Println("Error loading playlists:", err)
+				continue
+			}
+			for _, p := range lists {
+				fmt.Printf("%6d  %s (%d tracks)\n", p.Kind, p.Title, p.TrackCount)
+			}
+		case "playlist":
+			owner, kind, err := parsePlaylistID(cmd)
+			if err != nil {
+				runSearch(player, input)
+				continue
+			}
+			p, err := player.LoadPlaylist(owner, kind)
+			if err != nil {
+				fmt.Println("Error loading playlist:", err)
+				continue
+			}
+			fmt.Printf("Playlist %s by %s: %d tracks\n", p.Title, playlistOwner(p), len(p.Tracks))
+			if err := player.PlayFirst(); err != nil {
+				printResults(player, 0)
+				fmt.Println("Error playing track:", err)
+				continue
+			}
+			printResults(player, 0)
+			title, artist := player.GetCurrentTrack()
+			fmt.Printf("Now playing: %s - %s\n", title, artist)
+		case "add":
+			_, kind, err := parsePlaylistID(cmd)
+			if err != nil {
+				runSearch(player, input)
+				continue
+			}
+			p, err := player.AddToPlaylist(kind)
+			if err != nil {
+				fmt.Println("Error adding to playlist:", err)
+				continue
+			}
+			title, _ := player.GetCurrentTrack()
+			fmt.Printf("Added %s to %s (%d tracks)\n", title, p.Title, p.TrackCount)
+		case "like", "unlike":
+			kind := catalog.LikeTrack
+			if len(cmd) > 1 {
+				kind = strings.TrimSpace(cmd[1])
+			}
+			if !catalog.ValidLikeKind(kind) {
+				runSearch(player, input)
+				continue
+			}
+			like := cmd[0] == "like"
+			name, err := player.Like(kind, like)
+			if err != nil {
+				fmt.Printf("Error changing the like of the %s: %v\n", kind, err)
+				continue
+			}
+			if like {
+				fmt.Printf("Liked %s %s\n", kind, name)
+			} else {
+				fmt.Printf("Unliked %s %s\n", kind, name)
+			}
+		case "dislike":
+			name, err := player.Dislike()
+			if err != nil {
+				fmt.Println("Error disliking track:", err)
+				continue
+			}
+			fmt.Printf("Disliked %s, it won't show up in results again\n", name)
+			if err := player.PlayNext(); err != nil {
+				fmt.Println("Error playing next track:", err)
 				continue
 			}
-			player.PlayFirst()
 			title, artist := player.GetCurrentTrack()
 			fmt.Printf("Now playing: %s - %s\n", title, artist)
+		case "stations":
+			stations, err := player.Stations()
+			if err != nil {
+				fmt.Println("Error loading stations:", err)
+				continue
+			}
+			for _, st := range stations {
+				fmt.Printf("%-24s %s\n", st.ID, st.Name)
+			}
+		case "radio":
+			arg := ""
+			if len(cmd) > 1 {
+				arg = strings.TrimSpace(cmd[1])
+			}
+			station, err := parseStation(arg, player)
+			if errors.Is(err, errNotCommand) {
+				runSearch(player, input)
+				continue
+			}
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if err := player.StartRadio(station); err != nil {
+				fmt.Println("Error starting radio:", err)
+				continue
+			}
+			title, artist := player.GetCurrentTrack()
+			fmt.Printf("Radio %s\nNow playing: %s - %s\n", station, title, artist)
+		case "lyrics":
+			if len(cmd) > 1 && strings.TrimSpace(cmd[1]) == "off" {
+				player.StopLyrics()
+				continue
+			}
+			if len(cmd) > 1 && strings.TrimSpace(cmd[1]) != "" {
+				runSearch(player, input)
+				continue
+			}
+			lyrics, err := player.Lyrics()
+			if errors.Is(err, catalog.ErrNoLyrics) {
+				fmt.Println("This track has no lyrics.")
+				continue
+			}
+			if err != nil {
+				fmt.Println("Error loading lyrics:", err)
+				continue
+			}
+			if !lyrics.Synced() {
+				fmt.Println(lyrics.Text)
+				if len(lyrics.Writers) > 0 {
+					fmt.Println("Writers:", strings.Join(lyrics.Writers, ", "))
+				}
+				continue
+			}
+			fmt.Println("Following synced lyrics, 'lyrics off' stops.")
+			player.FollowLyrics(lyrics, func(line string) {
+				fmt.Println(line)
+			})
+		case "exit", "":
+			fmt.Println("Exiting...")
+			return
+		default:
+			runSearch(player, input)
+		}
+	}
+
+}
+
+// noArgCommands are the commands that take no arguments.
+var noArgCommands = map[string]bool{
+	"h": true, "help": true, "n": true, "p": true, "pp": true,
+	"list": true, "ls": true, "more": true, "playlists": true,
+	"dislike": true, "stations": true, "exit": true,
+}
+
+// errNotCommand is returned by the argument parsers when the words after a
+// command word don't have the command's form. The whole line is then
+// searched for instead, so "album leaf" finds the band.
+var errNotCommand = errors.New("not command arguments")
+
+// runSearch searches tracks, lists the results and plays the first one
+// that is available.
+func runSearch(player *MusicPlayer, query string) {
+	// if the input is <3 letters, skip it
+	if len(query) < 3 {
+		fmt.Println("The input is too short.")
+		return
+	}
+	tracks, err := player.SearchTracks(query, 0)
+	if err != nil {
+		fmt.Println("Error searching tracks:", err)
+		return
+	}
+	if len(tracks) == 0 {
+		fmt.Println("Nothing found.")
+		return
+	}
+	if err := player.PlayFirst(); err != nil {
+		printResults(player, 0)
+		fmt.Println("Error playing track:", err)
+		return
+	}
+	printResults(player, 0)
+	title, artist := player.GetCurrentTrack()
+	fmt.Printf("Now playing: %s - %s\n", title, artist)
+}
+
+// handlePlayerEvent reacts to playback events: a finished track is
+// followed by the next one according to the repeat mode.
+func handlePlayerEvent(player *MusicPlayer, ev Event) {
+	switch ev.Type {
+	case EventFinished:
+		playing, err := player.Advance()
+		if err != nil {
+			fmt.Println("Error playing next track:", err)
+			return
+		}
+		if !playing {
+			fmt.Println("Reached the end of the results.")
+			return
+		}
+		title, artist := player.GetCurrentTrack()
+		fmt.Printf("Now playing: %s - %s\n", title, artist)
+	case EventError:
+		fmt.Println("Playback error:", ev.Err)
+	case EventBuffering:
+		fmt.Println("Buffering...")
+	}
+}
+
+// runQueueCommand runs the queue subcommands. Positions and result numbers
+// are 1-based as printed. Errors are printed; only errNotCommand, for
+// words that aren't a queue subcommand, is returned.
+func runQueueCommand(player *MusicPlayer, args []string) error {
+	queue := player.Queue()
+	if len(args) == 0 || args[0] == "list" {
+		printQueue(player)
+		return nil
+	}
+	switch args[0] {
+	case "add", "next":
+		next := args[0] == "next"
+		rest := args[1:]
+		switch {
+		case len(rest) > 0 && rest[0] == "album":
+			id := 0
+			if len(rest) > 1 {
+				var err error
+				if id, err = strconv.Atoi(rest[1]); err != nil {
+					fmt.Printf("invalid album ID %q\n", rest[1])
+					return nil
+				}
+			} else if track, ok := player.CurrentTrack(); ok && len(track.Albums) > 0 {
+				id = track.Albums[0].ID
+			} else {
+				fmt.Println("Usage: queue add album <id>")
+				return nil
+			}
+			album, n, err := player.QueueAlbum(id, next)
+			if err != nil {
+				fmt.Println("Error loading album:", err)
+				return nil
+			}
+			fmt.Printf("Queued %d tracks of %s\n", n, album.Title)
+		case len(rest) > 0 && rest[0] == "playlist":
+			owner, kind, err := parsePlaylistID(append([]string{"queue " + args[0] + " playlist"}, rest[1:]...))
+			if err != nil {
+				return errNotCommand
+			}
+			p, n, err := player.QueuePlaylist(owner, kind, next)
+			if err != nil {
+				fmt.Println("Error loading playlist:", err)
+				return nil
+			}
+			fmt.Printf("Queued %d tracks of %s\n", n, p.Title)
+		default:
+			var track catalog.Track
+			var err error
+			if len(rest) > 0 {
+				i, convErr := strconv.Atoi(rest[0])
+				if convErr != nil {
+					return errNotCommand
+				}
+				track, err = player.QueueResult(i-1, next)
+			} else {
+				track, err = player.QueueCurrent(next)
+			}
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			if next {
+				fmt.Printf("Playing %s next\n", track.FullTitle())
+			} else {
+				fmt.Printf("Queued %s (%d in the queue)\n", track.FullTitle(), queue.Len())
+			}
+		}
+	case "rm", "remove":
+		if len(args) != 2 {
+			fmt.Println("Usage: queue rm <position>")
+			return nil
+		}
+		i, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Printf("invalid position %q\n", args[1])
+			return nil
+		}
+		track, err := queue.Remove(i - 1)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		fmt.Printf("Removed %s from the queue\n", track.FullTitle())
+	case "mv", "move":
+		if len(args) != 3 {
+			fmt.Println("Usage: queue mv <from> <to>")
+			return nil
+		}
+		from, err1 := strconv.Atoi(args[1])
+		to, err2 := strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil {
+			fmt.Println("Usage: queue mv <from> <to>")
+			return nil
+		}
+		if err := queue.Move(from-1, to-1); err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		printQueue(player)
+	case "clear":
+		queue.Clear()
+		fmt.Println("Queue cleared")
+	case "shuffle":
+		queue.Shuffle()
+		printQueue(player)
+	case "unshuffle":
+		queue.Unshuffle()
+		printQueue(player)
+	default:
+		return errNotCommand
+	}
+	return nil
+}
+
+// printResults prints the results from index from on, numbered for the
+// play command. The playing result is marked with a *, explicit tracks
+// with [E] and tracks that can't be played with [unavailable].
+func printResults(player *MusicPlayer, from int) {
+	printResultRange(player, from, len(player.Results))
+}
+
+// printResultRange prints the results from index from up to, not
+// including, to.
+func printResultRange(player *MusicPlayer, from, to int) {
+	current, playing := player.CurrentTrack()
+	for i := from; i < to; i++ {
+		track := player.Results[i]
+		mark := " "
+		if playing && track.ID == current.ID {
+			mark = "*"
+		}
+		line := fmt.Sprintf("%s%3d. %s - %s", mark, i+1, track.FullTitle(), catalog.ArtistNames(track.Artists))
+		if len(track.Albums) > 0 {
+			line += " | " + track.Albums[0].Title
+		}
+		line += " | " + formatTimestamp(time.Duration(track.DurationMs)*time.Millisecond)
+		if track.Explicit {
+			line += " [E]"
+		}
+		if !track.Available {
+			line += " [unavailable]"
+		}
+		fmt.Println(line)
+	}
+}
+
+// runDownloadCommand downloads a whole album, playlist or artist into a
+// folder of its own under downloads/, then lists what failed. Errors are
+// printed; only errNotCommand, for arguments of another form, is returned.
+func runDownloadCommand(player *MusicPlayer, args []string) error {
+	if len(args) != 2 {
+		return errNotCommand
+	}
+	var (
+		name   string
+		tracks []catalog.Track
+		err    error
+	)
+	switch args[0] {
+	case "album", "artist":
+		id, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return errNotCommand
+		}
+		if args[0] == "album" {
+			name, tracks, err = player.AlbumDownload(id)
+		} else {
+			name, tracks, err = player.ArtistDownload(id)
+		}
+	case "playlist":
+		owner, kind, parseErr := parsePlaylistID([]string{"download playlist", args[1]})
+		if parseErr != nil {
+			return errNotCommand
+		}
+		name, tracks, err = player.PlaylistDownload(owner, kind)
+	default:
+		return errNotCommand
+	}
+	if err != nil {
+		fmt.Printf("Error loading %s: %v\n", args[0], err)
+		return nil
+	}
+	if len(tracks) == 0 {
+		fmt.Printf("The %s has no tracks.\n", args[0])
+		return nil
+	}
+
+	dir := filepath.Join("downloads", naming.Sanitize(name))
+	fmt.Printf("Downloading %d tracks of %s to %s\n", len(tracks), name, dir)
+	progress := newDownloadProgress(os.Stdout, len(tracks))
+	results := player.DownloadTracks(dir, tracks, progress)
+	progress.close()
+
+	var downloaded, skipped int
+	var failed []DownloadResult
+	for _, res := range results {
+		switch {
+		case res.Err != nil:
+			failed = append(failed, res)
+		case res.Skipped:
+			skipped++
+		default:
+			downloaded++
+		}
+	}
+	fmt.Printf("Downloaded %d, skipped %d already there, %d failed.\n", downloaded, skipped, len(failed))
+	for _, res := range failed {
+		fmt.Printf("  %s - %s: %v\n", res.Track.FullTitle(), catalog.ArtistNames(res.Track.Artists), res.Err)
+	}
+	return nil
+}
+
+// printAlbums prints albums numbered from offset+1, for the album command.
+func printAlbums(albums []catalog.Album, offset int) {
+	for i, a := range albums {
+		line := fmt.Sprintf("%4d. %s - %s", offset+i+1, a.Title, catalog.ArtistNames(a.Artists))
+		if a.Year != 0 {
+			line += fmt.Sprintf(" (%d)", a.Year)
+		}
+		if a.Type != "" {
+			line += " [" + a.Type + "]"
+		}
+		if a.TrackCount != 0 {
+			line += fmt.Sprintf(", %d tracks", a.TrackCount)
+		}
+		fmt.Println(line)
+	}
+}
+
+// printAlbum prints an opened album's tracks grouped by volume, numbered
+// across volumes as in the results.
+func printAlbum(player *MusicPlayer, album *catalog.Album) {
+	fmt.Printf("%s - %s", album.Title, catalog.ArtistNames(album.Artists))
+	if album.Year != 0 {
+		fmt.Printf(" (%d)", album.Year)
+	}
+	fmt.Println()
+	start := 0
+	for v, volume := range album.Volumes {
+		if len(album.Volumes) > 1 {
+			fmt.Printf("Disc %d:\n", v+1)
+		}
+		printResultRange(player, start, start+len(volume))
+		start += len(volume)
+	}
+	fmt.Println("Type 'play N' to play a track.")
+}
+
+// playlistOwner returns the name to show for a playlist's owner.
+func playlistOwner(p *catalog.Playlist) string {
+	switch {
+	case p.OwnerName != "":
+		return p.OwnerName
+	case p.OwnerLogin != "":
+		return p.OwnerLogin
+	}
+	return strconv.Itoa(p.OwnerUID)
+}
+
+// pickID reads the argument of the album and artist commands: a number
+// from the last listing, "id <id>", or nothing for the one of the playing
+// track. Anything else is errNotCommand.
+func pickID(player *MusicPlayer, cmd []string, listed int, listedID func(i int) int, ofTrack func(catalog.Track) (int, bool)) (int, error) {
+	args := []string{}
+	if len(cmd) > 1 {
+		args = strings.Fields(cmd[1])
+	}
+	switch {
+	case len(args) == 0:
+		if track, ok := player.CurrentTrack(); ok {
+			if id, ok := ofTrack(track); ok {
+				return id, nil
+			}
 		}
+		return 0, errNotCommand
+	case args[0] == "id" && len(args) == 2:
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return 0, errNotCommand
+		}
+		return id, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || len(args) > 1 {
+		return 0, errNotCommand
+	}
+	if n < 1 || n > listed {
+		if listed == 0 {
+			return 0, fmt.Errorf("nothing listed, search with %ss <query> first or use %s id <id>", cmd[0], cmd[0])
+		}
+		return 0, fmt.Errorf("pick a number between 1 and %d", listed)
+	}
+	return listedID(n - 1), nil
+}
+
+// printQueue prints the playing track and the queue.
+func printQueue(player *MusicPlayer) {
+	if track, ok := player.CurrentTrack(); ok {
+		fmt.Printf("Now playing: %s - %s\n", track.FullTitle(), catalog.ArtistNames(track.Artists))
+	}
+	queue := player.Queue()
+	if queue.Len() == 0 {
+		fmt.Println("The queue is empty.")
+		return
 	}
+	if queue.Shuffled() {
+		fmt.Println("Queue (shuffled):")
+	} else {
+		fmt.Println("Queue:")
+	}
+	for i, track := range queue.Tracks() {
+		fmt.Printf("%3d. %s - %s\n", i+1, track.FullTitle(), catalog.ArtistNames(track.Artists))
+	}
+}
+
+// parseTimestamp parses a position in the track given as m:ss, h:mm:ss
+// or plain seconds.
+func parseTimestamp(s string) (time.Duration, error) {
+	var d time.Duration
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid position %q, expected m:ss", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("invalid position %q, expected m:ss", s)
+		}
+		d = d*60 + time.Duration(n)*time.Second
+	}
+	return d, nil
+}
 
+// formatTimestamp formats a position as m:ss.
+func formatTimestamp(d time.Duration) string {
+	secs := int(d / time.Second)
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+// printPosition prints where playback is in the current track.
+func printPosition(player *MusicPlayer) {
+	fmt.Printf("At %s / %s\n", formatTimestamp(player.Position()), formatTimestamp(player.Length()))
+}
+
+// parsePlaylistID reads the playlist argument of a command: a kind from
+// the playlists list, or owner:kind for another user's playlist.
+func parsePlaylistID(cmd []string) (owner, kind int, err error) {
+	if len(cmd) < 2 {
+		return 0, 0, fmt.Errorf("usage: %s <kind> or %s <owner>:<kind>", cmd[0], cmd[0])
+	}
+	arg := strings.TrimSpace(cmd[1])
+	if o, k, ok := strings.Cut(arg, ":"); ok {
+		if owner, err = strconv.Atoi(o); err != nil {
+			return 0, 0, fmt.Errorf("invalid playlist owner %q", o)
+		}
+		arg = k
+	}
+	if kind, err = strconv.Atoi(arg); err != nil {
+		return 0, 0, fmt.Errorf("invalid playlist kind %q", arg)
+	}
+	return owner, kind, nil
+}
+
+// parseStation turns the argument of the radio command into a station ID.
+// Besides full IDs such as genre:rock it accepts "wave" (or nothing) for
+// My Wave, and "artist" or "track" for a station based on the current track.
+// Anything else is errNotCommand.
+func parseStation(arg string, player *MusicPlayer) (string, error) {
+	switch arg {
+	case "", "wave", "mywave":
+		return catalog.MyWave, nil
+	case "artist", "track":
+		track, ok := player.CurrentTrack()
+		if !ok {
+			return "", fmt.Errorf("nothing is playing to base the station on")
+		}
+		if arg == "track" {
+			return catalog.TrackStation(track.ID), nil
+		}
+		if len(track.Artists) == 0 {
+			return "", fmt.Errorf("the current track has no artist")
+		}
+		return catalog.ArtistStation(track.Artists[0].ID), nil
+	}
+	if !catalog.ValidStation(arg) {
+		return "", errNotCommand
+	}
+	return arg, nil
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParsePlaylistID tests reading a playlist kind or owner:kind
+func TestParsePlaylistID(t *testing.T) {
+	tests := []struct {
+		cmd   []string
+		owner int
+		kind  int
+		ok    bool
+	}{
+		{[]string{"playlist", "1000"}, 0, 1000, true},
+		{[]string{"playlist", " 3 "}, 0, 3, true},
+		{[]string{"playlist", "777:1005"}, 777, 1005, true},
+		{[]string{"playlist"}, 0, 0, false},
+		{[]string{"playlist", ""}, 0, 0, false},
+		{[]string{"playlist", "road trip"}, 0, 0, false},
+		{[]string{"playlist", "777:"}, 0, 0, false},
+		{[]string{"playlist", ":1005"}, 0, 0, false},
+		{[]string{"playlist", "me:1005"}, 0, 0, false},
+		{[]string{"add", "1:2:3"}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		owner, kind, err := parsePlaylistID(tt.cmd)
+		if (err == nil) != tt.ok || owner != tt.owner || kind != tt.kind {
+			t.Errorf("parsePlaylistID(%q) = %d, %d, %v, want %d, %d, ok %v", tt.cmd, owner, kind, err, tt.owner, tt.kind, tt.ok)
+		}
+	}
+}
+
+// TestParseTimestamp tests reading seek positions
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"90", 90 * time.Second, true},
+		{"1:30", 90 * time.Second, true},
+		{"0:05", 5 * time.Second, true},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second, true},
+		{"10:00", 10 * time.Minute, true},
+		{"", 0, false},
+		{"1:60", 0, false},
+		{"1:-5", 0, false},
+		{"-5", 0, false},
+		{"1:2:3:4", 0, false},
+		{"1:", 0, false},
+		{"and destroy", 0, false},
+		{"1.5", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseTimestamp(%q) = %v, %v, want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
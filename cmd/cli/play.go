@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/ebitengine/oto/v3"
 	"github.com/hajimehoshi/go-mp3"
+	"go_yandex_music/internal/upstream"
 )
 
 const (
@@ -20,15 +23,23 @@ const (
 
 // StreamPlayer handles streaming and playback of MP3 audio from a URL.
 type StreamPlayer struct {
-	stream  io.ReadCloser // The audio stream (HTTP response body)
-	decoder *mp3.Decoder  // MP3 Decoder
-	player  *oto.Player   // Audio Player
-	context *oto.Context  // Audio Context
+	stream  io.ReadCloser   // The audio stream (HTTP reader that can seek)
+	decoder *mp3.Decoder    // MP3 Decoder; can only seek once made seekable
+	pcm     *DecoderWrapper // Decoder output as read by the player
+	player  *oto.Player     // Audio Player
+	context *oto.Context    // Audio Context
 
 	mu      sync.Mutex // Protects concurrent access to shared fields
 	playing bool       // Flag indicating if playback is active (Play called, Stop not called)
 	paused  bool       // Flag indicating if playback is paused
 	url     string     // Store the URL for potential reuse (e.g., restarting after stop)
+	refresh upstream.RefreshFunc
+	client  *http.Client
+	events  chan Event // See Events
+	watch   *watcher   // Follows the playing track, nil when stopped
+
+	stopIndex context.CancelFunc // Stops building the seekable decoder of the open track
+	indexErr  error              // Why the open track can't seek, if building its decoder failed
 
 	// Store config values needed to recreate the player correctly
 	sampleRate  int
@@ -38,10 +49,11 @@ type StreamPlayer struct {
 
 // Config holds configuration for the audio context.
 type Config struct {
-	SampleRate  int        // Sample rate of the audio. Defaults to 44100 if zero.
-	NumChannels int        // Number of channels. Defaults to 2 if zero.
-	Format      oto.Format // Audio format (e.g., oto.FormatSignedInt16LE). Defaults if zero.
-	BufferSize  int        // Buffer size in bytes. Defaults if zero.
+	SampleRate  int          // Sample rate of the audio. Defaults to 44100 if zero.
+	NumChannels int          // Number of channels. Defaults to 2 if zero.
+	Format      oto.Format   // Audio format (e.g., oto.FormatSignedInt16LE). Defaults if zero.
+	BufferSize  int          // Buffer size in bytes. Defaults if zero.
+	HTTPClient  *http.Client // Client used to fetch streams. Defaults to http.DefaultClient if nil.
 }
 
 // NewStreamPlayer creates a new YAMusic instance and initializes the audio context.
@@ -71,6 +83,11 @@ func NewStreamPlayer(cfg *Config) (*StreamPlayer, error) {
 		bufferSize = defaultBufferSize
 	}
 
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
 	// Initialize the audio context
 	// The readyChan indicates when the context is ready, but for synchronous init,
 	// we can usually proceed directly after NewContext returns without error.
@@ -92,14 +109,24 @@ func NewStreamPlayer(cfg *Config) (*StreamPlayer, error) {
 		sampleRate:  sampleRate, // Store for potential future use if needed
 		numChannels: numChannels,
 		format:      format,
+		client:      client,
+		events:      make(chan Event, eventBuffer),
 	}
 
 	return ym, nil
 }
 
-// OpenURL fetches the audio stream from the URL and initializes the MP3 decoder.
+// errSeekNotReady is returned by Seek until the track can seek.
+var errSeekNotReady = errors.New("the track is still loading for seeking, try again in a moment")
+
+// OpenURL opens the audio stream at url and initializes the MP3 decoder.
+// The stream is read with Range requests; refresh, if not nil, replaces
+// the URL when the CDN has expired it. The decoder gets the stream without
+// its Seek, since go-mp3 reads every frame of a seekable source before
+// returning; playback starts as soon as the first frame arrives, and a
+// seekable decoder is built in the background, see buildSeekable.
 // It closes any existing stream before opening the new one.
-func (ym *StreamPlayer) OpenURL(url string) error {
+func (ym *StreamPlayer) OpenURL(url string, refresh upstream.RefreshFunc) error {
 	ym.mu.Lock()
 	defer ym.mu.Unlock()
 
@@ -111,25 +138,20 @@ func (ym *StreamPlayer) OpenURL(url string) error {
 
 	// Store the url *before* potentially failing the HTTP GET
 	ym.url = url
+	ym.refresh = refresh
 	ym.playing = false // Reset state when opening a new URL
 	ym.paused = false
 
-	resp, err := http.Get(url)
+	stream, err := upstream.NewRangeReader(ym.client, url, refresh)
 	if err != nil {
-		ym.url = "" // Clear URL if GET failed
+		ym.url = "" // Clear URL if the request failed
 		return fmt.Errorf("http get error: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close() // Important: Close the body even on non-200 status
-		ym.url = ""       // Clear URL on non-OK status
-		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
-	}
-
-	ym.stream = resp.Body // Assign the response body to the stream
+	ym.stream = stream
 
 	// Create the MP3 decoder
-	decoder, err := mp3.NewDecoder(ym.stream)
+	decoder, err := mp3.NewDecoder(streamOnly{stream})
 	if err != nil {
 		ym.stream.Close() // Close the stream if decoder creation fails
 		ym.stream = nil
@@ -145,6 +167,12 @@ func (ym *StreamPlayer) OpenURL(url string) error {
 	// }
 
 	ym.decoder = decoder
+	ym.pcm = NewDecoderWrapper(decoder)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ym.stopIndex = cancel
+	ym.indexErr = nil
+	go ym.buildSeekable(ctx, ym.pcm, url, refresh)
 
 	return nil
 }
@@ -185,7 +213,7 @@ func (ym *StreamPlayer) Play() error {
 
 	// If stopped (player is nil) or never started, create and start a new player
 	if ym.player == nil {
-		ym.player = ym.context.NewPlayer(ym.decoder)
+		ym.player = ym.context.NewPlayer(ym.pcm)
 		// Player volume can be set here if needed: ym.player.SetVolume(1.0)
 	}
 
@@ -193,9 +221,12 @@ func (ym *StreamPlayer) Play() error {
 	ym.playing = true
 	ym.paused = false // Ensure paused is false when starting fresh
 
-	// Note: Play starts playback asynchronously. The stream will be read
-	// by the player in a separate goroutine. This function returns immediately.
-	// You might want a way to detect when playback finishes (e.g., io.EOF).
+	// Play starts playback asynchronously. The stream is read by the player
+	// in a separate goroutine; the watcher reports how that goes on Events.
+	if ym.watch == nil {
+		ym.watch = watch(ym.player, ym.pcm, ym.events)
+		send(ym.events, Event{Type: EventStarted})
+	}
 
 	return nil
 }
@@ -238,6 +269,20 @@ func (ym *StreamPlayer) Stop() error {
 	ym.mu.Lock()
 	defer ym.mu.Unlock()
 
+	// Stop the watcher, and drop what it reported about this track
+	if ym.watch != nil {
+		ym.watch.stop()
+		ym.watch = nil
+	drain:
+		for {
+			select {
+			case <-ym.events:
+			default:
+				break drain
+			}
+		}
+	}
+
 	// Close the player first
 	var playerErr error
 	if ym.player != nil {
@@ -261,7 +306,8 @@ func (ym *StreamPlayer) Stop() error {
 }
 
 // PlayAnotherURL stops any current playback, opens the new URL, and starts playing it.
-func (ym *StreamPlayer) PlayAnotherURL(url string) error {
+// refresh is passed on to OpenURL.
+func (ym *StreamPlayer) PlayAnotherURL(url string, refresh upstream.RefreshFunc) error {
 	// Stop existing playback cleanly. Lock is acquired within Stop.
 	if err := ym.Stop(); err != nil {
 		// Log or return the error from stopping the previous track
@@ -269,7 +315,7 @@ func (ym *StreamPlayer) PlayAnotherURL(url string) error {
 	}
 
 	// Open the new URL. Lock is acquired within OpenURL.
-	if err := ym.OpenURL(url); err != nil {
+	if err := ym.OpenURL(url, refresh); err != nil {
 		return fmt.Errorf("failed to open new URL: %w", err)
 	}
 
@@ -281,9 +327,17 @@ func (ym *StreamPlayer) PlayAnotherURL(url string) error {
 	return nil
 }
 
+// Events returns the playback events: a track started, finished, failed
+// or is buffering. Events about a track are dropped once it is stopped, so
+// a Finished received here is always about the current track. Events that
+// aren't read in time are dropped.
+func (ym *StreamPlayer) Events() <-chan Event {
+	return ym.events
+}
+
 // IsPlaying returns true if the audio is intended to be playing (Play called, Stop not called).
-// Note: This reflects the *intended* state. The actual player might stop if the stream ends (EOF).
-// You could check `ym.player != nil && ym.player.IsPlaying()` for the hardware state.
+// Note: This reflects the *intended* state. The actual player stops when the stream ends,
+// which is reported as EventFinished on Events.
 func (ym *StreamPlayer) IsPlaying() bool {
 	ym.mu.Lock()
 	defer ym.mu.Unlock()
@@ -311,6 +365,10 @@ func (ym *StreamPlayer) Close() error {
 // closeStreamInternal closes the network stream and decoder. Internal use, assumes lock is held or not needed.
 // Returns error from stream closing.
 func (ym *StreamPlayer) closeStreamInternal() error {
+	if ym.stopIndex != nil {
+		ym.stopIndex()
+		ym.stopIndex = nil
+	}
 	var err error
 	if ym.stream != nil {
 		// Decoder wraps the stream, closing the stream should be sufficient.
@@ -318,34 +376,156 @@ func (ym *StreamPlayer) closeStreamInternal() error {
 		ym.stream = nil
 	}
 	ym.decoder = nil // Clear decoder reference
+	ym.pcm = nil
 	return err
 }
 
-// Length returns the total length of the decoded audio stream.
-// This requires the decoder to be initialized (OpenURL succeeded).
-// Note: Length calculation might require decoding the entire stream for VBR MP3s,
-// which might not be efficient for streaming. The go-mp3 library calculation is usually efficient.
+// Length returns the total length of the decoded audio stream, or 0 while
+// it is unknown: go-mp3 only knows it once the decoder is seekable.
 func (ym *StreamPlayer) Length() time.Duration {
 	ym.mu.Lock()
 	defer ym.mu.Unlock()
 
-	if ym.decoder == nil {
+	if ym.decoder == nil || ym.decoder.Length() < 0 {
 		return 0
 	}
-	bytesPerSample := 2
+	return ym.pcmDuration(ym.decoder.Length())
+}
+
+// Position returns how far into the track playback is. It counts the
+// decoded bytes the player has consumed, minus what it still holds in its
+// buffer, so it stands still while paused.
+func (ym *StreamPlayer) Position() time.Duration {
+	ym.mu.Lock()
+	defer ym.mu.Unlock()
+
+	if ym.decoder == nil || ym.pcm == nil {
+		return 0
+	}
+	played := ym.pcm.Offset()
+	if ym.player != nil {
+		played -= int64(ym.player.BufferedSize())
+	}
+	if played < 0 {
+		played = 0
+	}
+	return ym.pcmDuration(played)
+}
+
+// Seek moves playback to offset from the start of the track, clamped to
+// the track's length. Playing or paused, the player stays that way. Until
+// the seekable decoder is ready, shortly after the track has been read
+// through once, it returns errSeekNotReady.
+func (ym *StreamPlayer) Seek(offset time.Duration) error {
+	ym.mu.Lock()
+	defer ym.mu.Unlock()
+
+	if ym.decoder == nil || ym.pcm == nil {
+		return &PlayerError{"No decoder initialized. Call OpenURL first."}
+	}
+	if ym.decoder.Length() < 0 {
+		if ym.indexErr != nil {
+			return fmt.Errorf("seek: %w", ym.indexErr)
+		}
+		return errSeekNotReady
+	}
+	frame := int64(ym.bytesPerSample() * ym.numChannels)
+	pos := int64(offset) * int64(ym.decoder.SampleRate()) / int64(time.Second) * frame
+	if length := ym.decoder.Length(); pos > length {
+		pos = length - length%frame
+	}
+	if pos < 0 {
+		pos = 0
+	}
+
+	var err error
+	if ym.player != nil {
+		// The player reads ahead; its Seek drops that buffer too
+		_, err = ym.player.Seek(pos, io.SeekStart)
+	} else {
+		_, err = ym.pcm.Seek(pos, io.SeekStart)
+	}
+	if err != nil {
+		return fmt.Errorf("seek: %w", err)
+	}
+	return nil
+}
+
+// buildSeekable replaces the streaming decoder of pcm with one on a
+// seekable stream of its own. go-mp3 indexes every frame of such a stream
+// when it is created, which reads the whole file, so this runs in the
+// background while the track plays, without the lock; the Range requests
+// of later seeks only fetch from the new position on. ctx is cancelled
+// when the track is closed, which aborts the download. The streaming
+// stream is closed once the player no longer reads from it.
+func (ym *StreamPlayer) buildSeekable(ctx context.Context, pcm *DecoderWrapper, url string, refresh upstream.RefreshFunc) {
+	fail := func(err error) {
+		ym.mu.Lock()
+		defer ym.mu.Unlock()
+		if ctx.Err() == nil {
+			ym.indexErr = err
+		}
+	}
+	stream, err := upstream.NewRangeReaderContext(ctx, ym.client, url, refresh)
+	if err != nil {
+		fail(err)
+		return
+	}
+	decoder, err := mp3.NewDecoder(stream)
+	if err == nil && decoder.Length() < 0 {
+		err = errors.New("no frames found")
+	}
+	if err != nil {
+		stream.Close()
+		fail(fmt.Errorf("failed to create mp3 decoder: %w", err))
+		return
+	}
+
+	// Swap waits for a Read in progress, which may be stalled on the
+	// network, so the lock is only taken after it
+	if err := pcm.Swap(decoder, decoder.Length()); err != nil {
+		stream.Close()
+		fail(err)
+		return
+	}
+	ym.mu.Lock()
+	defer ym.mu.Unlock()
+	if ctx.Err() != nil {
+		// The track was closed meanwhile and pcm is no longer played
+		stream.Close()
+		return
+	}
+	ym.stream.Close()
+	ym.stream = stream
+	ym.decoder = decoder
+}
+
+// streamOnly hides the Seek of a stream from the mp3 decoder, which would
+// otherwise read the whole stream before decoding the first frame.
+type streamOnly struct {
+	io.Reader
+}
+
+// pcmDuration converts a number of decoded bytes into playing time.
+// Assumes the lock is held and the decoder is set.
+func (ym *StreamPlayer) pcmDuration(n int64) time.Duration {
+	samples := n / int64(ym.bytesPerSample()) / int64(ym.numChannels)
+	return time.Duration(samples) * time.Second / time.Duration(ym.decoder.SampleRate())
+}
+
+// bytesPerSample returns the size of one sample of one channel.
+func (ym *StreamPlayer) bytesPerSample() int {
 	switch ym.format {
 	case oto.FormatSignedInt16LE:
-		bytesPerSample = 2 // 16-bit signed int (2 bytes)
+		return 2 // 16-bit signed int (2 bytes)
 	case oto.FormatFloat32LE:
-		bytesPerSample = 4 // 32-bit float (4 bytes)
+		return 4 // 32-bit float (4 bytes)
 	case oto.FormatUnsignedInt8:
-		bytesPerSample = 1 // 8-bit unsigned int (1 byte)
+		return 1 // 8-bit unsigned int (1 byte)
 	default:
 		// Handle other formats if needed, or default to 2 bytes
-		bytesPerSample = 2 // Fallback to 16-bit signed int
+		return 2 // Fallback to 16-bit signed int
 	}
-	samples := ym.decoder.Length() / int64(bytesPerSample) / int64(ym.numChannels)
-	return time.Duration(samples) * time.Second / time.Duration(ym.decoder.SampleRate())
 }
 
 // PlayerError represents an error related to player state.
@@ -356,13 +536,3 @@ type PlayerError struct {
 func (e *PlayerError) Error() string {
 	return e.s
 }
-
-// HTTPError represents an error during the HTTP request.
-type HTTPError struct {
-	StatusCode int
-	Status     string
-}
-
-func (e *HTTPError) Error() string {
-	return "HTTP Error: " + e.Status
-}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testMP3 returns n silent MPEG-1 Layer III frames, 128 kbit/s at 44.1 kHz,
+// each 1152 samples long.
+func testMP3(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	return bytes.Repeat(frame, n)
+}
+
+// countingTransport counts the requests made and the response body bytes
+// read through it.
+type countingTransport struct {
+	mu       sync.Mutex
+	requests int
+	ranges   []string // Range header of each request
+	read     atomic.Int64
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests++
+	c.ranges = append(c.ranges, req.Header.Get("Range"))
+	c.mu.Unlock()
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, n: &c.read}
+	return resp, nil
+}
+
+func (c *countingTransport) counts() (requests int, ranges []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests, append([]string(nil), c.ranges...)
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// waitSeekable waits for the background indexing of ym's track to finish.
+func waitSeekable(t *testing.T, ym *StreamPlayer) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for ym.Length() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Track never became seekable")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestOpenURLStreams tests that playback starts after the first frames
+// rather than after the whole file, that the seekable decoder is built
+// meanwhile without holding anything up, and that seeking then works
+func TestOpenURLStreams(t *testing.T) {
+	audio := testMP3(2000) // About 52 seconds, 834 kB
+	// Only the first request, the playing stream, is served right away;
+	// the others wait until release is closed
+	release := make(chan struct{})
+	var served atomic.Int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served.Add(1) > 1 {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		http.ServeContent(w, r, "track.mp3", time.Time{}, bytes.NewReader(audio))
+	}))
+	defer cdn.Close()
+
+	transport := &countingTransport{}
+	ym := &StreamPlayer{
+		client:      &http.Client{Transport: transport},
+		events:      make(chan Event, eventBuffer),
+		sampleRate:  defaultSampleRate,
+		numChannels: defaultNumChannels,
+		format:      defaultAudioFormat,
+	}
+	defer ym.Close()
+
+	if err := ym.OpenURL(cdn.URL, nil); err != nil {
+		t.Fatalf("OpenURL failed: %v", err)
+	}
+	if read := transport.read.Load(); read > 16<<10 {
+		t.Fatalf("Expected a few frames before playback, got %d bytes", read)
+	}
+	buf := make([]byte, 4096)
+	if _, err := io.ReadFull(ym.pcm, buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if ym.Length() != 0 {
+		t.Errorf("Expected the length to be unknown while streaming, got %v", ym.Length())
+	}
+	// Seeking before the index is ready answers at once
+	if err := ym.Seek(30 * time.Second); !errors.Is(err, errSeekNotReady) {
+		t.Errorf("Expected errSeekNotReady, got %v", err)
+	}
+
+	close(release)
+	waitSeekable(t, ym)
+	if length := ym.Length(); length < 52*time.Second || length > 53*time.Second {
+		t.Errorf("Expected the length to be known once indexed, got %v", length)
+	}
+	// Playback goes on where it was
+	if pos := ym.Position(); pos != ym.pcmDuration(int64(len(buf))) {
+		t.Errorf("Expected the position to be kept, got %v", pos)
+	}
+	if _, err := io.ReadFull(ym.pcm, buf); err != nil {
+		t.Fatalf("Read after indexing failed: %v", err)
+	}
+
+	if err := ym.Seek(30 * time.Second); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if pos := ym.Position(); pos < 29*time.Second || pos > 31*time.Second {
+		t.Errorf("Expected position 0:30 after seeking, got %v", pos)
+	}
+	if _, err := io.ReadFull(ym.pcm, buf); err != nil {
+		t.Fatalf("Read after Seek failed: %v", err)
+	}
+	// Indexing reads the file once; playback goes on from the seek position
+	requests, ranges := transport.counts()
+	if read := transport.read.Load(); read > int64(len(audio))+64<<10 {
+		t.Errorf("Expected the file to be read once to index it, read %d of %d bytes", read, len(audio))
+	}
+	if last := ranges[len(ranges)-1]; last == "" {
+		t.Errorf("Expected playback to resume with a Range request, got %q", ranges)
+	}
+
+	// Further seeks use the index
+	if err := ym.Seek(10 * time.Second); err != nil {
+		t.Fatalf("Second Seek failed: %v", err)
+	}
+	if _, err := io.ReadFull(ym.pcm, buf); err != nil {
+		t.Fatalf("Read after the second Seek failed: %v", err)
+	}
+	if more, _ := transport.counts(); more != requests+1 {
+		t.Errorf("Expected one more Range request for the second seek, got %d", more-requests)
+	}
+}
+
+// TestStopCancelsIndexing tests that closing a track aborts building its
+// seekable decoder
+func TestStopCancelsIndexing(t *testing.T) {
+	audio := testMP3(200)
+	aborted := make(chan struct{})
+	var served atomic.Int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served.Add(1) > 1 {
+			<-r.Context().Done()
+			close(aborted)
+			return
+		}
+		http.ServeContent(w, r, "track.mp3", time.Time{}, bytes.NewReader(audio))
+	}))
+	defer cdn.Close()
+
+	ym := &StreamPlayer{client: cdn.Client(), events: make(chan Event, eventBuffer)}
+	if err := ym.OpenURL(cdn.URL, nil); err != nil {
+		t.Fatalf("OpenURL failed: %v", err)
+	}
+	for served.Load() < 2 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := ym.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the index download to be aborted")
+	}
+}
@@ -3,60 +3,240 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
-	"go_yandex_music/internal/common"
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/id3"
+	"go_yandex_music/internal/naming"
+	"go_yandex_music/internal/upstream"
 	"pkg.botr.me/yamusic"
 )
 
+// RepeatMode says what happens when a track finishes.
+type RepeatMode int
+
+const (
+	RepeatOff RepeatMode = iota // Play on through the results and stop at the end
+	RepeatAll                   // Start over from the first result after the last
+	RepeatOne                   // Play the same track again
+)
+
+func (r RepeatMode) String() string {
+	switch r {
+	case RepeatAll:
+		return "all"
+	case RepeatOne:
+		return "one"
+	}
+	return "off"
+}
+
+// ParseRepeatMode parses "off", "all" or "one".
+func ParseRepeatMode(s string) (RepeatMode, error) {
+	for _, r := range []RepeatMode{RepeatOff, RepeatAll, RepeatOne} {
+		if s == r.String() {
+			return r, nil
+		}
+	}
+	return RepeatOff, fmt.Errorf("unknown repeat mode %q, expected off, all or one", s)
+}
+
+// audioPlayer is the part of StreamPlayer that MusicPlayer uses, so tests
+// can play tracks without an audio device.
+type audioPlayer interface {
+	PlayAnotherURL(url string, refresh upstream.RefreshFunc) error
+	Events() <-chan Event
+	IsPlaying() bool
+	IsPaused() bool
+	Pause()
+	Resume()
+	Position() time.Duration
+	Length() time.Duration
+	Seek(offset time.Duration) error
+	Stop() error
+	Close() error
+}
+
 // struct for yandex music player
 
 type MusicPlayer struct {
-	player  *StreamPlayer
-	client  *yamusic.Client
-	Results []common.YandexMusicTrack
+	player  audioPlayer
+	catalog catalog.Catalog
+	client  *http.Client
+	dislike *catalog.Dislikes // Hides disliked tracks from search results
+	Results []catalog.Track
+	Albums  []catalog.Album  // Last album search or artist discography
+	Artists []catalog.Artist // Last artist search
 	ctx     context.Context
 	idx     int
+	query   string        // Last search query, for loading further pages
+	pager   catalog.Pager // Paging state of the last search
+	radio   radioState    // Station being played, see radio.go
+	repeat  RepeatMode
+	queue   Queue // Tracks to play before the results continue
+
+	current   *catalog.Track // Track playing, from the results or the queue
+	fromQueue bool           // current was taken from the queue
+
+	stopLyrics context.CancelFunc // Stops following synced lyrics, see lyrics.go
+
+	names *naming.Template // Names downloaded files, see download.go
 }
 
-// NewPlayer creates a new MusicPlayer instance
-func NewPlayer(ctx context.Context, uid int, token string) (*MusicPlayer, error) {
-	player, err := NewStreamPlayer(nil)
+// NewPlayer creates a new MusicPlayer instance. names is the template for
+// downloaded file names.
+func NewPlayer(ctx context.Context, uid int, token string, names *naming.Template) (*MusicPlayer, error) {
+	// The API, the CDN and the player's stream share one resilient client
+	httpClient := upstream.NewClient(upstream.DefaultConfig())
+	player, err := NewStreamPlayer(&Config{HTTPClient: httpClient})
 	if err != nil {
 		return nil, err
 	}
-	client := yamusic.NewClient(yamusic.AccessToken(uid, token))
-	return &MusicPlayer{player: player, client: client, ctx: ctx, Results: []common.YandexMusicTrack{}, idx: 0}, nil
+	client := yamusic.NewClient(yamusic.HTTPClient(httpClient), yamusic.AccessToken(uid, token))
+	yandex := catalog.NewYandex(client, httpClient, uid)
+	return &MusicPlayer{player: player, catalog: yandex, client: httpClient, dislike: catalog.NewDislikes(yandex), ctx: ctx, Results: []catalog.Track{}, idx: 0, names: names}, nil
 }
 
-// SearchTracks searches for tracks using the Yandex Music API
-func (m *MusicPlayer) SearchTracks(query string) ([]common.YandexMusicTrack, error) {
-	s, resp, err := m.client.Search().Tracks(m.ctx, query, &yamusic.SearchOptions{Page: 0, NoCorrect: false})
+// SearchTracks searches for tracks using the Yandex Music API and replaces
+// the results with the given page (0-based)
+func (m *MusicPlayer) SearchTracks(query string, page int) ([]catalog.Track, error) {
+	res, err := m.catalog.Search(m.ctx, query, catalog.SearchOptions{Type: catalog.SearchTrack, Page: page})
 	if err != nil {
-		return []common.YandexMusicTrack{}, err
+		return []catalog.Track{}, err
 	}
-	if resp.StatusCode != 200 {
-		return []common.YandexMusicTrack{}, fmt.Errorf("error: %s", resp.Status)
+	m.stopRadio()
+	m.Results = m.dislike.Filter(m.ctx, res.Tracks)
+	m.idx = 0
+	m.query = query
+	m.pager = res.Pagers[catalog.SearchTrack]
+	return m.Results, nil
+}
+
+// HasMoreResults reports whether the last search has another page
+func (m *MusicPlayer) HasMoreResults() bool {
+	return m.query != "" && m.pager.HasMore()
+}
+
+// TotalResults returns the number of tracks the last search matched
+func (m *MusicPlayer) TotalResults() int {
+	return m.pager.Total
+}
+
+// MoreResults fetches the next page of the last search and appends it to
+// the results, keeping the current track. It returns the new tracks.
+func (m *MusicPlayer) MoreResults() ([]catalog.Track, error) {
+	if !m.HasMoreResults() {
+		return nil, fmt.Errorf("no more results")
+	}
+	res, err := m.catalog.Search(m.ctx, m.query, catalog.SearchOptions{Type: catalog.SearchTrack, Page: m.pager.Page + 1})
+	if err != nil {
+		return nil, err
+	}
+	tracks := m.dislike.Filter(m.ctx, res.Tracks)
+	m.Results = append(m.Results, tracks...)
+	m.pager = res.Pagers[catalog.SearchTrack]
+	return tracks, nil
+}
+
+// Playlists returns the account's playlists, liked tracks first
+func (m *MusicPlayer) Playlists() ([]catalog.Playlist, error) {
+	return m.catalog.UserPlaylists(m.ctx)
+}
+
+// LoadPlaylist replaces the results with a playlist's tracks. owner 0 is
+// the account itself.
+func (m *MusicPlayer) LoadPlaylist(owner, kind int) (*catalog.Playlist, error) {
+	p, err := m.catalog.Playlist(m.ctx, owner, kind)
+	if err != nil {
+		return nil, err
 	}
-	results := s.Result.Tracks.Results
-	r := make([]common.YandexMusicTrack, len(results))
-	for i, result := range results {
-		r[i] = common.YandexMusicTrack(result)
+	if len(p.Tracks) == 0 {
+		return nil, fmt.Errorf("playlist %q is empty", p.Title)
 	}
-	m.Results = r
+	m.stopRadio()
+	m.Results = p.Tracks
 	m.idx = 0
-	return r, nil
+	m.query = ""
+	m.pager = catalog.Pager{}
+	return p, nil
+}
+
+// AddToPlaylist appends the current track to one of the account's playlists
+func (m *MusicPlayer) AddToPlaylist(kind int) (*catalog.Playlist, error) {
+	track, ok := m.CurrentTrack()
+	if !ok {
+		return nil, fmt.Errorf("no track to add")
+	}
+	p, err := m.catalog.Playlist(m.ctx, 0, kind)
+	if err != nil {
+		return nil, err
+	}
+	op := catalog.InsertOp(len(p.Tracks), track.Ref())
+	return m.catalog.ChangePlaylist(m.ctx, kind, p.Revision, []catalog.PlaylistOp{op})
+}
+
+// Like likes or unlikes the current track, its album or its first artist.
+// kind is one of the catalog.Like* constants. It returns the item's name.
+func (m *MusicPlayer) Like(kind string, like bool) (string, error) {
+	track, ok := m.CurrentTrack()
+	if !ok {
+		return "", fmt.Errorf("nothing is playing")
+	}
+	id, name := track.ID, track.FullTitle()
+	switch kind {
+	case catalog.LikeAlbum:
+		if len(track.Albums) == 0 {
+			return "", fmt.Errorf("the track has no album")
+		}
+		id, name = track.Albums[0].ID, track.Albums[0].Title
+	case catalog.LikeArtist:
+		if len(track.Artists) == 0 {
+			return "", fmt.Errorf("the track has no artist")
+		}
+		id, name = track.Artists[0].ID, track.Artists[0].Name
+	}
+	var err error
+	if like {
+		err = m.catalog.Like(m.ctx, kind, id)
+	} else {
+		err = m.catalog.Unlike(m.ctx, kind, id)
+	}
+	if err == nil && like && kind == catalog.LikeTrack {
+		m.dislike.Set(id, false)
+	}
+	return name, err
+}
+
+// Dislike dislikes the current track so it no longer shows up in results
+func (m *MusicPlayer) Dislike() (string, error) {
+	track, ok := m.CurrentTrack()
+	if !ok {
+		return "", fmt.Errorf("nothing is playing")
+	}
+	if err := m.catalog.Dislike(m.ctx, track.ID); err != nil {
+		return "", err
+	}
+	m.dislike.Set(track.ID, true)
+	return track.FullTitle(), nil
 }
 
 // PlayTrack plays a track using the Yandex Music API
 // receives the track ID as a parameter
 func (m *MusicPlayer) PlayTrack(trackID int, resetIndex bool) error {
-	url, err := m.client.Tracks().GetDownloadURL(m.ctx, trackID)
+	url, err := m.catalog.DownloadURL(m.ctx, trackID)
 	if err != nil {
 		return err
 	}
-	err = m.player.PlayAnotherURL(url)
+	m.StopLyrics()
+	m.radioTrackEnded()
+	// CDN links expire; seeking later in the track may need a new one
+	refresh := func(ctx context.Context) (string, error) {
+		return m.catalog.DownloadURL(ctx, trackID)
+	}
+	err = m.player.PlayAnotherURL(url, refresh)
 	if err != nil {
 		return err
 	}
@@ -67,35 +247,134 @@ func (m *MusicPlayer) PlayTrack(trackID int, resetIndex bool) error {
 }
 
 // PlayIndex plays a track at the given index in the search results
+// (0-based)
 func (m *MusicPlayer) PlayIndex(index int) error {
 	if index < 0 || index >= len(m.Results) {
 		return fmt.Errorf("index out of range")
 	}
+	track := m.Results[index]
+	if !track.Available {
+		return fmt.Errorf("%s is not available", track.FullTitle())
+	}
 	m.idx = index
-	return m.PlayTrack(m.Results[index].ID, false)
+	if err := m.PlayTrack(track.ID, false); err != nil {
+		return err
+	}
+	m.current, m.fromQueue = &track, false
+	m.radioTrackStarted(track)
+	return nil
+}
+
+// playQueued plays a track from the queue, or one no longer in the
+// results. The results stay where they were, so they continue once the
+// queue is empty.
+func (m *MusicPlayer) playQueued(track catalog.Track) error {
+	if err := m.PlayTrack(track.ID, false); err != nil {
+		return err
+	}
+	m.current, m.fromQueue = &track, true
+	return nil
 }
 
-// PlayNext plays the next track in the search results
+// PlayNext plays the next track of the queue or, when the queue is empty,
+// of the search results, loading the next page of results when the
+// current one is exhausted. On a station the results are topped up with
+// the station's next batch.
 func (m *MusicPlayer) PlayNext() error {
-	if m.idx+1 >= len(m.Results) {
-		return fmt.Errorf("no more tracks")
+	if track, ok := m.queue.Pop(); ok {
+		return m.playQueued(track)
 	}
-	m.idx++
-	return m.PlayIndex(m.idx)
+	if err := m.refillRadio(); err != nil {
+		return err
+	}
+	// Unavailable results are skipped
+	for next := m.idx + 1; ; next++ {
+		if next >= len(m.Results) && m.HasMoreResults() {
+			if _, err := m.MoreResults(); err != nil {
+				return err
+			}
+		}
+		if next >= len(m.Results) {
+			return fmt.Errorf("no more tracks")
+		}
+		if m.Results[next].Available {
+			return m.PlayIndex(next)
+		}
+	}
+}
+
+// HasNext reports whether PlayNext has a track to go to
+func (m *MusicPlayer) HasNext() bool {
+	return m.queue.Len() > 0 || m.radio.station != "" || m.idx+1 < len(m.Results) || m.HasMoreResults()
+}
+
+// Advance moves on after the current track finished, following the repeat
+// mode. It reports whether something is playing; at the end of the
+// results with repeat off playback stops.
+func (m *MusicPlayer) Advance() (bool, error) {
+	switch {
+	case m.repeat == RepeatOne && m.current != nil:
+		return true, m.replay()
+	case m.HasNext():
+		return true, m.PlayNext()
+	case m.repeat == RepeatAll && len(m.Results) > 0:
+		return true, m.PlayFirst()
+	}
+	return false, nil
+}
+
+// replay plays the current track again. The results may have been
+// replaced since it started, so it is not looked up there; playback goes
+// on from where it would have.
+func (m *MusicPlayer) replay() error {
+	track := *m.current
+	if m.fromQueue {
+		return m.playQueued(track)
+	}
+	if err := m.PlayTrack(track.ID, false); err != nil {
+		return err
+	}
+	m.radioTrackStarted(track)
+	return nil
+}
+
+// Repeat returns the repeat mode
+func (m *MusicPlayer) Repeat() RepeatMode {
+	return m.repeat
+}
+
+// SetRepeat sets what happens when a track finishes
+func (m *MusicPlayer) SetRepeat(r RepeatMode) {
+	m.repeat = r
+}
+
+// Events returns the playback events of the stream player
+func (m *MusicPlayer) Events() <-chan Event {
+	return m.player.Events()
 }
 
-// PlayPrevious plays the previous track in the search results
+// PlayPrevious plays the previous track in the search results. After a
+// queued track it goes back to the result that played before it.
 func (m *MusicPlayer) PlayPrevious() error {
-	if m.idx-1 < 0 {
-		return fmt.Errorf("no more tracks")
+	if m.fromQueue && m.idx >= 0 && m.idx < len(m.Results) {
+		return m.PlayIndex(m.idx)
 	}
-	m.idx--
-	return m.PlayIndex(m.idx)
+	for prev := m.idx - 1; prev >= 0; prev-- {
+		if m.Results[prev].Available {
+			return m.PlayIndex(prev)
+		}
+	}
+	return fmt.Errorf("no more tracks")
 }
 
-// PlayFirst plays the first track in the search results
+// PlayFirst plays the first available track in the search results
 func (m *MusicPlayer) PlayFirst() error {
-	return m.PlayIndex(0)
+	for i, track := range m.Results {
+		if track.Available {
+			return m.PlayIndex(i)
+		}
+	}
+	return fmt.Errorf("none of the tracks is available")
 }
 
 // PlayLast plays the last track in the search results
@@ -123,73 +402,108 @@ func (m *MusicPlayer) Resume() {
 	m.player.Resume()
 }
 
+// Position returns how far into the current track playback is
+func (m *MusicPlayer) Position() time.Duration {
+	return m.player.Position()
+}
+
+// Length returns the length of the current track. Until the stream knows
+// it, that is the length the catalog gives.
+func (m *MusicPlayer) Length() time.Duration {
+	if d := m.player.Length(); d > 0 {
+		return d
+	}
+	if track, ok := m.CurrentTrack(); ok {
+		return time.Duration(track.DurationMs) * time.Millisecond
+	}
+	return 0
+}
+
+// Seek moves playback of the current track to offset
+func (m *MusicPlayer) Seek(offset time.Duration) error {
+	return m.player.Seek(offset)
+}
+
+// SeekBy moves playback forward, or back for a negative delta
+func (m *MusicPlayer) SeekBy(delta time.Duration) error {
+	return m.player.Seek(max(m.player.Position()+delta, 0))
+}
+
 // Stop stops the current track
 func (m *MusicPlayer) Stop() {
+	m.radioTrackEnded()
 	m.player.Stop()
 }
 
 // Close closes the player
 func (m *MusicPlayer) Close() {
+	m.StopLyrics()
 	m.player.Close()
 }
 
+// CurrentTrack returns the current track, if there is one
+func (m *MusicPlayer) CurrentTrack() (catalog.Track, bool) {
+	if m.current == nil {
+		return catalog.Track{}, false
+	}
+	return *m.current, true
+}
+
 // GetCurrentTrack returns the current track info, like title and artist
 func (m *MusicPlayer) GetCurrentTrack() (string, string) {
-	if m.idx < 0 || m.idx >= len(m.Results) {
+	track, ok := m.CurrentTrack()
+	if !ok {
 		return "", ""
 	}
-	track := m.Results[m.idx]
-	//return track.Title, track.Artists
-	artists := ""
-	for i, artist := range track.Artists {
-		if i == len(track.Artists)-1 {
-			artists += artist.Name
-		} else {
-			artists += artist.Name + ", "
-		}
-	}
-	return track.Title, artists
+	return track.Title, catalog.ArtistNames(track.Artists)
 }
 
-// DownloadTrack downloads the current track
+// DownloadTrack downloads the current track, tagged with its metadata
 func (m *MusicPlayer) DownloadTrack(dir string) error {
-	if m.idx < 0 || m.idx >= len(m.Results) {
+	track, ok := m.CurrentTrack()
+	if !ok {
 		return fmt.Errorf("no track to download")
 	}
-	track := m.Results[m.idx]
-	url, err := m.client.Tracks().GetDownloadURL(m.ctx, track.ID)
+	url, err := m.catalog.DownloadURL(m.ctx, track.ID)
 	if err != nil {
 		return err
 	}
-	title, artists := m.GetCurrentTrack()
-	filename := dir + title + " (" + artists + ").mp3"
-	return m.DownloadFile(filename, url)
+	filename := filepath.Join(dir, m.trackPath(track))
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return m.DownloadFile(filename, url, m.trackTag(track))
 
 }
 
-// DownloadFile downloads a file from the given URL and saves it to the given filename
-// uses m.client.Do(...)
-func (m *MusicPlayer) DownloadFile(filename string, url string) error {
-	req, err := m.client.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-	resp, err := m.client.Do(m.ctx, req, nil)
-	if err != nil {
-		return err
+// trackTag builds the ID3 tag for a track. Cover art is best effort: if it
+// can't be fetched the file is tagged without it.
+func (m *MusicPlayer) trackTag(track catalog.Track) *id3.Tag {
+	artists := make([]string, len(track.Artists))
+	for i, artist := range track.Artists {
+		artists[i] = artist.Name
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("error: %s", resp.Status)
+	tag := &id3.Tag{Title: track.FullTitle(), Artists: artists}
+	if len(track.Albums) == 0 {
+		return tag
 	}
-	out, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
+	album := track.Albums[0]
+	tag.Album = album.Title
+	tag.AlbumArtist = catalog.ArtistNames(album.Artists)
+	tag.Track = album.Position.Index
+	tag.Disc = album.Position.Volume
+	tag.Year = album.Year
+	tag.Genre = album.Genre
+	if album.CoverURI != "" {
+		if cover, err := id3.FetchCover(m.ctx, m.client, catalog.CoverURL(album.CoverURI, "400x400")); err == nil {
+			tag.Cover = cover
+		}
 	}
-	return nil
+	return tag
+}
+
+// DownloadFile downloads a file from the given URL and saves it to the given filename.
+// If tag is not nil it is written in front of the audio.
+func (m *MusicPlayer) DownloadFile(filename string, url string, tag *id3.Tag) error {
+	return m.fetchFile(filename, url, tag, nil)
 }
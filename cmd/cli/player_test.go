@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// TestRepeatOneAfterNewResults tests that repeat one replays the playing
+// track after the results it came from were replaced
+func TestRepeatOneAfterNewResults(t *testing.T) {
+	m := newTestPlayer(3)
+	if err := m.PlayIndex(1); err != nil {
+		t.Fatalf("PlayIndex failed: %v", err)
+	}
+	m.SetRepeat(RepeatOne)
+	// As a new search does
+	m.openResults([]catalog.Track{testTrack(7), testTrack(8), testTrack(9)})
+
+	for i := 0; i < 2; i++ {
+		if playing, err := m.Advance(); !playing || err != nil {
+			t.Fatalf("Advance = %v, %v", playing, err)
+		}
+		if track, _ := m.CurrentTrack(); track.ID != 2 {
+			t.Fatalf("Expected track 2 to repeat, got %d", track.ID)
+		}
+	}
+	audio := m.player.(*fakeAudio)
+	if last := audio.played[len(audio.played)-1]; last != "https://cdn.example/2.mp3" {
+		t.Errorf("Expected track 2 to be played again, got %s", last)
+	}
+
+	// With repeat off the new results go on from the start
+	m.SetRepeat(RepeatOff)
+	if _, err := m.Advance(); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	if track, _ := m.CurrentTrack(); track.ID != 7 {
+		t.Errorf("Expected the first new result, got %d", track.ID)
+	}
+}
+
+// TestRadioFeedbackPlayedTime tests that station feedback reports the
+// player's position, not the time since the track started
+func TestRadioFeedbackPlayedTime(t *testing.T) {
+	m := newTestPlayer(0)
+	for id := 1; id <= 3; id++ {
+		track := testTrack(id)
+		track.DurationMs = 180_000
+		m.Results = append(m.Results, track)
+	}
+	m.radio = radioState{station: "user:onyourwave"}
+	audio := m.player.(*fakeAudio)
+
+	if err := m.PlayIndex(0); err != nil {
+		t.Fatalf("PlayIndex failed: %v", err)
+	}
+	audio.position = 179 * time.Second
+	if err := m.PlayNext(); err != nil {
+		t.Fatalf("PlayNext failed: %v", err)
+	}
+	audio.position = 30 * time.Second
+	m.Stop()
+
+	var got []catalog.Feedback
+	for _, fb := range m.catalog.(*catalog.Fake).Feedback["user:onyourwave"] {
+		if fb.Type != catalog.FeedbackTrackStarted {
+			got = append(got, catalog.Feedback{Type: fb.Type, Track: fb.Track, PlayedSeconds: fb.PlayedSeconds})
+		}
+	}
+	want := []catalog.Feedback{
+		{Type: catalog.FeedbackTrackFinished, Track: m.Results[0].Ref(), PlayedSeconds: 179},
+		{Type: catalog.FeedbackSkip, Track: m.Results[1].Ref(), PlayedSeconds: 30},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected feedback %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// Queue holds tracks picked to play next. Queued tracks play before the
+// results continue, and the queue is kept when the results are replaced by
+// a search, playlist or station. Positions are 0-based.
+type Queue struct {
+	entries  []queueEntry
+	shuffled bool
+	next     int // Order of the next appended entry
+	first    int // Order of the entry inserted to play next last
+}
+
+// queueEntry is a queued track. order is its place in the unshuffled queue.
+type queueEntry struct {
+	track catalog.Track
+	order int
+}
+
+// Len returns the number of queued tracks
+func (q *Queue) Len() int {
+	return len(q.entries)
+}
+
+// Tracks returns the queued tracks in playing order
+func (q *Queue) Tracks() []catalog.Track {
+	tracks := make([]catalog.Track, len(q.entries))
+	for i, e := range q.entries {
+		tracks[i] = e.track
+	}
+	return tracks
+}
+
+// Shuffled reports whether the queue is shuffled
+func (q *Queue) Shuffled() bool {
+	return q.shuffled
+}
+
+// Add appends tracks to the end of the queue
+func (q *Queue) Add(tracks ...catalog.Track) {
+	for _, t := range tracks {
+		q.entries = append(q.entries, queueEntry{track: t, order: q.next})
+		q.next++
+	}
+}
+
+// InsertNext puts tracks in front of the queue, in the given order
+func (q *Queue) InsertNext(tracks ...catalog.Track) {
+	entries := make([]queueEntry, len(tracks))
+	for i, t := range tracks {
+		entries[i] = queueEntry{track: t, order: q.first - len(tracks) + i}
+	}
+	q.first -= len(tracks)
+	q.entries = append(entries, q.entries...)
+}
+
+// Pop removes and returns the track to play next
+func (q *Queue) Pop() (catalog.Track, bool) {
+	if len(q.entries) == 0 {
+		return catalog.Track{}, false
+	}
+	e := q.entries[0]
+	q.entries = q.entries[1:]
+	return e.track, true
+}
+
+// Remove removes the track at position i
+func (q *Queue) Remove(i int) (catalog.Track, error) {
+	if i < 0 || i >= len(q.entries) {
+		return catalog.Track{}, fmt.Errorf("no track at position %d of the queue", i+1)
+	}
+	e := q.entries[i]
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+	return e.track, nil
+}
+
+// Move moves the track at position from to position to. Unless the queue
+// is shuffled, that becomes the order Unshuffle returns to.
+func (q *Queue) Move(from, to int) error {
+	if from < 0 || from >= len(q.entries) || to < 0 || to >= len(q.entries) {
+		return fmt.Errorf("positions must be between 1 and %d", len(q.entries))
+	}
+	e := q.entries[from]
+	q.entries = append(q.entries[:from], q.entries[from+1:]...)
+	q.entries = append(q.entries[:to], append([]queueEntry{e}, q.entries[to:]...)...)
+	if !q.shuffled {
+		q.renumber()
+	}
+	return nil
+}
+
+// Clear empties the queue
+func (q *Queue) Clear() {
+	*q = Queue{}
+}
+
+// Shuffle puts the queue in random order. Tracks added afterwards are
+// queued as usual.
+func (q *Queue) Shuffle() {
+	rand.Shuffle(len(q.entries), func(i, j int) {
+		q.entries[i], q.entries[j] = q.entries[j], q.entries[i]
+	})
+	q.shuffled = true
+}
+
+// Unshuffle restores the order the tracks had before Shuffle
+func (q *Queue) Unshuffle() {
+	sort.SliceStable(q.entries, func(i, j int) bool { return q.entries[i].order < q.entries[j].order })
+	q.shuffled = false
+}
+
+// renumber makes the current order the unshuffled one.
+func (q *Queue) renumber() {
+	for i := range q.entries {
+		q.entries[i].order = i
+	}
+	q.first, q.next = 0, len(q.entries)
+}
+
+// Queue returns the play queue
+func (m *MusicPlayer) Queue() *Queue {
+	return &m.queue
+}
+
+// QueueResult queues search result i (0-based), at the end or, with next
+// set, to play next.
+func (m *MusicPlayer) QueueResult(i int, next bool) (catalog.Track, error) {
+	if i < 0 || i >= len(m.Results) {
+		return catalog.Track{}, fmt.Errorf("no result number %d", i+1)
+	}
+	if !m.Results[i].Available {
+		return catalog.Track{}, fmt.Errorf("%s is not available", m.Results[i].FullTitle())
+	}
+	m.enqueue([]catalog.Track{m.Results[i]}, next)
+	return m.Results[i], nil
+}
+
+// QueueCurrent queues the track playing now, e.g. to hear it again
+func (m *MusicPlayer) QueueCurrent(next bool) (catalog.Track, error) {
+	track, ok := m.CurrentTrack()
+	if !ok {
+		return catalog.Track{}, fmt.Errorf("nothing is playing")
+	}
+	m.enqueue([]catalog.Track{track}, next)
+	return track, nil
+}
+
+// QueueAlbum queues an album's playable tracks in album order
+func (m *MusicPlayer) QueueAlbum(id int, next bool) (*catalog.Album, int, error) {
+	album, err := m.catalog.AlbumWithTracks(m.ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	var tracks []catalog.Track
+	for _, volume := range album.Volumes {
+		tracks = append(tracks, volume...)
+	}
+	return album, m.enqueue(tracks, next), nil
+}
+
+// QueuePlaylist queues a playlist's playable tracks. owner 0 is the
+// account itself.
+func (m *MusicPlayer) QueuePlaylist(owner, kind int, next bool) (*catalog.Playlist, int, error) {
+	p, err := m.catalog.Playlist(m.ctx, owner, kind)
+	if err != nil {
+		return nil, 0, err
+	}
+	return p, m.enqueue(p.Tracks, next), nil
+}
+
+// enqueue queues the available tracks and returns how many there were.
+func (m *MusicPlayer) enqueue(tracks []catalog.Track, next bool) int {
+	playable := make([]catalog.Track, 0, len(tracks))
+	for _, t := range tracks {
+		if t.Available {
+			playable = append(playable, t)
+		}
+	}
+	if next {
+		m.queue.InsertNext(playable...)
+	} else {
+		m.queue.Add(playable...)
+	}
+	return len(playable)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/upstream"
+)
+
+// fakeAudio is an audioPlayer that records what it was asked to play
+type fakeAudio struct {
+	played   []string
+	position time.Duration
+}
+
+func (a *fakeAudio) PlayAnotherURL(url string, refresh upstream.RefreshFunc) error {
+	a.played = append(a.played, url)
+	return nil
+}
+
+func (a *fakeAudio) Events() <-chan Event            { return nil }
+func (a *fakeAudio) IsPlaying() bool                 { return len(a.played) > 0 }
+func (a *fakeAudio) IsPaused() bool                  { return false }
+func (a *fakeAudio) Pause()                          {}
+func (a *fakeAudio) Resume()                         {}
+func (a *fakeAudio) Position() time.Duration         { return a.position }
+func (a *fakeAudio) Length() time.Duration           { return 0 }
+func (a *fakeAudio) Seek(offset time.Duration) error { return nil }
+func (a *fakeAudio) Stop() error                     { return nil }
+func (a *fakeAudio) Close() error                    { return nil }
+
+// newTestPlayer returns a player whose results are tracks 1 to n. Tracks
+// 1 to 99 have download URLs, so tracks above n can be queued.
+func newTestPlayer(n int) *MusicPlayer {
+	fake := catalog.NewFake()
+	for id := 1; id < 100; id++ {
+		fake.DownloadURLs[id] = fmt.Sprintf("https://cdn.example/%d.mp3", id)
+	}
+	m := &MusicPlayer{
+		player:  &fakeAudio{},
+		catalog: fake,
+		dislike: catalog.NewDislikes(fake),
+		ctx:     context.Background(),
+	}
+	for id := 1; id <= n; id++ {
+		m.Results = append(m.Results, testTrack(id))
+	}
+	return m
+}
+
+func testTrack(id int) catalog.Track {
+	return catalog.Track{ID: id, Title: fmt.Sprintf("Track %d", id), Available: true}
+}
+
+func trackIDs(tracks []catalog.Track) []int {
+	ids := []int{}
+	for _, t := range tracks {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+// TestQueue tests adding, inserting, removing and moving queue entries
+func TestQueue(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(q *Queue)
+		want []int
+	}{
+		{"add", func(q *Queue) { q.Add(testTrack(1), testTrack(2)) }, []int{1, 2}},
+		{"next", func(q *Queue) {
+			q.Add(testTrack(1))
+			q.InsertNext(testTrack(2), testTrack(3))
+		}, []int{2, 3, 1}},
+		{"next twice", func(q *Queue) {
+			q.InsertNext(testTrack(1))
+			q.InsertNext(testTrack(2))
+		}, []int{2, 1}},
+		{"pop", func(q *Queue) {
+			q.Add(testTrack(1), testTrack(2))
+			q.Pop()
+		}, []int{2}},
+		{"pop empty", func(q *Queue) { q.Pop() }, []int{}},
+		{"remove", func(q *Queue) {
+			q.Add(testTrack(1), testTrack(2), testTrack(3))
+			q.Remove(1)
+		}, []int{1, 3}},
+		{"remove out of range", func(q *Queue) {
+			q.Add(testTrack(1))
+			q.Remove(1)
+		}, []int{1}},
+		{"move", func(q *Queue) {
+			q.Add(testTrack(1), testTrack(2), testTrack(3))
+			q.Move(2, 0)
+		}, []int{3, 1, 2}},
+		{"clear", func(q *Queue) {
+			q.Add(testTrack(1), testTrack(2))
+			q.Clear()
+		}, []int{}},
+		{"add after clear", func(q *Queue) {
+			q.Add(testTrack(1))
+			q.Clear()
+			q.Add(testTrack(2))
+		}, []int{2}},
+		{"unshuffle", func(q *Queue) {
+			q.Add(testTrack(1), testTrack(2))
+			q.InsertNext(testTrack(3))
+			q.Shuffle()
+			q.Add(testTrack(4))
+			q.Unshuffle()
+		}, []int{3, 1, 2, 4}},
+		{"unshuffle after move", func(q *Queue) {
+			q.Add(testTrack(1), testTrack(2), testTrack(3))
+			q.Move(0, 2)
+			q.Shuffle()
+			q.Unshuffle()
+		}, []int{2, 3, 1}},
+	}
+	for _, tt := range tests {
+		var q Queue
+		tt.ops(&q)
+		if got := trackIDs(q.Tracks()); !reflect.DeepEqual(got, tt.want) || q.Len() != len(tt.want) {
+			t.Errorf("%s: queue is %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestQueueOrder tests that queued tracks play before the results go on
+// and how that combines with the repeat modes
+func TestQueueOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		repeat RepeatMode
+		setup  func(m *MusicPlayer)
+		want   []int // Tracks played by the Advance calls after result 1
+	}{
+		{"queue first", RepeatOff, func(m *MusicPlayer) {
+			m.Queue().Add(testTrack(10), testTrack(11))
+		}, []int{10, 11, 2, 3}},
+		{"next before added", RepeatOff, func(m *MusicPlayer) {
+			m.Queue().Add(testTrack(10))
+			m.QueueResult(2, true)
+		}, []int{3, 10, 2, 3}},
+		{"cleared", RepeatOff, func(m *MusicPlayer) {
+			m.Queue().Add(testTrack(10))
+			m.Queue().Clear()
+		}, []int{2, 3}},
+		{"repeat all after queue", RepeatAll, func(m *MusicPlayer) {
+			m.Queue().Add(testTrack(10))
+		}, []int{10, 2, 3, 1}},
+		{"repeat one queued", RepeatOne, func(m *MusicPlayer) {
+			m.Queue().Add(testTrack(10))
+			m.PlayNext()
+		}, []int{10, 10}},
+		{"repeat one keeps queue", RepeatOne, func(m *MusicPlayer) {
+			m.Queue().Add(testTrack(10))
+		}, []int{1, 1}},
+	}
+	for _, tt := range tests {
+		m := newTestPlayer(3)
+		if err := m.PlayIndex(0); err != nil {
+			t.Fatalf("%s: PlayIndex failed: %v", tt.name, err)
+		}
+		tt.setup(m)
+		m.SetRepeat(tt.repeat)
+		var got []int
+		for range tt.want {
+			playing, err := m.Advance()
+			if err != nil || !playing {
+				t.Fatalf("%s: Advance = %v, %v after %v", tt.name, playing, err, got)
+			}
+			track, _ := m.CurrentTrack()
+			got = append(got, track.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: played %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestQueueEnd tests that playback stops after the queue and the last
+// result with repeat off
+func TestQueueEnd(t *testing.T) {
+	m := newTestPlayer(1)
+	if err := m.PlayIndex(0); err != nil {
+		t.Fatalf("PlayIndex failed: %v", err)
+	}
+	m.Queue().Add(testTrack(10))
+	if playing, err := m.Advance(); !playing || err != nil {
+		t.Fatalf("Expected the queued track to play, got %v, %v", playing, err)
+	}
+	if playing, err := m.Advance(); playing || err != nil {
+		t.Errorf("Expected playback to stop, got %v, %v", playing, err)
+	}
+	audio := m.player.(*fakeAudio)
+	if len(audio.played) != 2 || audio.played[1] != "https://cdn.example/10.mp3" {
+		t.Errorf("Unexpected tracks played: %v", audio.played)
+	}
+}
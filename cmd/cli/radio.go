@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// radioRefill is how many queued tracks are left when the next batch of a
+// station is loaded.
+const radioRefill = 2
+
+// radioState is the station being played, if any.
+type radioState struct {
+	station string
+	batchID string
+	playing *catalog.Track // Track whose trackStarted was sent
+}
+
+// Stations lists the radio stations, My Wave first
+func (m *MusicPlayer) Stations() ([]catalog.Station, error) {
+	return m.catalog.Stations(m.ctx)
+}
+
+// StartRadio replaces the results with a station's tracks and plays the
+// first one. Further batches are loaded as playback advances.
+func (m *MusicPlayer) StartRadio(station string) error {
+	if !catalog.ValidStation(station) {
+		return fmt.Errorf("invalid station %q, expected e.g. genre:rock or artist:123", station)
+	}
+	m.stopRadio()
+	batch, err := m.catalog.StationTracks(m.ctx, station, 0)
+	if err != nil {
+		return err
+	}
+	tracks := m.dislike.Filter(m.ctx, batch.Tracks)
+	if len(tracks) == 0 {
+		return fmt.Errorf("station %s has no tracks", station)
+	}
+	m.radio = radioState{station: station, batchID: batch.BatchID}
+	m.feedback(catalog.Feedback{Type: catalog.FeedbackRadioStarted})
+	m.Results = tracks
+	m.idx = 0
+	m.query = ""
+	m.pager = catalog.Pager{}
+	return m.PlayIndex(0)
+}
+
+// Station returns the station being played, or "" outside radio mode
+func (m *MusicPlayer) Station() string {
+	return m.radio.station
+}
+
+// refillRadio appends the next batch of the station when the queue is
+// about to run out.
+func (m *MusicPlayer) refillRadio() error {
+	if m.radio.station == "" || m.idx+radioRefill < len(m.Results) {
+		return nil
+	}
+	last := 0
+	if len(m.Results) > 0 {
+		last = m.Results[len(m.Results)-1].ID
+	}
+	batch, err := m.catalog.StationTracks(m.ctx, m.radio.station, last)
+	if err != nil {
+		return err
+	}
+	m.radio.batchID = batch.BatchID
+	m.Results = append(m.Results, m.dislike.Filter(m.ctx, batch.Tracks)...)
+	return nil
+}
+
+// radioTrackStarted reports that a station track started playing. How the
+// previous one ended was reported before it was replaced, see PlayTrack.
+func (m *MusicPlayer) radioTrackStarted(track catalog.Track) {
+	if m.radio.station == "" {
+		return
+	}
+	m.radio.playing = &track
+	m.feedback(catalog.Feedback{Type: catalog.FeedbackTrackStarted, Track: track.Ref()})
+}
+
+// radioTrackEnded reports the playing station track as finished if it
+// played (nearly) to the end, or as skipped. The played time is the
+// player's position, so pauses and seeks don't count; it must be called
+// before the track is stopped or replaced.
+func (m *MusicPlayer) radioTrackEnded() {
+	track := m.radio.playing
+	if track == nil {
+		return
+	}
+	m.radio.playing = nil
+	played := m.player.Position().Seconds()
+	typ := catalog.FeedbackSkip
+	if played >= float64(track.DurationMs)/1000-2 {
+		typ = catalog.FeedbackTrackFinished
+	}
+	m.feedback(catalog.Feedback{Type: typ, Track: track.Ref(), PlayedSeconds: played})
+}
+
+// stopRadio leaves radio mode, reporting the playing track.
+func (m *MusicPlayer) stopRadio() {
+	m.radioTrackEnded()
+	m.radio = radioState{}
+}
+
+// feedback sends station feedback. It only tunes recommendations, so
+// failures don't interrupt playback.
+func (m *MusicPlayer) feedback(fb catalog.Feedback) {
+	fb.BatchID = m.radio.batchID
+	m.catalog.RadioFeedback(m.ctx, m.radio.station, fb)
+}
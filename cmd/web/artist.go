@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// TrackPageResponse is one page of a longer track list
+type TrackPageResponse struct {
+	Tracks   []TrackResponse `json:"tracks"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"pageSize"`
+	Total    int             `json:"total"`
+	HasMore  bool            `json:"hasMore"`
+}
+
+// ArtistPageResponse is the artist page: popular tracks, the first page of
+// all tracks, releases split by type, appearances and similar artists
+type ArtistPageResponse struct {
+	Artist        ArtistResponse    `json:"artist"`
+	PopularTracks []TrackResponse   `json:"popularTracks"`
+	Tracks        TrackPageResponse `json:"tracks"`
+	Albums        []AlbumResponse   `json:"albums"`
+	Singles       []AlbumResponse   `json:"singles"`
+	Compilations  []AlbumResponse   `json:"compilations"`
+	AppearsOn     []AlbumResponse   `json:"appearsOn"`
+	Similar       []ArtistResponse  `json:"similarArtists"`
+}
+
+func trackPageResponse(p *catalog.TrackPage) TrackPageResponse {
+	tracks := make([]TrackResponse, len(p.Tracks))
+	for i, t := range p.Tracks {
+		tracks[i] = trackResponse(t)
+	}
+	return TrackPageResponse{
+		Tracks:   tracks,
+		Page:     p.Pager.Page,
+		PageSize: p.Pager.PageSize,
+		Total:    p.Pager.Total,
+		HasMore:  p.Pager.HasMore(),
+	}
+}
+
+// handleArtist returns the artist page. Only the artist ID is required;
+// page and pageSize select the page of the full track list.
+func (ws *WebServer) handleArtist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	artistIDStr := r.URL.Query().Get("id")
+	if artistIDStr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "query parameter 'id' is required"})
+		return
+	}
+	artistID, err := strconv.Atoi(artistIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid artist ID"})
+		return
+	}
+	page, pageSize, err := parsePage(r, defaultPageSize)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	artist, hitArtist, err := ws.artistPage(ctx, artistID)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	tracks, hitTracks, err := ws.artistTracks(ctx, artistID, page, pageSize)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	setCacheHeader(w, hitArtist && hitTracks)
+
+	resp := ArtistPageResponse{
+		Artist:        artistResponse(artist.Artist),
+		PopularTracks: make([]TrackResponse, len(artist.PopularTracks)),
+		Tracks:        trackPageResponse(tracks),
+		Albums:        []AlbumResponse{},
+		Singles:       []AlbumResponse{},
+		Compilations:  []AlbumResponse{},
+		AppearsOn:     make([]AlbumResponse, len(artist.AppearsOn)),
+		Similar:       make([]ArtistResponse, len(artist.Similar)),
+	}
+	for i, t := range artist.PopularTracks {
+		resp.PopularTracks[i] = trackResponse(t)
+	}
+	for _, a := range artist.Albums {
+		switch a.Type {
+		case catalog.AlbumSingle:
+			resp.Singles = append(resp.Singles, albumResponse(a))
+		case catalog.AlbumCompilation:
+			resp.Compilations = append(resp.Compilations, albumResponse(a))
+		default:
+			resp.Albums = append(resp.Albums, albumResponse(a))
+		}
+	}
+	for i, a := range artist.AppearsOn {
+		resp.AppearsOn[i] = albumResponse(a)
+	}
+	for i, a := range artist.Similar {
+		resp.Similar[i] = artistResponse(a)
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// How long metadata responses are reused. Search results shift as the
+// catalogue is updated; album and track metadata practically never change.
+// Download URLs are not stored here: they expire, see urlCache.
+const (
+	searchCacheTTL   = 5 * time.Minute
+	albumCacheTTL    = time.Hour
+	trackCacheTTL    = time.Hour
+	artistCacheTTL   = 30 * time.Minute
+	lyricsCacheTTL   = time.Hour
+	defaultCacheSize = 1000
+)
+
+// responseCache is a TTL+LRU cache of upstream results. Concurrent lookups
+// of the same missing key share a single upstream call. Errors are never
+// cached. A nil *responseCache is valid and caches nothing.
+//
+// Cached values are shared between requests and must not be modified.
+type responseCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // front is most recently used
+	entries map[string]*list.Element
+	calls   map[string]*cacheCall
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// cacheCall is an upstream call in progress that later callers wait for.
+type cacheCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// newResponseCache returns a cache holding at most size entries, or nil
+// (caching disabled) if size is not positive.
+func newResponseCache(size int) *responseCache {
+	if size <= 0 {
+		return nil
+	}
+	return &responseCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		calls:   make(map[string]*cacheCall),
+		now:     time.Now,
+	}
+}
+
+// do returns the cached value for key, or calls fetch and stores its result
+// for ttl. hit reports whether the value came from the cache.
+func (c *responseCache) do(ctx context.Context, key string, ttl time.Duration, fetch func(context.Context) (interface{}, error)) (value interface{}, hit bool, err error) {
+	if c == nil {
+		value, err = fetch(ctx)
+		return value, false, err
+	}
+
+	for {
+		c.mu.Lock()
+		if el, ok := c.entries[key]; ok {
+			e := el.Value.(*cacheEntry)
+			if c.now().Before(e.expires) {
+				c.lru.MoveToFront(el)
+				c.mu.Unlock()
+				return e.value, true, nil
+			}
+			c.removeElement(el)
+		}
+
+		if call, ok := c.calls[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+			// The leader's client may have gone away, which cancels the
+			// shared call; that is no reason to fail this request too.
+			if isContextError(call.err) && ctx.Err() == nil {
+				continue
+			}
+			return call.value, false, call.err
+		}
+
+		call := &cacheCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mu.Unlock()
+
+		c.run(ctx, key, ttl, call, fetch)
+		return call.value, false, call.err
+	}
+}
+
+// run calls fetch for call, stores a successful result and releases the
+// callers waiting for it. If fetch panics, the waiters get an error and
+// the panic goes on once they are released, so the key is never left in
+// flight.
+func (c *responseCache) run(ctx context.Context, key string, ttl time.Duration, call *cacheCall, fetch func(context.Context) (interface{}, error)) {
+	defer func() {
+		v := recover()
+		if v != nil {
+			call.value, call.err = nil, fmt.Errorf("fetching %s panicked: %v", key, v)
+		}
+		c.mu.Lock()
+		delete(c.calls, key)
+		if call.err == nil {
+			c.add(key, call.value, ttl)
+		}
+		c.mu.Unlock()
+		close(call.done)
+		if v != nil {
+			panic(v)
+		}
+	}()
+	call.value, call.err = fetch(ctx)
+}
+
+// add stores a value and evicts the least recently used entries over the
+// size limit. c.mu must be held.
+func (c *responseCache) add(key string, value interface{}, ttl time.Duration) {
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expires: c.now().Add(ttl)})
+	for c.lru.Len() > c.size {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *responseCache) removeElement(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// cached runs fetch through ws.cache and converts the result back to T.
+func cached[T any](ctx context.Context, ws *WebServer, key string, ttl time.Duration, fetch func(context.Context) (T, error)) (T, bool, error) {
+	v, hit, err := ws.cache.do(ctx, key, ttl, func(ctx context.Context) (interface{}, error) {
+		return fetch(ctx)
+	})
+	// Keys start with the kind of response, which names the cache in metrics
+	name, _, _ := strings.Cut(key, ":")
+	ws.metrics.cacheLookup(name, hit)
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+	return v.(T), hit, nil
+}
+
+// search is catalog.Search through the response cache.
+func (ws *WebServer) search(ctx context.Context, query string, opts catalog.SearchOptions) (*catalog.SearchResult, bool, error) {
+	key := "search:" + opts.Type + ":" + strconv.Itoa(opts.Page) + ":" + strconv.Itoa(opts.PageSize) + ":" + strconv.FormatBool(opts.NoCorrect) + ":" + query
+	return cached(ctx, ws, key, searchCacheTTL, func(ctx context.Context) (*catalog.SearchResult, error) {
+		return ws.catalog.Search(ctx, query, opts)
+	})
+}
+
+// albumWithTracks is catalog.AlbumWithTracks through the response cache.
+func (ws *WebServer) albumWithTracks(ctx context.Context, id int) (*catalog.Album, bool, error) {
+	return cached(ctx, ws, "album:"+strconv.Itoa(id), albumCacheTTL, func(ctx context.Context) (*catalog.Album, error) {
+		return ws.catalog.AlbumWithTracks(ctx, id)
+	})
+}
+
+// track is catalog.Track through the response cache.
+func (ws *WebServer) track(ctx context.Context, id int) (*catalog.Track, bool, error) {
+	return cached(ctx, ws, "track:"+strconv.Itoa(id), trackCacheTTL, func(ctx context.Context) (*catalog.Track, error) {
+		return ws.catalog.Track(ctx, id)
+	})
+}
+
+// artistPage is catalog.ArtistPage through the response cache.
+func (ws *WebServer) artistPage(ctx context.Context, id int) (*catalog.ArtistPage, bool, error) {
+	return cached(ctx, ws, "artist:"+strconv.Itoa(id), artistCacheTTL, func(ctx context.Context) (*catalog.ArtistPage, error) {
+		return ws.catalog.ArtistPage(ctx, id)
+	})
+}
+
+// artistTracks is catalog.ArtistTracks through the response cache.
+func (ws *WebServer) artistTracks(ctx context.Context, id, page, pageSize int) (*catalog.TrackPage, bool, error) {
+	key := "artist-tracks:" + strconv.Itoa(id) + ":" + strconv.Itoa(page) + ":" + strconv.Itoa(pageSize)
+	return cached(ctx, ws, key, artistCacheTTL, func(ctx context.Context) (*catalog.TrackPage, error) {
+		return ws.catalog.ArtistTracks(ctx, id, page, pageSize)
+	})
+}
+
+// lyrics is catalog.Lyrics through the response cache.
+func (ws *WebServer) lyrics(ctx context.Context, trackID int) (*catalog.Lyrics, bool, error) {
+	return cached(ctx, ws, "lyrics:"+strconv.Itoa(trackID), lyricsCacheTTL, func(ctx context.Context) (*catalog.Lyrics, error) {
+		return ws.catalog.Lyrics(ctx, trackID)
+	})
+}
+
+// setCacheHeader reports through X-Cache whether the response was served
+// from the cache.
+func setCacheHeader(w http.ResponseWriter, hit bool) {
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/id3"
+	"go_yandex_music/internal/naming"
+)
+
+// coverSize is the resolution requested for cover art embedded into tags.
+const coverSize = "400x400"
+
+// Naming templates used unless DOWNLOAD_NAME_TEMPLATE or ZIP_NAME_TEMPLATE
+// is set, see internal/naming
+var (
+	defaultDownloadTemplate = naming.MustParse("{title} - {artist}")
+	defaultZipTemplate      = naming.MustParse("{track}. {artist} - {title}")
+)
+
+// albumTag builds the ID3 tag for the track at album.Volumes[vol][idx].
+func albumTag(album *catalog.Album, vol, idx int) *id3.Tag {
+	t := album.Volumes[vol][idx]
+	artists := make([]string, len(t.Artists))
+	for i, artist := range t.Artists {
+		artists[i] = artist.Name
+	}
+	return &id3.Tag{
+		Title:       t.FullTitle(),
+		Artists:     artists,
+		Album:       album.Title,
+		AlbumArtist: catalog.ArtistNames(album.Artists),
+		Track:       idx + 1,
+		TrackTotal:  len(album.Volumes[vol]),
+		Disc:        vol + 1,
+		DiscTotal:   len(album.Volumes),
+		Year:        album.Year,
+		Genre:       album.Genre,
+	}
+}
+
+// fetchCover downloads cover art for embedding. Tagging is best effort, so
+// failures are logged and nil is returned.
+func (ws *WebServer) fetchCover(ctx context.Context, uri string) *id3.Picture {
+	if uri == "" {
+		return nil
+	}
+	pic, err := id3.FetchCover(ctx, ws.client, catalog.CoverURL(uri, coverSize))
+	if err != nil {
+		logger(ctx).Warn("failed to fetch cover", "cover", uri, "error", err)
+		return nil
+	}
+	return pic
+}
+
+// handleDownload streams a single track as an attachment with ID3 tags.
+func (ws *WebServer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	trackIDStr := r.URL.Query().Get("id")
+	if trackIDStr == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "query parameter 'id' is required"})
+		return
+	}
+
+	trackID, err := strconv.Atoi(trackIDStr)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid track ID"})
+		return
+	}
+
+	// Metadata lookups get a short deadline; the transfer itself may take longer
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	t, err := ws.catalog.Track(ctx, trackID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeUpstreamError(w, err)
+		return
+	}
+
+	artists := make([]string, len(t.Artists))
+	for i, a := range t.Artists {
+		artists[i] = a.Name
+	}
+
+	// Prefer the album listing for the tag: it carries the track's position,
+	// year and genre. Fall back to what the track itself knows.
+	tag := &id3.Tag{Title: t.FullTitle(), Artists: artists}
+	fields := naming.TrackFields(*t)
+	coverURI := t.Cover()
+	if len(t.Albums) > 0 {
+		tag.Album = t.Albums[0].Title
+		album, err := ws.catalog.AlbumWithTracks(ctx, t.Albums[0].ID)
+		if err != nil {
+			logger(ctx).Warn("failed to load album for tags", "album_id", t.Albums[0].ID, "error", err)
+		} else if vol, idx, ok := album.Find(trackID); ok {
+			tag = albumTag(album, vol, idx)
+			fields = naming.AlbumFields(album, vol, idx)
+			if album.CoverURI != "" {
+				coverURI = album.CoverURI
+			}
+		}
+	}
+	tag.Cover = ws.fetchCover(ctx, coverURI)
+
+	dlURL, err := ws.catalog.DownloadURL(ctx, trackID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeUpstreamError(w, err)
+		return
+	}
+
+	dlCtx, cancelDownload := context.WithTimeout(r.Context(), downloadTimeout)
+	defer cancelDownload()
+
+	req, err := http.NewRequestWithContext(dlCtx, http.MethodGet, dlURL, nil)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+	audioResp, err := ws.httpClient().Do(req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer audioResp.Body.Close()
+	if audioResp.StatusCode != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "upstream returned " + audioResp.Status})
+		return
+	}
+
+	// An attachment has no folders, so only the last element is used
+	filename := path.Base(ws.downloadNames().Execute(fields)) + ".mp3"
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Content-Disposition", attachment(filename))
+	if _, err := id3.Copy(w, audioResp.Body, tag); err != nil {
+		logger(r.Context()).Warn("download copy failed", "file", filename, "error", err)
+	}
+}
+
+// attachment returns a Content-Disposition value offering a download named
+// filename. Quotes are escaped, and names that aren't plain ASCII, such as
+// most Russian titles, are sent as RFC 2231 filename*.
+func attachment(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+// downloadNames returns the template single downloads are named with.
+func (ws *WebServer) downloadNames() *naming.Template {
+	if ws.downloadTemplate == nil {
+		return defaultDownloadTemplate
+	}
+	return ws.downloadTemplate
+}
+
+// zipNames returns the template album archive entries are named with.
+func (ws *WebServer) zipNames() *naming.Template {
+	if ws.zipTemplate == nil {
+		return defaultZipTemplate
+	}
+	return ws.zipTemplate
+}
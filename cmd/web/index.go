@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// maxPrefixLen is the longest base path accepted from BASE_PATH or the
+// X-Forwarded-Prefix header.
+const maxPrefixLen = 256
+
+// prefixPattern is the grammar base paths must follow: "/"-separated
+// segments of unreserved URL characters. Anything else, including quotes,
+// angle brackets and percent escapes, is rejected rather than escaped.
+var prefixPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// baseElements is added after <head> in index.html. The page is parsed as
+// an html/template, see static.go, so the base path is escaped for each
+// context it ends up in: a URL attribute and a script.
+const baseElements = `<head>
+    <base href="{{.BaseHref}}">
+    <script>window.BASE_PATH = {{.BasePath}};</script>
+`
+
+// indexData is what baseElements is rendered with.
+type indexData struct {
+	BaseHref string // Base path with a trailing slash, "/" at the root
+	BasePath string // Base path without one, "" at the root
+}
+
+// cleanPrefix normalizes a base path to a leading "/" and no trailing one.
+// ok is false if it doesn't follow prefixPattern or has "." or ".."
+// segments. "" and "/" are the root, returned as "".
+func cleanPrefix(prefix string) (clean string, ok bool) {
+	if prefix == "" || prefix == "/" {
+		return "", true
+	}
+	if prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	if len(prefix) > maxPrefixLen || !prefixPattern.MatchString(prefix) {
+		return "", false
+	}
+	for _, seg := range strings.Split(prefix[1:], "/") {
+		if seg == "." || seg == ".." {
+			return "", false
+		}
+	}
+	return prefix, true
+}
+
+// parseTrustedProxies parses a comma-separated list of IP addresses and
+// CIDR ranges, e.g. "127.0.0.1, 10.0.0.0/8".
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.Contains(field, "/") {
+			p, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// fromTrustedProxy reports whether r came from a proxy whose headers are
+// honored. Without TRUSTED_PROXIES only a proxy on the same host, reaching
+// us over loopback, is trusted.
+func (ws *WebServer) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	if len(ws.trustedProxies) == 0 {
+		return addr.IsLoopback()
+	}
+	for _, p := range ws.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getBasePath returns the base path for a request
+// It checks X-Forwarded-Prefix header first (if enabled and sent by a
+// trusted proxy), then falls back to static BASE_PATH. A prefix that isn't
+// a plain path is ignored.
+func (ws *WebServer) getBasePath(r *http.Request) string {
+	if ws.useProxyHeaders && ws.fromTrustedProxy(r) {
+		if header := r.Header.Get("X-Forwarded-Prefix"); header != "" {
+			if prefix, ok := cleanPrefix(header); ok {
+				return prefix
+			}
+			logger(r.Context()).Warn("ignoring invalid X-Forwarded-Prefix", "prefix", header, "remote_addr", r.RemoteAddr)
+		}
+	}
+
+	// Fall back to static base path from env var
+	return ws.basePath
+}
+
+// handleIndex serves the index.html with base path injected
+func (ws *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	site, err := ws.staticFiles().load()
+	if err != nil {
+		logger(r.Context()).Error("failed to load index.html", "error", err)
+		http.Error(w, "Failed to load index.html", http.StatusInternalServerError)
+		return
+	}
+
+	// Get dynamic base path (supports X-Forwarded-Prefix header)
+	basePath := ws.getBasePath(r)
+	data := indexData{BaseHref: basePath + "/", BasePath: basePath}
+
+	var buf bytes.Buffer
+	if err := site.index.Execute(&buf, data); err != nil {
+		logger(r.Context()).Error("failed to render index.html", "error", err)
+		http.Error(w, "Failed to render index.html", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The page names the current asset URLs, so it must not go stale
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(buf.Bytes())
+}
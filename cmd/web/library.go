@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// LikeRequest is the body of the like, unlike, dislike and undislike
+// endpoints. Type is track, album or artist; dislikes only apply to tracks.
+type LikeRequest struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+// LikeResponse is the library state of an item after a change
+type LikeResponse struct {
+	Type     string `json:"type"`
+	ID       int    `json:"id"`
+	Liked    bool   `json:"liked"`
+	Disliked bool   `json:"disliked"`
+}
+
+// handleLibrary lists liked tracks, albums and artists. type narrows the
+// list to one of them.
+func (ws *WebServer) handleLibrary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	likeType := r.URL.Query().Get("type")
+	if likeType != "" && !catalog.ValidLikeKind(likeType) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid type, must be one of track, album, artist"})
+		return
+	}
+	want := func(t string) bool { return likeType == "" || likeType == t }
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	resp := SearchResponse{Tracks: []TrackResponse{}, Albums: []AlbumResponse{}, Artists: []ArtistResponse{}}
+	if want(catalog.LikeTrack) {
+		tracks, err := ws.catalog.LikedTracks(ctx)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		for _, t := range tracks {
+			resp.Tracks = append(resp.Tracks, trackResponse(t))
+		}
+	}
+	if want(catalog.LikeAlbum) {
+		albums, err := ws.catalog.LikedAlbums(ctx)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		for _, a := range albums {
+			resp.Albums = append(resp.Albums, albumResponse(a))
+		}
+	}
+	if want(catalog.LikeArtist) {
+		artists, err := ws.catalog.LikedArtists(ctx)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		for _, a := range artists {
+			resp.Artists = append(resp.Artists, artistResponse(a))
+		}
+	}
+	resp.Total = len(resp.Tracks) + len(resp.Albums) + len(resp.Artists)
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleDisliked lists the disliked tracks
+func (ws *WebServer) handleDisliked(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	ids, err := ws.catalog.DislikedTrackIDs(ctx)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	tracks, err := ws.catalog.TracksByID(ctx, ids)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	resp := SearchResponse{Tracks: make([]TrackResponse, len(tracks)), Total: len(tracks)}
+	for i, t := range tracks {
+		resp.Tracks[i] = trackResponse(t)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleLike adds a track, album or artist to the library
+func (ws *WebServer) handleLike(w http.ResponseWriter, r *http.Request) {
+	ws.changeLibrary(w, r, true, func(ctx context.Context, req LikeRequest) (LikeResponse, error) {
+		if err := ws.catalog.Like(ctx, req.Type, req.ID); err != nil {
+			return LikeResponse{}, err
+		}
+		// A like replaces a dislike
+		if req.Type == catalog.LikeTrack {
+			ws.dislikes.Set(req.ID, false)
+		}
+		return LikeResponse{Type: req.Type, ID: req.ID, Liked: true}, nil
+	})
+}
+
+// handleUnlike removes a track, album or artist from the library
+func (ws *WebServer) handleUnlike(w http.ResponseWriter, r *http.Request) {
+	ws.changeLibrary(w, r, true, func(ctx context.Context, req LikeRequest) (LikeResponse, error) {
+		if err := ws.catalog.Unlike(ctx, req.Type, req.ID); err != nil {
+			return LikeResponse{}, err
+		}
+		return LikeResponse{Type: req.Type, ID: req.ID}, nil
+	})
+}
+
+// handleDislike dislikes a track, hiding it from search results
+func (ws *WebServer) handleDislike(w http.ResponseWriter, r *http.Request) {
+	ws.changeLibrary(w, r, false, func(ctx context.Context, req LikeRequest) (LikeResponse, error) {
+		if err := ws.catalog.Dislike(ctx, req.ID); err != nil {
+			return LikeResponse{}, err
+		}
+		ws.dislikes.Set(req.ID, true)
+		return LikeResponse{Type: catalog.LikeTrack, ID: req.ID, Disliked: true}, nil
+	})
+}
+
+// handleUndislike removes a track's dislike
+func (ws *WebServer) handleUndislike(w http.ResponseWriter, r *http.Request) {
+	ws.changeLibrary(w, r, false, func(ctx context.Context, req LikeRequest) (LikeResponse, error) {
+		if err := ws.catalog.Undislike(ctx, req.ID); err != nil {
+			return LikeResponse{}, err
+		}
+		ws.dislikes.Set(req.ID, false)
+		return LikeResponse{Type: catalog.LikeTrack, ID: req.ID}, nil
+	})
+}
+
+// changeLibrary decodes and validates a LikeRequest and runs change with
+// it. Without anyType, only tracks are accepted and type may be omitted.
+func (ws *WebServer) changeLibrary(w http.ResponseWriter, r *http.Request, anyType bool, change func(context.Context, LikeRequest) (LikeResponse, error)) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req LikeRequest
+	if !decodeJSONRequest(w, r, &req) {
+		return
+	}
+	if !anyType && req.Type == "" {
+		req.Type = catalog.LikeTrack
+	}
+	switch {
+	case req.ID <= 0:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "id is required"})
+		return
+	case anyType && !catalog.ValidLikeKind(req.Type):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid type, must be one of track, album, artist"})
+		return
+	case !anyType && req.Type != catalog.LikeTrack:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "only tracks can be disliked"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	resp, err := change(ctx, req)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
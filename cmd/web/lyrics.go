@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// LyricsResponse is a track's lyrics. Lines is only present when the
+// lyrics are synced.
+type LyricsResponse struct {
+	TrackID int                 `json:"trackId"`
+	Synced  bool                `json:"synced"`
+	Text    string              `json:"text"`
+	Lines   []LyricLineResponse `json:"lines,omitempty"`
+	Writers []string            `json:"writers,omitempty"`
+}
+
+// LyricLineResponse is one timed line of synced lyrics
+type LyricLineResponse struct {
+	TimeMs int64  `json:"timeMs"`
+	Text   string `json:"text"`
+}
+
+// handleLyrics returns a track's lyrics, synced when Yandex has them.
+// Tracks without lyrics get a 404 with an explanatory error.
+func (ws *WebServer) handleLyrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	trackIDStr := r.URL.Query().Get("id")
+	if trackIDStr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "query parameter 'id' is required"})
+		return
+	}
+	trackID, err := strconv.Atoi(trackIDStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid track ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	lyrics, hit, err := ws.lyrics(ctx, trackID)
+	switch {
+	case errors.Is(err, catalog.ErrNoLyrics):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "this track has no lyrics"})
+		return
+	case errors.Is(err, catalog.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "track not found"})
+		return
+	case err != nil:
+		writeUpstreamError(w, err)
+		return
+	}
+	setCacheHeader(w, hit)
+
+	resp := LyricsResponse{
+		TrackID: trackID,
+		Synced:  lyrics.Synced(),
+		Text:    lyrics.Text,
+		Writers: lyrics.Writers,
+	}
+	for _, l := range lyrics.Lines {
+		resp.Lines = append(resp.Lines, LyricLineResponse{TimeMs: l.Time.Milliseconds(), Text: l.Text})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
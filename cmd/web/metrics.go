@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/metrics"
+)
+
+// webMetrics are the server's Prometheus metrics. A nil *webMetrics is
+// valid and records nothing, which is the default unless METRICS is set.
+type webMetrics struct {
+	registry *metrics.Registry
+
+	requests        *metrics.CounterVec   // route, method, status
+	requestDuration *metrics.HistogramVec // route, method
+	upstreamLatency *metrics.HistogramVec // operation
+	upstreamErrors  *metrics.CounterVec   // operation
+	zipStreams      *metrics.CounterVec   // result
+	zipBytes        metrics.Counter
+	zipSkipped      *metrics.CounterVec // reason
+	cacheLookups    *metrics.CounterVec // cache, result
+}
+
+// Why a track was left out of an album zip, for zipSkipped.
+const (
+	skipUnavailable = "unavailable"
+	skipURL         = "download_url"
+	skipDownload    = "download"
+	skipEntry       = "zip_entry"
+	skipCopy        = "copy"
+)
+
+func newWebMetrics() *webMetrics {
+	r := metrics.NewRegistry()
+	m := &webMetrics{
+		registry: r,
+		requests: r.Counter("yamusic_http_requests_total",
+			"HTTP requests served, by route, method and status code.", "route", "method", "status"),
+		requestDuration: r.Histogram("yamusic_http_request_duration_seconds",
+			"Time to serve HTTP requests, by route and method. Streams and zips count until the last byte.", metrics.DefBuckets, "route", "method"),
+		upstreamLatency: r.Histogram("yamusic_upstream_request_duration_seconds",
+			"Latency of Yandex Music API calls, by catalog operation.", metrics.DefBuckets, "operation"),
+		upstreamErrors: r.Counter("yamusic_upstream_errors_total",
+			"Failed Yandex Music API calls, by catalog operation. Not-found answers and calls cancelled by the client are not counted.", "operation"),
+		zipStreams: r.Counter("yamusic_zip_streams_total",
+			"Album zips streamed, by result: complete, cancelled, aborted after a track failed mid-copy, or failed before the first byte.", "result"),
+		zipSkipped: r.Counter("yamusic_zip_tracks_skipped_total",
+			"Tracks left out of album zips, by reason.", "reason"),
+		cacheLookups: r.Counter("yamusic_cache_lookups_total",
+			"Response cache lookups, by cache and result (hit or miss). The hit ratio is hit / (hit + miss).", "cache", "result"),
+	}
+	m.zipBytes = r.Counter("yamusic_zip_bytes_total", "Bytes of album zips sent to clients.").With()
+	return m
+}
+
+// observeUpstream is the catalog.ObserveFunc of the server's catalog.
+func (m *webMetrics) observeUpstream(ctx context.Context, op string) (context.Context, func(error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		m.upstreamLatency.With(op).Observe(time.Since(start).Seconds())
+		if upstreamFailed(ctx, err) {
+			m.upstreamErrors.With(op).Inc()
+		}
+	}
+}
+
+// upstreamFailed tells errors of the API from answers that something
+// doesn't exist and from calls the client gave up on.
+func upstreamFailed(ctx context.Context, err error) bool {
+	return err != nil && !errors.Is(err, catalog.ErrNotFound) && !errors.Is(err, catalog.ErrNoLyrics) && ctx.Err() == nil
+}
+
+// cacheLookup records a cache hit or miss.
+func (m *webMetrics) cacheLookup(cache string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.With(cache, result).Inc()
+}
+
+// zipStream records a finished album zip and the bytes sent.
+func (m *webMetrics) zipStream(result string, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.zipStreams.With(result).Inc()
+	m.zipBytes.Add(float64(bytes))
+}
+
+// zipSkip records a track left out of an album zip.
+func (m *webMetrics) zipSkip(reason string) {
+	if m == nil {
+		return
+	}
+	m.zipSkipped.With(reason).Inc()
+}
+
+// measureRequests records the count and duration of every request by the
+// route pattern it matched, so IDs in query strings or paths don't each
+// become a series.
+func (ws *WebServer) measureRequests(next http.Handler) http.Handler {
+	if ws.metrics == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := recorder(w)
+		next.ServeHTTP(rec, r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := ws.route(r)
+		ws.metrics.requests.With(route, r.Method, strconv.Itoa(status)).Inc()
+		ws.metrics.requestDuration.With(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// route names the handler that served r: the API path, "metrics", "static"
+// for the web app, or "other" if nothing matched.
+func (ws *WebServer) route(r *http.Request) string {
+	pattern := strings.TrimPrefix(r.Pattern, ws.basePath)
+	if ws.basePath != "" && r.Pattern == ws.basePath+"/" && ws.app != nil {
+		// StripPrefix hands the app a copy of the request, so its match
+		// isn't recorded on r; look it up again
+		u := *r.URL
+		u.Path = strings.TrimPrefix(r.URL.Path, ws.basePath)
+		u.RawPath = ""
+		_, pattern = ws.app.Handler(&http.Request{Method: r.Method, Host: r.Host, URL: &u})
+	}
+	switch {
+	case strings.HasPrefix(pattern, "/api/"):
+		return pattern
+	case pattern == "/metrics":
+		return "metrics"
+	case pattern == "" && r.Pattern == "":
+		return "other"
+	}
+	return "static"
+}
+
+// countingResponseWriter counts the bytes written through it.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (cw *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Flush keeps the zip streaming.
+func (cw *countingResponseWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"go_yandex_music/internal/tracing"
+	"go_yandex_music/internal/upstream"
+)
+
+// maxRequestIDLen is the longest X-Request-ID accepted from a client.
+const maxRequestIDLen = 128
+
+// middleware wraps a handler with behavior shared by every request.
+type middleware func(http.Handler) http.Handler
+
+// chain applies mws to h, the first one outermost.
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// middleware returns the chain every request goes through: request IDs,
+// then tracing, access logs and metrics, then panic recovery.
+func (ws *WebServer) middleware(h http.Handler) http.Handler {
+	return chain(h, withRequestID, ws.traceRequests, ws.logRequests, ws.measureRequests, recoverPanics)
+}
+
+// withRequestID takes the request's X-Request-ID, or generates one if it is
+// missing or malformed. It is sent back in the response and stored in the
+// context for log entries, including those of upstream calls.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(upstream.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts IDs of printable ASCII without spaces, so they
+// can't break up a log line or a header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logger returns the logger for work done on behalf of the request ctx
+// belongs to, with its request and trace IDs.
+func logger(ctx context.Context) *slog.Logger {
+	l := slog.Default()
+	if id := upstream.RequestID(ctx); id != "" {
+		l = l.With("request_id", id)
+	}
+	if sc := tracing.SpanContextFrom(ctx); sc.IsValid() {
+		l = l.With("trace_id", sc.TraceID.String())
+	}
+	return l
+}
+
+// responseRecorder notes the status and size of a response for the access
+// log, metrics, tracing and panic recovery.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int // 0 until the header is written
+	bytes  int64
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses such as the album zip working.
+func (rec *responseRecorder) Flush() {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// recorder returns w if an outer middleware already wraps the response in
+// a responseRecorder, or wraps it.
+func recorder(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+// logRequests logs every request once it is done, as JSON when the server
+// runs.
+func (ws *WebServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := recorder(w)
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		logger(r.Context()).LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", ws.clientIP(r)),
+		)
+	})
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// believed when the request came through a trusted proxy.
+func (ws *WebServer) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ws.useProxyHeaders && ws.fromTrustedProxy(r) {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	return host
+}
+
+// recoverPanics turns a panicking handler into a logged error and, unless
+// the response has already started, a JSON 500.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				// Deliberate abort of the response; let net/http handle it
+				panic(v)
+			}
+			logger(r.Context()).Error("panic serving request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", v,
+				"stack", string(debug.Stack()),
+			)
+			if rec, ok := w.(*responseRecorder); ok && rec.status != 0 {
+				return
+			}
+			// Drop what the handler prepared for its own response
+			w.Header().Del("Content-Disposition")
+			w.Header().Del("Content-Length")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "internal server error"})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// maxJSONBody limits the size of JSON request bodies.
+const maxJSONBody = 1 << 20
+
+// PlaylistsResponse lists the account's playlists
+type PlaylistsResponse struct {
+	Playlists []PlaylistResponse `json:"playlists"`
+}
+
+// PlaylistTracksResponse is a playlist with its tracks
+type PlaylistTracksResponse struct {
+	Playlist PlaylistResponse `json:"playlist"`
+	Tracks   []TrackResponse  `json:"tracks"`
+}
+
+// CreatePlaylistRequest is the body of /api/playlists/create
+type CreatePlaylistRequest struct {
+	Title  string `json:"title"`
+	Public bool   `json:"public"`
+}
+
+// RenamePlaylistRequest is the body of /api/playlist/rename
+type RenamePlaylistRequest struct {
+	Kind  int    `json:"kind"`
+	Title string `json:"title"`
+}
+
+// PlaylistEditRequest is the body of the playlist edit endpoints. Revision
+// must be the playlist's current revision, as last returned by the API.
+//
+//   - add inserts TrackIDs before index At, or appends them if At is absent
+//   - remove deletes the tracks with indexes From up to, not including, To
+//   - move moves the track at index From to index To
+type PlaylistEditRequest struct {
+	Kind     int   `json:"kind"`
+	Revision int   `json:"revision"`
+	TrackIDs []int `json:"trackIds,omitempty"`
+	At       *int  `json:"at,omitempty"`
+	From     int   `json:"from"`
+	To       int   `json:"to"`
+}
+
+// decodeJSONRequest checks that the request is a same-origin JSON POST and
+// decodes its body into v. It writes the error response and returns false
+// on failure.
+//
+// These requests change the account, so other sites must not be able to
+// send them. Requiring application/json forces a CORS preflight, which
+// enableCORS doesn't allow for POST, and sameOrigin turns away browsers
+// that say the request comes from another site.
+func decodeJSONRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "method not allowed"})
+		return false
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Content-Type must be application/json"})
+		return false
+	}
+	if !sameOrigin(r) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "cross-origin request refused"})
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBody)).Decode(v); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// sameOrigin reports whether a request may come from the app's own pages.
+// Browsers send Sec-Fetch-Site; older ones only Origin, which must then
+// name this host. Requests without either, e.g. from curl, are not from a
+// browser page and are allowed.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// writePlaylist encodes the playlist produced by a successful edit
+func writePlaylist(w http.ResponseWriter, p *catalog.Playlist, err error) {
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(playlistResponse(*p))
+}
+
+// handlePlaylists lists the account's playlists, liked tracks first
+func (ws *WebServer) handlePlaylists(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	lists, err := ws.catalog.UserPlaylists(ctx)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	resp := PlaylistsResponse{Playlists: make([]PlaylistResponse, len(lists))}
+	for i, p := range lists {
+		resp.Playlists[i] = playlistResponse(p)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handlePlaylist returns a playlist with its tracks. kind is required; owner
+// defaults to the account.
+func (ws *WebServer) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	kind, err := strconv.Atoi(r.URL.Query().Get("kind"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "query parameter 'kind' is required"})
+		return
+	}
+	owner := 0
+	if v := r.URL.Query().Get("owner"); v != "" {
+		owner, err = strconv.Atoi(v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid owner"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	p, err := ws.catalog.Playlist(ctx, owner, kind)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	resp := PlaylistTracksResponse{
+		Playlist: playlistResponse(*p),
+		Tracks:   make([]TrackResponse, len(p.Tracks)),
+	}
+	for i, t := range p.Tracks {
+		resp.Tracks[i] = trackResponse(t)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleCreatePlaylist creates an empty playlist
+func (ws *WebServer) handleCreatePlaylist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req CreatePlaylistRequest
+	if !decodeJSONRequest(w, r, &req) {
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "title is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	p, err := ws.catalog.CreatePlaylist(ctx, req.Title, req.Public)
+	writePlaylist(w, p, err)
+}
+
+// handleRenamePlaylist changes a playlist's title
+func (ws *WebServer) handleRenamePlaylist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req RenamePlaylistRequest
+	if !decodeJSONRequest(w, r, &req) {
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Kind == 0 || req.Title == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "kind and title are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	p, err := ws.catalog.RenamePlaylist(ctx, req.Kind, req.Title)
+	writePlaylist(w, p, err)
+}
+
+// handlePlaylistAdd inserts tracks into a playlist
+func (ws *WebServer) handlePlaylistAdd(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req PlaylistEditRequest
+	if !decodeJSONRequest(w, r, &req) {
+		return
+	}
+	if req.Kind == 0 || len(req.TrackIDs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "kind and trackIds are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	// Playlists store album IDs alongside track IDs
+	refs := make([]catalog.TrackRef, len(req.TrackIDs))
+	for i, id := range req.TrackIDs {
+		track, _, err := ws.track(ctx, id)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		refs[i] = track.Ref()
+	}
+
+	at := 0
+	if req.At != nil {
+		at = *req.At
+	} else {
+		p, ok := ws.editablePlaylist(ctx, w, req)
+		if !ok {
+			return
+		}
+		at = len(p.Tracks)
+	}
+
+	p, err := ws.catalog.ChangePlaylist(ctx, req.Kind, req.Revision, []catalog.PlaylistOp{catalog.InsertOp(at, refs...)})
+	writePlaylist(w, p, err)
+}
+
+// handlePlaylistRemove deletes a range of tracks from a playlist. To
+// defaults to From+1, removing a single track.
+func (ws *WebServer) handlePlaylistRemove(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req PlaylistEditRequest
+	if !decodeJSONRequest(w, r, &req) {
+		return
+	}
+	if req.To == 0 {
+		req.To = req.From + 1
+	}
+	if req.Kind == 0 || req.From < 0 || req.To <= req.From {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "kind and a valid from/to range are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	p, err := ws.catalog.ChangePlaylist(ctx, req.Kind, req.Revision, []catalog.PlaylistOp{catalog.DeleteOp(req.From, req.To)})
+	writePlaylist(w, p, err)
+}
+
+// handlePlaylistMove moves one track within a playlist
+func (ws *WebServer) handlePlaylistMove(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req PlaylistEditRequest
+	if !decodeJSONRequest(w, r, &req) {
+		return
+	}
+	if req.Kind == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "kind is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	// The diff re-inserts the moved track, so it has to be looked up
+	p, ok := ws.editablePlaylist(ctx, w, req)
+	if !ok {
+		return
+	}
+	ops, err := catalog.MoveOps(p, req.From, req.To)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	p, err = ws.catalog.ChangePlaylist(ctx, req.Kind, req.Revision, ops)
+	writePlaylist(w, p, err)
+}
+
+// editablePlaylist fetches one of the account's playlists with its tracks and
+// checks it is still at the revision the edit is based on.
+func (ws *WebServer) editablePlaylist(ctx context.Context, w http.ResponseWriter, req PlaylistEditRequest) (*catalog.Playlist, bool) {
+	p, err := ws.catalog.Playlist(ctx, 0, req.Kind)
+	if err == nil && p.Revision != req.Revision {
+		err = catalog.ErrWrongRevision
+	}
+	if err != nil {
+		writeUpstreamError(w, err)
+		return nil, false
+	}
+	return p, true
+}
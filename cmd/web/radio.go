@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// StationResponse represents a radio station in API responses
+type StationResponse struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	IconURL string `json:"iconUrl,omitempty"`
+}
+
+// StationsResponse lists the radio stations
+type StationsResponse struct {
+	Stations []StationResponse `json:"stations"`
+}
+
+// StationBatchResponse is the next batch of a station's tracks
+type StationBatchResponse struct {
+	Station string          `json:"station"`
+	BatchID string          `json:"batchId"`
+	Tracks  []TrackResponse `json:"tracks"`
+}
+
+// RadioFeedbackRequest is the body of /api/radio/feedback. TrackID is
+// required for every type but radioStarted; AlbumID is looked up if absent.
+type RadioFeedbackRequest struct {
+	Station       string  `json:"station"`
+	BatchID       string  `json:"batchId"`
+	Type          string  `json:"type"`
+	TrackID       int     `json:"trackId"`
+	AlbumID       int     `json:"albumId"`
+	PlayedSeconds float64 `json:"playedSeconds"`
+}
+
+// handleRadioStations lists the radio stations, My Wave first
+func (ws *WebServer) handleRadioStations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	stations, err := ws.catalog.Stations(ctx)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	resp := StationsResponse{Stations: make([]StationResponse, len(stations))}
+	for i, s := range stations {
+		resp.Stations[i] = StationResponse{ID: s.ID, Name: s.Name, Type: s.Type(), IconURL: catalog.CoverURL(s.IconURI, "200x200")}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleRadioTracks returns the next batch of a station's tracks, without
+// disliked ones. last is the ID of the track played last, if any.
+func (ws *WebServer) handleRadioTracks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	station := r.URL.Query().Get("station")
+	if !catalog.ValidStation(station) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "query parameter 'station' must be a station ID like genre:rock"})
+		return
+	}
+	lastTrackID := 0
+	if v := r.URL.Query().Get("last"); v != "" {
+		var err error
+		lastTrackID, err = strconv.Atoi(v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid last track ID"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	batch, err := ws.catalog.StationTracks(ctx, station, lastTrackID)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	tracks := ws.dislikes.Filter(ctx, batch.Tracks)
+	resp := StationBatchResponse{Station: batch.Station, BatchID: batch.BatchID, Tracks: make([]TrackResponse, len(tracks))}
+	for i, t := range tracks {
+		resp.Tracks[i] = trackResponse(t)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleRadioFeedback passes a playback event on to the station
+func (ws *WebServer) handleRadioFeedback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req RadioFeedbackRequest
+	if !decodeJSONRequest(w, r, &req) {
+		return
+	}
+	if !catalog.ValidStation(req.Station) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid station"})
+		return
+	}
+	switch req.Type {
+	case catalog.FeedbackRadioStarted:
+	case catalog.FeedbackTrackStarted, catalog.FeedbackTrackFinished, catalog.FeedbackSkip:
+		if req.TrackID <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "trackId is required"})
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid type, must be one of radioStarted, trackStarted, trackFinished, skip"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	ref := catalog.TrackRef{ID: req.TrackID, AlbumID: req.AlbumID}
+	if ref.ID != 0 && ref.AlbumID == 0 {
+		track, _, err := ws.track(ctx, ref.ID)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		ref = track.Ref()
+	}
+	fb := catalog.Feedback{Type: req.Type, BatchID: req.BatchID, Track: ref, PlayedSeconds: req.PlayedSeconds}
+	if err := ws.catalog.RadioFeedback(ctx, req.Station, fb); err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"go_yandex_music/static"
+)
+
+const (
+	// hashLen is how many hex digits of a file's SHA-256 go into its URL
+	hashLen = 10
+
+	// immutableCacheControl is sent for content-hashed URLs, whose content
+	// never changes
+	immutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+// staticFiles serves the web app from a file system. index.html and sw.js
+// are templates, rendered by handleIndex and ServeHTTP. Every other file is
+// also served under a content-hashed name such as css/styles.3f2a1b9c0d.css
+// with a long-lived Cache-Control header; index.html refers to them through
+// {{asset "css/styles.css"}}. The plain names keep working but are
+// revalidated on every use.
+type staticFiles struct {
+	fsys    fs.FS
+	live    bool   // Reload the files on every request, for -static-dir
+	version string // Build version; "" uses a digest of the files
+
+	mu   sync.Mutex
+	site *staticSite // Loaded files; reloaded every time if live
+}
+
+// staticSite is the loaded, hashed and parsed content of a staticFiles.
+type staticSite struct {
+	byName   map[string]*staticAsset
+	byHashed map[string]*staticAsset
+	index    *template.Template
+	sw       []byte // Rendered sw.js
+	version  string
+}
+
+type staticAsset struct {
+	name   string
+	hashed string
+	etag   string
+}
+
+// swData is what sw.js is rendered with; the values are JSON.
+type swData struct {
+	Version string
+	Assets  string
+}
+
+// embeddedStatic is the web app compiled into the binary.
+var embeddedStatic = sync.OnceValue(func() *staticFiles {
+	return &staticFiles{fsys: static.FS, version: buildVersion()}
+})
+
+// staticFiles returns the files the web app is served from.
+func (ws *WebServer) staticFiles() *staticFiles {
+	if ws.static == nil {
+		return embeddedStatic()
+	}
+	return ws.static
+}
+
+// load returns the files, reading them on first use or, if live, on every
+// call.
+func (s *staticFiles) load() (*staticSite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.site != nil && !s.live {
+		return s.site, nil
+	}
+	site, err := loadStaticSite(s.fsys, s.version, s.live)
+	if err != nil {
+		return nil, err
+	}
+	s.site = site
+	return site, nil
+}
+
+// loadStaticSite hashes the files of fsys and parses its templates. The
+// digest of all files is the version when none is given or the files may
+// change.
+func loadStaticSite(fsys fs.FS, version string, live bool) (*staticSite, error) {
+	site := &staticSite{byName: make(map[string]*staticAsset), byHashed: make(map[string]*staticAsset)}
+	digest := sha256.New()
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) == ".go" {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])[:hashLen]
+		fmt.Fprintf(digest, "%s %s\n", name, hash)
+		if name == "index.html" || name == "sw.js" {
+			return nil
+		}
+		ext := path.Ext(name)
+		a := &staticAsset{name: name, hashed: strings.TrimSuffix(name, ext) + "." + hash + ext, etag: `"` + hash + `"`}
+		site.byName[a.name] = a
+		site.byHashed[a.hashed] = a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	site.version = version
+	if version == "" || live {
+		site.version = hex.EncodeToString(digest.Sum(nil))[:hashLen]
+	}
+
+	indexContent, err := fs.ReadFile(fsys, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	// Only the page itself and baseElements are template source; the base
+	// path is data
+	src := strings.Replace(string(indexContent), "<head>\n", baseElements, 1)
+	site.index, err = template.New("index.html").Funcs(template.FuncMap{"asset": site.asset}).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	// Render once so a missing asset shows up now rather than per request
+	if err := site.index.Execute(io.Discard, indexData{BaseHref: "/"}); err != nil {
+		return nil, err
+	}
+
+	swContent, err := fs.ReadFile(fsys, "sw.js")
+	if err != nil {
+		return nil, err
+	}
+	sw, err := texttemplate.New("sw.js").Parse(string(swContent))
+	if err != nil {
+		return nil, err
+	}
+	var assets []string
+	for _, a := range site.byName {
+		assets = append(assets, a.hashed)
+	}
+	sort.Strings(assets)
+	versionJSON, _ := json.Marshal(site.version)
+	assetsJSON, _ := json.Marshal(assets)
+	var buf bytes.Buffer
+	if err := sw.Execute(&buf, swData{Version: string(versionJSON), Assets: string(assetsJSON)}); err != nil {
+		return nil, err
+	}
+	site.sw = buf.Bytes()
+	return site, nil
+}
+
+// asset returns the content-hashed URL of a file, relative to the base
+// path. It is the "asset" function of index.html.
+func (site *staticSite) asset(name string) (string, error) {
+	a, ok := site.byName[name]
+	if !ok {
+		return "", fmt.Errorf("asset %q not found", name)
+	}
+	return a.hashed, nil
+}
+
+// ServeHTTP serves sw.js and the assets; requests for the page itself go to
+// handleIndex. Anything else, including directories, is not found.
+func (s *staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site, err := s.load()
+	if err != nil {
+		logger(r.Context()).Error("failed to load static files", "error", err)
+		http.Error(w, "Failed to load static files", http.StatusInternalServerError)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "sw.js" {
+		// Browsers look for service worker updates at the same URL
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(site.sw)
+		return
+	}
+	a, ok := site.byHashed[name]
+	if ok {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+	} else if a, ok = site.byName[name]; ok {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", a.etag)
+	http.ServeFileFS(w, r, s.fsys, a.name)
+}
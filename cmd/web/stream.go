@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// downloadURLTTL is how long a Yandex download URL is reused before a fresh
+// one is requested. The CDN links expire after roughly a minute, so this
+// stays well below that.
+const downloadURLTTL = 45 * time.Second
+
+// streamHeaders are the upstream response headers passed through to the
+// browser so the audio element can seek and validate partial content.
+var streamHeaders = []string{
+	"Content-Length",
+	"Content-Range",
+	"Accept-Ranges",
+	"ETag",
+	"Last-Modified",
+}
+
+// urlCache keeps recently issued download URLs per track so a burst of
+// Range requests from the audio element doesn't hit the API every time.
+// A nil *urlCache is valid and caches nothing.
+type urlCache struct {
+	mu      sync.Mutex
+	entries map[int]cachedURL
+}
+
+type cachedURL struct {
+	url     string
+	expires time.Time
+}
+
+func newURLCache() *urlCache {
+	return &urlCache{entries: make(map[int]cachedURL)}
+}
+
+func (c *urlCache) get(trackID int) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[trackID]
+	if !ok || time.Now().After(e.expires) {
+		delete(c.entries, trackID)
+		return "", false
+	}
+	return e.url, true
+}
+
+func (c *urlCache) set(trackID int, url string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[trackID] = cachedURL{url: url, expires: time.Now().Add(downloadURLTTL)}
+}
+
+func (c *urlCache) invalidate(trackID int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, trackID)
+}
+
+// streamURL returns a download URL for the track, reusing a recent one
+// unless refresh is set.
+func (ws *WebServer) streamURL(ctx context.Context, trackID int, refresh bool) (string, error) {
+	if !refresh {
+		url, ok := ws.streamURLs.get(trackID)
+		ws.metrics.cacheLookup("stream-url", ok)
+		if ok {
+			return url, nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, downloadURLTimeout)
+	defer cancel()
+	url, err := ws.catalog.DownloadURL(ctx, trackID)
+	if err != nil {
+		return "", err
+	}
+	ws.streamURLs.set(trackID, url)
+	return url, nil
+}
+
+// handleStream proxies track audio through the server so the browser never
+// holds a CDN link that can expire. Range and If-Range are forwarded, so the
+// audio element can seek and resume.
+func (ws *WebServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "method not allowed"})
+		return
+	}
+
+	trackIDStr := r.URL.Query().Get("id")
+	if trackIDStr == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "query parameter 'id' is required"})
+		return
+	}
+
+	trackID, err := strconv.Atoi(trackIDStr)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid track ID"})
+		return
+	}
+
+	// A cached URL may have expired on the CDN side; in that case get a
+	// fresh one and try exactly once more.
+	for attempt := 0; attempt < 2; attempt++ {
+		url, err := ws.streamURL(r.Context(), trackID, attempt > 0)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			writeUpstreamError(w, err)
+			return
+		}
+
+		expired, err := ws.proxyAudio(w, r, url)
+		if expired {
+			logger(r.Context()).Info("download URL expired, refreshing", "track_id", trackID)
+			ws.streamURLs.invalidate(trackID)
+			continue
+		}
+		if err != nil {
+			logger(r.Context()).Warn("stream failed", "track_id", trackID, "error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: "download URL rejected by CDN"})
+}
+
+// proxyAudio fetches upstreamURL with the client's Range/If-Range headers and
+// copies the response to w. If the CDN rejects the URL as stale it writes
+// nothing and reports expired, so the caller can retry with a fresh URL.
+func (ws *WebServer) proxyAudio(w http.ResponseWriter, r *http.Request, upstreamURL string) (expired bool, err error) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, upstreamURL, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, h := range []string{"Range", "If-Range"} {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+
+	resp, err := ws.httpClient().Do(req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return true, nil
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified,
+		http.StatusPreconditionFailed, http.StatusRequestedRangeNotSatisfiable:
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "upstream returned " + resp.Status})
+		return false, fmt.Errorf("upstream returned %s", resp.Status)
+	}
+
+	for _, h := range streamHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	// The CDN sometimes labels MP3s as application/octet-stream, which some
+	// browsers refuse to play.
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = "audio/mpeg"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if w.Header().Get("Accept-Ranges") == "" {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	if r.Method == http.MethodHead {
+		return false, nil
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return false, fmt.Errorf("copy: %w", err)
+	}
+	return false, nil
+}
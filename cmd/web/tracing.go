@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/tracing"
+	"go_yandex_music/internal/upstream"
+)
+
+// defaultServiceName is the service.name of exported spans unless
+// OTEL_SERVICE_NAME is set.
+const defaultServiceName = "yamusic-web"
+
+// newTracer returns the tracer configured by the standard OpenTelemetry
+// environment variables, or nil if tracing is off:
+//
+//   - OTEL_TRACES_EXPORTER: "otlp", "console" (or "stdout"), or "none"
+//   - OTEL_EXPORTER_OTLP_TRACES_ENDPOINT: full URL of the collector's
+//     traces endpoint, or OTEL_EXPORTER_OTLP_ENDPOINT: its base URL
+//   - OTEL_SERVICE_NAME
+func newTracer() (*tracing.Tracer, error) {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = defaultServiceName
+	}
+	switch exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "", "none":
+		return nil, nil
+	case "console", "stdout":
+		return tracing.NewTracer(tracing.NewStdoutExporter(os.Stdout, service)), nil
+	case "otlp":
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+		if endpoint == "" {
+			endpoint = tracing.DefaultOTLPEndpoint
+			if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+				endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+			}
+		}
+		return tracing.NewTracer(tracing.NewOTLPExporter(endpoint, service)), nil
+	default:
+		return nil, fmt.Errorf("invalid OTEL_TRACES_EXPORTER %q: expected otlp, console or none", exporter)
+	}
+}
+
+// traceCatalog returns a catalog.ObserveFunc giving every catalog call a
+// span, so the upstream requests it makes are grouped under it.
+func traceCatalog(t *tracing.Tracer) catalog.ObserveFunc {
+	return func(ctx context.Context, op string) (context.Context, func(error)) {
+		ctx, span := t.Start(ctx, "catalog."+op, tracing.KindInternal)
+		return ctx, func(err error) {
+			if upstreamFailed(ctx, err) {
+				span.SetError(err)
+			}
+			span.End()
+		}
+	}
+}
+
+// traceRequests gives every request a server span, continuing the trace
+// of an incoming traceparent header. The span is named after the route
+// once the request has been routed.
+func (ws *WebServer) traceRequests(next http.Handler) http.Handler {
+	if ws.tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := tracing.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, parent)
+		}
+		ctx, span := ws.tracer.Start(ctx, r.Method, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("request_id", upstream.RequestID(ctx)),
+		)
+		defer span.End()
+
+		rec := recorder(w)
+		r = r.WithContext(ctx)
+		next.ServeHTTP(rec, r)
+
+		route := ws.route(r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetName(r.Method + " " + route)
+		span.SetAttrs(tracing.String("http.route", route), tracing.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+		}
+	})
+}
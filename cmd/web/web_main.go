@@ -3,14 +3,48 @@ package main
 import (
 	"flag"
 	"log"
+	"runtime/debug"
 )
 
+// version is set at build time with -ldflags "-X main.version=...", as
+// GoReleaser does.
+var version string
+
 func main() {
 	port := flag.String("port", "8080", "Port to run the web server on")
+	staticDir := flag.String("static-dir", "", "Serve the web app from this directory instead of the embedded files, for development")
 	flag.Parse()
 
-	err := StartWebServer(*port)
+	err := StartWebServer(*port, *staticDir)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// buildVersion identifies the build: version if set, else the VCS revision
+// Go stamped into the binary. It is "" for builds from a modified tree,
+// whose files are then told apart by their digest.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				return ""
+			}
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	return revision
+}
@@ -4,13 +4,26 @@ import (
 	"archive/zip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/id3"
+	"go_yandex_music/internal/naming"
+	"go_yandex_music/internal/tracing"
+	"go_yandex_music/internal/upstream"
 
 	"github.com/joho/godotenv"
 	"pkg.botr.me/yamusic"
@@ -18,10 +31,21 @@ import (
 
 // WebServer handles HTTP requests for the web interface
 type WebServer struct {
-	client          *yamusic.Client
-	ctx             context.Context
-	basePath        string // Static base path from env var (fallback)
-	useProxyHeaders bool   // Whether to check X-Forwarded-Prefix header
+	catalog          catalog.Catalog
+	basePath         string         // Static base path from env var (fallback)
+	useProxyHeaders  bool           // Whether to check X-Forwarded-Prefix header
+	trustedProxies   []netip.Prefix // Peers whose proxy headers are honored; empty trusts loopback only
+	static           *staticFiles   // Web app files; nil means the embedded ones
+	streamURLs       *urlCache
+	cache            *responseCache    // Metadata cache; nil disables caching
+	client           *http.Client      // Upstream client for the API and CDN; nil means http.DefaultClient
+	dislikes         *catalog.Dislikes // Hides disliked tracks from results; nil disables filtering
+	metrics          *webMetrics       // Prometheus metrics; nil disables them
+	metricsAddr      string            // Separate listen address for /metrics; "" serves it with the app
+	tracer           *tracing.Tracer   // Exports spans of requests and upstream calls; nil disables tracing
+	downloadTemplate *naming.Template  // Names single downloads; nil means the default
+	zipTemplate      *naming.Template  // Names album archive entries; nil means the default
+	app              *http.ServeMux    // Routes below the base path, set by routes
 }
 
 // TrackResponse represents a track in API responses
@@ -38,6 +62,13 @@ type TrackResponse struct {
 	Available bool     `json:"available"`
 }
 
+// TrackInfoResponse is a track with what the UI can offer for it
+type TrackInfoResponse struct {
+	TrackResponse
+	HasLyrics    bool `json:"hasLyrics"`
+	SyncedLyrics bool `json:"syncedLyrics"`
+}
+
 // AlbumResponse represents an album in API responses
 type AlbumResponse struct {
 	ID         int      `json:"id"`
@@ -47,6 +78,7 @@ type AlbumResponse struct {
 	Year       int      `json:"year,omitempty"`
 	CoverURL   string   `json:"coverUrl,omitempty"`
 	TrackCount int      `json:"trackCount,omitempty"`
+	Type       string   `json:"type,omitempty"`
 }
 
 // ArtistResponse represents an artist in API responses
@@ -56,14 +88,38 @@ type ArtistResponse struct {
 	CoverURL string `json:"coverUrl,omitempty"`
 }
 
+// PlaylistResponse represents a playlist in API responses
+type PlaylistResponse struct {
+	OwnerUID   int    `json:"ownerUid"`
+	OwnerLogin string `json:"ownerLogin,omitempty"`
+	OwnerName  string `json:"ownerName,omitempty"`
+	Kind       int    `json:"kind"`
+	Title      string `json:"title"`
+	TrackCount int    `json:"trackCount"`
+	Duration   int    `json:"duration,omitempty"`
+	CoverURL   string `json:"coverUrl,omitempty"`
+	Revision   int    `json:"revision,omitempty"`
+}
+
 // SearchResponse represents search results
 type SearchResponse struct {
-	Tracks            []TrackResponse  `json:"tracks"`
-	Albums            []AlbumResponse  `json:"albums,omitempty"`
-	Artists           []ArtistResponse `json:"artists,omitempty"`
-	Total             int              `json:"total"`
-	MisspellCorrected bool             `json:"misspellCorrected,omitempty"`
-	CorrectedText     string           `json:"correctedText,omitempty"`
+	Tracks            []TrackResponse    `json:"tracks"`
+	Albums            []AlbumResponse    `json:"albums,omitempty"`
+	Artists           []ArtistResponse   `json:"artists,omitempty"`
+	Playlists         []PlaylistResponse `json:"playlists,omitempty"`
+	Podcasts          []AlbumResponse    `json:"podcasts,omitempty"`
+	Total             int                `json:"total"`
+	MisspellCorrected bool               `json:"misspellCorrected,omitempty"`
+	CorrectedText     string             `json:"correctedText,omitempty"`
+
+	// Paging, only set by search. Totals holds the upstream number of
+	// matches per result type; NextPage is absent on the last page.
+	Type     string         `json:"type,omitempty"`
+	Page     int            `json:"page,omitempty"`
+	PageSize int            `json:"pageSize,omitempty"`
+	Totals   map[string]int `json:"totals,omitempty"`
+	HasMore  bool           `json:"hasMore,omitempty"`
+	NextPage *int           `json:"nextPage,omitempty"`
 }
 
 // DownloadURLResponse represents download URL response
@@ -71,13 +127,173 @@ type DownloadURLResponse struct {
 	URL string `json:"url"`
 }
 
+// Upper bounds for the upstream work of each endpoint. They are derived from
+// the request context, so a client that goes away cancels the work earlier.
+const (
+	searchTimeout      = 15 * time.Second
+	metadataTimeout    = 15 * time.Second
+	downloadURLTimeout = 10 * time.Second
+	downloadTimeout    = 10 * time.Minute
+	albumZipTimeout    = 60 * time.Minute
+)
+
+// shutdownTimeout bounds each step of shutting down: waiting for requests
+// in flight, then exporting the remaining spans.
+const shutdownTimeout = 10 * time.Second
+
+// Limits on how slowly clients may send requests, and how long an idle
+// keep-alive connection is kept.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
+// Page sizes for paginated track lists.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
 // ErrorResponse represents error responses
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// trackResponse converts a catalog track to its API representation
+func trackResponse(t catalog.Track) TrackResponse {
+	artists := make([]string, len(t.Artists))
+	artistIDs := make([]int, len(t.Artists))
+	for j, artist := range t.Artists {
+		artists[j] = artist.Name
+		artistIDs[j] = artist.ID
+	}
+
+	album := ""
+	albumID := 0
+	if len(t.Albums) > 0 {
+		album = t.Albums[0].Title
+		albumID = t.Albums[0].ID
+	}
+
+	coverURL := ""
+	if cover := t.Cover(); cover != "" {
+		coverURL = "https://" + cover
+	}
+
+	return TrackResponse{
+		ID:        t.ID,
+		Title:     t.Title,
+		Artist:    catalog.ArtistNames(t.Artists),
+		Artists:   artists,
+		ArtistIDs: artistIDs,
+		Album:     album,
+		AlbumID:   albumID,
+		Duration:  t.DurationMs,
+		CoverURL:  coverURL,
+		Available: t.Available,
+	}
+}
+
+// albumResponse converts a catalog album to its API representation
+func albumResponse(a catalog.Album) AlbumResponse {
+	artists := make([]string, len(a.Artists))
+	for j, artist := range a.Artists {
+		artists[j] = artist.Name
+	}
+
+	coverURL := ""
+	if a.CoverURI != "" {
+		coverURL = "https://" + a.CoverURI
+	}
+
+	return AlbumResponse{
+		ID:         a.ID,
+		Title:      a.Title,
+		Artist:     catalog.ArtistNames(a.Artists),
+		Artists:    artists,
+		Year:       a.Year,
+		CoverURL:   coverURL,
+		TrackCount: a.TrackCount,
+		Type:       a.Type,
+	}
+}
+
+// playlistResponse converts a catalog playlist to its API representation
+func playlistResponse(p catalog.Playlist) PlaylistResponse {
+	coverURL := ""
+	if p.CoverURI != "" {
+		coverURL = "https://" + p.CoverURI
+	}
+	return PlaylistResponse{
+		OwnerUID:   p.OwnerUID,
+		OwnerLogin: p.OwnerLogin,
+		OwnerName:  p.OwnerName,
+		Kind:       p.Kind,
+		Title:      p.Title,
+		TrackCount: p.TrackCount,
+		Duration:   p.DurationMs,
+		CoverURL:   coverURL,
+		Revision:   p.Revision,
+	}
+}
+
+// artistResponse converts a catalog artist to its API representation
+func artistResponse(a catalog.Artist) ArtistResponse {
+	coverURL := ""
+	if a.CoverURI != "" {
+		coverURL = "https://" + a.CoverURI
+	}
+	return ArtistResponse{ID: a.ID, Name: a.Name, CoverURL: coverURL}
+}
+
+// writeUpstreamError reports a failed catalog call, passing through the
+// upstream status code when there is one
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var statusErr *catalog.StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		w.WriteHeader(statusErr.StatusCode)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: statusErr.Status})
+	case errors.Is(err, catalog.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "not found"})
+	case errors.Is(err, catalog.ErrWrongRevision):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "playlist has changed, reload it and try again"})
+	case errors.Is(err, catalog.ErrReadOnly):
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "playlist can't be edited"})
+	case errors.Is(err, upstream.ErrCircuitOpen):
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Yandex Music is unavailable, try again later"})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+	}
+}
+
+// parsePage reads the optional page (0-based) and pageSize query parameters.
+// pageSize is defaultSize when the parameter is absent.
+func parsePage(r *http.Request, defaultSize int) (page, pageSize int, err error) {
+	pageSize = defaultSize
+	if v := r.URL.Query().Get("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 0 {
+			return 0, 0, errors.New("invalid page")
+		}
+	}
+	if v := r.URL.Query().Get("pageSize"); v != "" {
+		pageSize, err = strconv.Atoi(v)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return 0, 0, errors.New("invalid pageSize, must be between 1 and " + strconv.Itoa(maxPageSize))
+		}
+	}
+	return page, pageSize, nil
+}
+
 // NewWebServer creates a new web server instance
-func NewWebServer(ctx context.Context) (*WebServer, error) {
+func NewWebServer() (*WebServer, error) {
 	// Try to load .env file from multiple locations
 	// First try current directory (for production binary)
 	err := godotenv.Load()
@@ -98,49 +314,94 @@ func NewWebServer(ctx context.Context) (*WebServer, error) {
 
 	// Get base path from environment variable (e.g., "/music" for reverse proxy)
 	// This serves as a fallback when X-Forwarded-Prefix header is not present
-	basePath := os.Getenv("BASE_PATH")
-	if basePath != "" {
-		// Ensure base path starts with / and doesn't end with /
-		if basePath[0] != '/' {
-			basePath = "/" + basePath
-		}
-		if len(basePath) > 1 && basePath[len(basePath)-1] == '/' {
-			basePath = basePath[:len(basePath)-1]
-		}
+	// Ensure base path starts with / and doesn't end with /
+	basePath, ok := cleanPrefix(os.Getenv("BASE_PATH"))
+	if !ok {
+		return nil, fmt.Errorf("invalid BASE_PATH %q: expected a path like /music", os.Getenv("BASE_PATH"))
 	}
 
 	// Check if we should use proxy headers (modern cloud-native approach)
 	// Default to true for better reverse proxy compatibility
 	useProxyHeaders := os.Getenv("USE_PROXY_HEADERS") != "false"
 
-	client := yamusic.NewClient(yamusic.AccessToken(uid, token))
+	// Proxies allowed to set X-Forwarded-Prefix and X-Forwarded-For; an
+	// empty list trusts loopback only
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	// Number of cached metadata responses; 0 disables the cache
+	cacheSize := defaultCacheSize
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid CACHE_SIZE %q", v)
+		}
+		cacheSize = n
+	}
+
+	// File naming templates for downloads, see internal/naming
+	var downloadTemplate, zipTemplate *naming.Template
+	if v := os.Getenv("DOWNLOAD_NAME_TEMPLATE"); v != "" {
+		if downloadTemplate, err = naming.Parse(v); err != nil {
+			return nil, fmt.Errorf("invalid DOWNLOAD_NAME_TEMPLATE: %w", err)
+		}
+	}
+	if v := os.Getenv("ZIP_NAME_TEMPLATE"); v != "" {
+		if zipTemplate, err = naming.Parse(v); err != nil {
+			return nil, fmt.Errorf("invalid ZIP_NAME_TEMPLATE: %w", err)
+		}
+	}
+
+	tracer, err := newTracer()
+	if err != nil {
+		return nil, err
+	}
+
+	// One resilient client for both the API and the CDN, so they share
+	// connection pools, retries and circuit breakers
+	cfg := upstream.DefaultConfig()
+	cfg.Logger = slog.Default()
+	cfg.Tracer = tracer
+	httpClient := upstream.NewClient(cfg)
+	client := yamusic.NewClient(yamusic.HTTPClient(httpClient), yamusic.AccessToken(uid, token))
+	var yandex catalog.Catalog = catalog.NewYandex(client, httpClient, uid)
+
+	// Metrics are off unless asked for; METRICS_ADDR alone turns them on
+	var metrics *webMetrics
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if os.Getenv("METRICS") == "true" || metricsAddr != "" {
+		metrics = newWebMetrics()
+		yandex = catalog.Observe(yandex, metrics.observeUpstream)
+	}
+	if tracer != nil {
+		yandex = catalog.Observe(yandex, traceCatalog(tracer))
+	}
+
 	return &WebServer{
-		client:          client,
-		ctx:             ctx,
-		basePath:        basePath,
-		useProxyHeaders: useProxyHeaders,
+		catalog:          yandex,
+		dislikes:         catalog.NewDislikes(yandex),
+		metrics:          metrics,
+		metricsAddr:      metricsAddr,
+		tracer:           tracer,
+		basePath:         basePath,
+		useProxyHeaders:  useProxyHeaders,
+		trustedProxies:   trustedProxies,
+		streamURLs:       newURLCache(),
+		cache:            newResponseCache(cacheSize),
+		client:           httpClient,
+		downloadTemplate: downloadTemplate,
+		zipTemplate:      zipTemplate,
 	}, nil
 }
 
-// getBasePath returns the base path for a request
-// It checks X-Forwarded-Prefix header first (if enabled), then falls back to static BASE_PATH
-func (ws *WebServer) getBasePath(r *http.Request) string {
-	// Check X-Forwarded-Prefix header first (modern approach)
-	if ws.useProxyHeaders {
-		if prefix := r.Header.Get("X-Forwarded-Prefix"); prefix != "" {
-			// Clean the prefix
-			if prefix[0] != '/' {
-				prefix = "/" + prefix
-			}
-			if len(prefix) > 1 && prefix[len(prefix)-1] == '/' {
-				prefix = prefix[:len(prefix)-1]
-			}
-			return prefix
-		}
+// httpClient returns the client for CDN requests.
+func (ws *WebServer) httpClient() *http.Client {
+	if ws.client == nil {
+		return http.DefaultClient
 	}
-	
-	// Fall back to static base path from env var
-	return ws.basePath
+	return ws.client
 }
 
 // handleSearch handles track search requests
@@ -154,123 +415,95 @@ func (ws *WebServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Search for all content types (tracks, albums, artists)
-	s, resp, err := ws.client.Search().All(ws.ctx, query, &yamusic.SearchOptions{Page: 0, NoCorrect: false})
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+	searchType := r.URL.Query().Get("type")
+	switch searchType {
+	case "":
+		searchType = catalog.SearchAll
+	case catalog.SearchAll, catalog.SearchTrack, catalog.SearchAlbum, catalog.SearchArtist, catalog.SearchPlaylist, catalog.SearchPodcast:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid type, must be one of all, track, album, artist, playlist, podcast"})
 		return
 	}
-	if resp.StatusCode != 200 {
-		w.WriteHeader(resp.StatusCode)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: resp.Status})
+	// Without pageSize the API picks its own page size
+	page, pageSize, err := parsePage(r, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Process tracks
-	trackResults := s.Result.Tracks.Results
-	tracks := make([]TrackResponse, len(trackResults))
-	for i, result := range trackResults {
-		artists := make([]string, len(result.Artists))
-		artistIDs := make([]int, len(result.Artists))
-		artistStr := ""
-		for j, artist := range result.Artists {
-			artists[j] = artist.Name
-			artistIDs[j] = artist.ID
-			if j == len(result.Artists)-1 {
-				artistStr += artist.Name
-			} else {
-				artistStr += artist.Name + ", "
-			}
-		}
-
-		album := ""
-		albumID := 0
-		coverURL := ""
-		if len(result.Albums) > 0 {
-			album = result.Albums[0].Title
-			albumID = result.Albums[0].ID
-			if result.Albums[0].CoverURI != "" {
-				coverURL = "https://" + result.Albums[0].CoverURI
-			}
-		}
+	ctx, cancel := context.WithTimeout(r.Context(), searchTimeout)
+	defer cancel()
 
-		tracks[i] = TrackResponse{
-			ID:        result.ID,
-			Title:     result.Title,
-			Artist:    artistStr,
-			Artists:   artists,
-			ArtistIDs: artistIDs,
-			Album:     album,
-			AlbumID:   albumID,
-			Duration:  result.DurationMs,
-			CoverURL:  coverURL,
-			Available: result.Available,
-		}
+	res, hit, err := ws.search(ctx, query, catalog.SearchOptions{Type: searchType, Page: page, PageSize: pageSize})
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
 	}
+	setCacheHeader(w, hit)
 
-	// Process albums
-	albumResults := s.Result.Albums.Results
-	albums := make([]AlbumResponse, len(albumResults))
-	for i, result := range albumResults {
-		artists := make([]string, len(result.Artists))
-		artistStr := ""
-		for j, artist := range result.Artists {
-			artists[j] = artist.Name
-			if j == len(result.Artists)-1 {
-				artistStr += artist.Name
-			} else {
-				artistStr += artist.Name + ", "
-			}
-		}
+	// Filtered after the cache, so a new dislike applies immediately
+	filtered := ws.dislikes.Filter(ctx, res.Tracks)
+	tracks := make([]TrackResponse, len(filtered))
+	for i, t := range filtered {
+		tracks[i] = trackResponse(t)
+	}
 
-		coverURL := ""
-		if result.CoverURI != "" {
-			coverURL = "https://" + result.CoverURI
-		}
+	albums := make([]AlbumResponse, len(res.Albums))
+	for i, a := range res.Albums {
+		albums[i] = albumResponse(a)
+	}
 
-		albums[i] = AlbumResponse{
-			ID:         result.ID,
-			Title:      result.Title,
-			Artist:     artistStr,
-			Artists:    artists,
-			Year:       result.Year,
-			CoverURL:   coverURL,
-			TrackCount: result.TrackCount,
-		}
+	artists := make([]ArtistResponse, len(res.Artists))
+	for i, a := range res.Artists {
+		artists[i] = artistResponse(a)
 	}
 
-	// Process artists
-	artistResults := s.Result.Artists.Results
-	artists := make([]ArtistResponse, len(artistResults))
-	for i, result := range artistResults {
-		coverURL := ""
-		if result.Cover.URI != "" {
-			coverURL = "https://" + result.Cover.URI
-		}
+	playlists := make([]PlaylistResponse, len(res.Playlists))
+	for i, p := range res.Playlists {
+		playlists[i] = playlistResponse(p)
+	}
 
-		artists[i] = ArtistResponse{
-			ID:       result.ID,
-			Name:     result.Name,
-			CoverURL: coverURL,
-		}
+	podcasts := make([]AlbumResponse, len(res.Podcasts))
+	for i, a := range res.Podcasts {
+		podcasts[i] = albumResponse(a)
 	}
 
 	// Check for spelling correction
-	misspellCorrected := s.Result.MisspellCorrected
+	misspellCorrected := res.MisspellCorrected
 	correctedText := ""
-	if misspellCorrected && s.Result.MisspellResult != "" {
-		correctedText = s.Result.MisspellResult
+	if misspellCorrected && res.MisspellResult != "" {
+		correctedText = res.MisspellResult
 	}
 
-	json.NewEncoder(w).Encode(SearchResponse{
+	resp := SearchResponse{
 		Tracks:            tracks,
 		Albums:            albums,
 		Artists:           artists,
-		Total:             len(tracks) + len(albums) + len(artists),
+		Playlists:         playlists,
+		Podcasts:          podcasts,
+		Total:             len(tracks) + len(albums) + len(artists) + len(playlists) + len(podcasts),
 		MisspellCorrected: misspellCorrected,
 		CorrectedText:     correctedText,
-	})
+		Type:              searchType,
+		Page:              page,
+		PageSize:          pageSize,
+		Totals:            make(map[string]int, len(res.Pagers)),
+		HasMore:           res.HasMore(),
+	}
+	for typ, p := range res.Pagers {
+		resp.Totals[typ] = p.Total
+		if resp.PageSize == 0 {
+			resp.PageSize = p.PageSize
+		}
+	}
+	if resp.HasMore {
+		next := page + 1
+		resp.NextPage = &next
+	}
+
+	json.NewEncoder(w).Encode(resp)
 }
 
 // handleDownloadURL handles requests for track download URLs
@@ -291,10 +524,12 @@ func (ws *WebServer) handleDownloadURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := ws.client.Tracks().GetDownloadURL(ws.ctx, trackID)
+	ctx, cancel := context.WithTimeout(r.Context(), downloadURLTimeout)
+	defer cancel()
+
+	url, err := ws.catalog.DownloadURL(ctx, trackID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		writeUpstreamError(w, err)
 		return
 	}
 
@@ -322,103 +557,35 @@ func (ws *WebServer) handleAlbumTracks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Use the direct API endpoint to get album with tracks
-	log.Printf("[Album Tracks] Fetching album '%s' (ID: %d) with tracks", albumName, albumID)
+	logger(r.Context()).Debug("fetching album tracks", "album", albumName, "album_id", albumID)
 
-	// Create a request to the albums/{id}/with-tracks endpoint
-	req, err := ws.client.NewRequest("GET", "albums/"+albumIDStr+"/with-tracks", nil)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
-		return
-	}
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
 
-	// Define struct to parse the API response
-	var apiResp struct {
-		Result struct {
-			Volumes [][]struct {
-				ID         json.Number `json:"id"`
-				Title      string      `json:"title"`
-				DurationMs int         `json:"durationMs"`
-				Available  bool        `json:"available"`
-				CoverURI   string      `json:"coverUri"`
-				Artists    []struct {
-					ID   int    `json:"id"`
-					Name string `json:"name"`
-				} `json:"artists"`
-				Albums []struct {
-					ID       int    `json:"id"`
-					Title    string `json:"title"`
-					CoverURI string `json:"coverUri"`
-				} `json:"albums"`
-			} `json:"volumes"`
-		} `json:"result"`
-	}
-
-	resp, err := ws.client.Do(ws.ctx, req, &apiResp)
+	album, hit, err := ws.albumWithTracks(ctx, albumID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
-		return
-	}
-	if resp.StatusCode != 200 {
-		w.WriteHeader(resp.StatusCode)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: resp.Status})
+		writeUpstreamError(w, err)
 		return
 	}
+	setCacheHeader(w, hit)
 
 	// Process the tracks from volumes
 	var allTracks []TrackResponse
-	for _, volume := range apiResp.Result.Volumes {
+	for _, volume := range album.Volumes {
 		for _, track := range volume {
-			// Convert track ID from json.Number to int
-			trackIDInt, err := track.ID.Int64()
-			if err != nil {
-				log.Printf("[Album Tracks] Failed to parse track ID: %v", err)
-				continue
-			}
-
-			artists := make([]string, len(track.Artists))
-			artistIDs := make([]int, len(track.Artists))
-			artistStr := ""
-			for j, artist := range track.Artists {
-				artists[j] = artist.Name
-				artistIDs[j] = artist.ID
-				if j == len(track.Artists)-1 {
-					artistStr += artist.Name
-				} else {
-					artistStr += artist.Name + ", "
-				}
-			}
-
-			coverURL := ""
-			if track.CoverURI != "" {
-				coverURL = "https://" + track.CoverURI
+			tr := trackResponse(track)
+			if tr.Album == "" {
+				tr.Album = albumName
 			}
-
-			albumTitle := albumName
-			if len(track.Albums) > 0 {
-				albumTitle = track.Albums[0].Title
-				if track.Albums[0].CoverURI != "" {
-					coverURL = "https://" + track.Albums[0].CoverURI
-				}
+			if tr.CoverURL == "" && album.CoverURI != "" {
+				tr.CoverURL = "https://" + album.CoverURI
 			}
-
-			allTracks = append(allTracks, TrackResponse{
-				ID:        int(trackIDInt),
-				Title:     track.Title,
-				Artist:    artistStr,
-				Artists:   artists,
-				ArtistIDs: artistIDs,
-				Album:     albumTitle,
-				AlbumID:   albumID,
-				Duration:  track.DurationMs,
-				CoverURL:  coverURL,
-				Available: track.Available,
-			})
+			tr.AlbumID = albumID
+			allTracks = append(allTracks, tr)
 		}
 	}
 
-	log.Printf("[Album Tracks] Returning %d tracks for album '%s'", len(allTracks), albumName)
+	logger(r.Context()).Debug("returning album tracks", "album", albumName, "tracks", len(allTracks))
 
 	json.NewEncoder(w).Encode(SearchResponse{
 		Tracks: allTracks,
@@ -426,16 +593,14 @@ func (ws *WebServer) handleAlbumTracks(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleArtistTracks handles requests for artist tracks by searching for the artist name
+// handleArtistTracks returns one page of all tracks by an artist
 func (ws *WebServer) handleArtistTracks(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	artistIDStr := r.URL.Query().Get("id")
-	artistName := r.URL.Query().Get("name")
-
-	if artistIDStr == "" || artistName == "" {
+	if artistIDStr == "" {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "query parameters 'id' and 'name' are required"})
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "query parameter 'id' is required"})
 		return
 	}
 
@@ -445,77 +610,35 @@ func (ws *WebServer) handleArtistTracks(w http.ResponseWriter, r *http.Request)
 		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid artist ID"})
 		return
 	}
-
-	// Search for the artist name to get tracks
-	s, resp, err := ws.client.Search().Tracks(ws.ctx, artistName, &yamusic.SearchOptions{Page: 0, NoCorrect: false})
+	page, pageSize, err := parsePage(r, defaultPageSize)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
 		return
 	}
-	if resp.StatusCode != 200 {
-		w.WriteHeader(resp.StatusCode)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: resp.Status})
-		return
-	}
 
-	// Filter tracks by artist ID
-	var filteredTracks []TrackResponse
-	for _, result := range s.Result.Tracks.Results {
-		for _, artist := range result.Artists {
-			if artist.ID == artistID {
-				artists := make([]string, len(result.Artists))
-				artistIDs := make([]int, len(result.Artists))
-				artistStr := ""
-				for j, a := range result.Artists {
-					artists[j] = a.Name
-					artistIDs[j] = a.ID
-					if j == len(result.Artists)-1 {
-						artistStr += a.Name
-					} else {
-						artistStr += a.Name + ", "
-					}
-				}
-
-				album := ""
-				albumID := 0
-				coverURL := ""
-				if len(result.Albums) > 0 {
-					album = result.Albums[0].Title
-					albumID = result.Albums[0].ID
-					if result.Albums[0].CoverURI != "" {
-						coverURL = "https://" + result.Albums[0].CoverURI
-					}
-				}
-
-				filteredTracks = append(filteredTracks, TrackResponse{
-					ID:        result.ID,
-					Title:     result.Title,
-					Artist:    artistStr,
-					Artists:   artists,
-					ArtistIDs: artistIDs,
-					Album:     album,
-					AlbumID:   albumID,
-					Duration:  result.DurationMs,
-					CoverURL:  coverURL,
-					Available: result.Available,
-				})
-				break // Only add track once even if artist appears multiple times
-			}
-		}
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	tracks, hit, err := ws.artistTracks(ctx, artistID, page, pageSize)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
 	}
+	setCacheHeader(w, hit)
 
-	json.NewEncoder(w).Encode(SearchResponse{
-		Tracks: filteredTracks,
-		Total:  len(filteredTracks),
-	})
+	json.NewEncoder(w).Encode(trackPageResponse(tracks))
 }
 
-// enableCORS adds CORS headers to allow browser access
+// enableCORS adds CORS headers to allow browser access. Only reads are
+// shared with other origins; the POST endpoints change the account and are
+// for the app's own pages, see decodeJSONRequest.
 func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		if r.Method != http.MethodPost {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 		if r.Method == "OPTIONS" {
@@ -527,36 +650,6 @@ func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// handleIndex serves the index.html with base path injected
-func (ws *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
-	// Read the index.html file
-	indexContent, err := os.ReadFile("./static/index.html")
-	if err != nil {
-		http.Error(w, "Failed to load index.html", http.StatusInternalServerError)
-		return
-	}
-
-	content := string(indexContent)
-
-	// Get dynamic base path (supports X-Forwarded-Prefix header)
-	basePath := ws.getBasePath(r)
-	basePathForTag := basePath
-	if basePathForTag == "" {
-		basePathForTag = "/"
-	} else if basePathForTag[len(basePathForTag)-1] != '/' {
-		basePathForTag = basePathForTag + "/"
-	}
-
-	baseTag := "<base href=\"" + basePathForTag + "\">\n    "
-	basePathScript := "<script>window.BASE_PATH = '" + basePath + "';</script>\n    "
-
-	// Insert after <head> tag
-	content = strings.Replace(content, "<head>\n", "<head>\n    "+baseTag+basePathScript, 1)
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(content))
-}
-
 // handleAlbumZip downloads all tracks from an album and streams them as a zip archive
 func (ws *WebServer) handleAlbumZip(w http.ResponseWriter, r *http.Request) {
 	albumIDStr := r.URL.Query().Get("id")
@@ -574,137 +667,210 @@ func (ws *WebServer) handleAlbumZip(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid album ID"})
 		return
 	}
-	_ = albumID
-
-	// Fetch album tracks first
-	req, err := ws.client.NewRequest("GET", "albums/"+albumIDStr+"/with-tracks", nil)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
-		return
-	}
 
-	var apiResp struct {
-		Result struct {
-			Volumes [][]struct {
-				ID         json.Number `json:"id"`
-				Title      string      `json:"title"`
-				Available  bool        `json:"available"`
-				Artists    []struct {
-					Name string `json:"name"`
-				} `json:"artists"`
-			} `json:"volumes"`
-		} `json:"result"`
-	}
+	// The whole archive shares one deadline; a closed tab cancels it at once
+	ctx, cancel := context.WithTimeout(r.Context(), albumZipTimeout)
+	defer cancel()
 
-	resp, err := ws.client.Do(ws.ctx, req, &apiResp)
+	// Fetch album tracks first
+	album, err := ws.catalog.AlbumWithTracks(ctx, albumID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
-		return
-	}
-	if resp.StatusCode != 200 {
-		w.WriteHeader(resp.StatusCode)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: resp.Status})
+		ws.metrics.zipStream("failed", 0)
+		writeUpstreamError(w, err)
 		return
 	}
 
 	type trackInfo struct {
-		id     int
-		title  string
-		artist string
+		id   int
+		name string // Entry name in the archive
+		tag  *id3.Tag
 	}
 
 	var tracks []trackInfo
-	for _, volume := range apiResp.Result.Volumes {
-		for _, t := range volume {
+	used := make(map[string]bool)
+	for v, volume := range album.Volumes {
+		for i, t := range volume {
 			if !t.Available {
+				ws.metrics.zipSkip(skipUnavailable)
 				continue
 			}
-			idInt, err := t.ID.Int64()
-			if err != nil {
-				continue
-			}
-			artistStr := ""
-			for j, a := range t.Artists {
-				if j > 0 {
-					artistStr += ", "
-				}
-				artistStr += a.Name
+			name := ws.zipNames().Execute(naming.AlbumFields(album, v, i))
+			// A template without {disc} or {track} may name two tracks alike
+			unique := name
+			for n := 2; used[unique]; n++ {
+				unique = fmt.Sprintf("%s (%d)", name, n)
 			}
-			tracks = append(tracks, trackInfo{int(idInt), t.Title, artistStr})
+			used[unique] = true
+			tracks = append(tracks, trackInfo{t.ID, unique + ".mp3", albumTag(album, v, i)})
 		}
 	}
 
-	log.Printf("[AlbumZip] Streaming %d tracks for album '%s'", len(tracks), albumName)
+	zipLog := logger(ctx).With("album", albumName, "album_id", albumID)
+	zipLog.Info("streaming album zip", "tracks", len(tracks))
 
-	// Sanitize album name for filename
-	sanitize := func(s string) string {
-		return strings.Map(func(r rune) rune {
-			if strings.ContainsRune(`/\:*?"<>|`, r) {
-				return '_'
-			}
-			return r
-		}, s)
-	}
+	// One cover for the whole album, embedded into every track
+	cover := ws.fetchCover(ctx, album.CoverURI)
+
+	// Count what reaches the client, however the stream ends
+	cw := &countingResponseWriter{ResponseWriter: w}
+	w = cw
+	result := "cancelled"
+	defer func() { ws.metrics.zipStream(result, cw.n) }()
 
 	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, sanitize(albumName)))
+	w.Header().Set("Content-Disposition", attachment(naming.Sanitize(albumName)+".zip"))
 	// Disable buffering so Firefox sees bytes immediately
 	if fl, ok := w.(http.Flusher); ok {
 		fl.Flush()
 	}
 
 	zw := zip.NewWriter(w)
+	// Tracks that didn't make it, listed in zipErrorsName at the end
+	var failures []string
 
 	// Process each track sequentially: get fresh URL → download → write → flush.
 	// This avoids URL expiry (TTL ~1 min) that occurs when all URLs are
 	// pre-fetched and only used later.
 	for i, t := range tracks {
-		safeFilename := fmt.Sprintf("%02d. %s - %s.mp3", i+1, sanitize(t.artist), sanitize(t.title))
-		log.Printf("[AlbumZip] [%d/%d] %s", i+1, len(tracks), safeFilename)
+		if err := ctx.Err(); err != nil {
+			zipLog.Info("album zip cancelled", "done", i, "tracks", len(tracks), "error", err)
+			return
+		}
+
+		zipLog.Debug("album zip track", "n", i+1, "tracks", len(tracks), "file", t.name)
+
+		// A span per track, so a slow zip shows whether the download URL,
+		// the CDN or the client holds it up
+		trackCtx, span := ws.tracer.Start(ctx, "album zip track", tracing.KindInternal,
+			tracing.Int("track.id", t.id),
+			tracing.String("zip.entry", t.name),
+		)
+		skip := func(reason string, err error) {
+			ws.metrics.zipSkip(reason)
+			failures = append(failures, fmt.Sprintf("%s: %v", t.name, err))
+			span.SetAttrs(tracing.String("zip.skipped", reason))
+			span.SetError(err)
+			span.End()
+		}
 
 		// Fresh download URL for this track
-		dlURL, err := ws.client.Tracks().GetDownloadURL(ws.ctx, t.id)
+		urlCtx, cancelURL := context.WithTimeout(trackCtx, downloadURLTimeout)
+		dlURL, err := ws.catalog.DownloadURL(urlCtx, t.id)
+		cancelURL()
 		if err != nil {
-			log.Printf("[AlbumZip] Failed to get URL for '%s': %v — skipping", safeFilename, err)
+			zipLog.Warn("skipping track: no download URL", "file", t.name, "error", err)
+			skip(skipURL, err)
 			continue
 		}
 
-		// Create zip entry
-		fw, err := zw.Create(safeFilename)
+		// Start the download before creating the entry, so a failed request
+		// doesn't leave an empty file in the archive
+		dlCtx, dlSpan := ws.tracer.Start(trackCtx, "album zip download", tracing.KindInternal)
+		req, err := http.NewRequestWithContext(dlCtx, http.MethodGet, dlURL, nil)
+		if err != nil {
+			zipLog.Warn("skipping track: bad download URL", "file", t.name, "error", err)
+			dlSpan.End()
+			skip(skipURL, err)
+			continue
+		}
+		trackResp, err := ws.httpClient().Do(req)
 		if err != nil {
-			log.Printf("[AlbumZip] Failed to create zip entry for '%s': %v — skipping", safeFilename, err)
+			zipLog.Warn("skipping track: download failed", "file", t.name, "error", err)
+			dlSpan.SetError(err)
+			dlSpan.End()
+			skip(skipDownload, err)
+			continue
+		}
+		if trackResp.StatusCode != http.StatusOK {
+			trackResp.Body.Close()
+			zipLog.Warn("skipping track: download failed", "file", t.name, "status", trackResp.StatusCode)
+			err := fmt.Errorf("CDN returned %s", trackResp.Status)
+			dlSpan.SetError(err)
+			dlSpan.End()
+			skip(skipDownload, err)
 			continue
 		}
 
-		// Stream track audio into zip entry
-		trackResp, err := http.Get(dlURL) //nolint:gosec
+		// Create zip entry
+		fw, err := zw.Create(t.name)
 		if err != nil {
-			log.Printf("[AlbumZip] Failed to download '%s': %v — skipping", safeFilename, err)
+			trackResp.Body.Close()
+			zipLog.Warn("skipping track: zip entry failed", "file", t.name, "error", err)
+			dlSpan.End()
+			skip(skipEntry, err)
 			continue
 		}
-		_, copyErr := io.Copy(fw, trackResp.Body)
+
+		// Stream track audio into zip entry, tagged on the way through. The
+		// download span covers the transfer, which runs at the pace of the
+		// slower of the CDN and the client.
+		t.tag.Cover = cover
+		n, copyErr := id3.Copy(fw, trackResp.Body, t.tag)
 		trackResp.Body.Close()
+		dlSpan.SetAttrs(tracing.Int64("zip.entry.bytes", n))
+		dlSpan.SetError(copyErr)
+		dlSpan.End()
 		if copyErr != nil {
-			log.Printf("[AlbumZip] Copy error for '%s': %v", safeFilename, copyErr)
+			if ctx.Err() != nil {
+				span.End()
+				zipLog.Info("album zip cancelled", "file", t.name, "error", ctx.Err())
+				return
+			}
+			// The truncated entry can't be taken back out of the archive, so
+			// it is at least named in the error listing
+			zipLog.Warn("album zip copy failed", "file", t.name, "error", copyErr)
+			skip(skipCopy, fmt.Errorf("incomplete, %w", copyErr))
+		} else {
+			span.End()
 		}
 
-		// Flush after each track so the browser receives data and doesn't time out
+		// Flush after each track so the browser receives data and doesn't
+		// time out. If even that fails, the listing can't be written either,
+		// so end the response without the central directory rather than let
+		// a broken entry pass as a complete zip.
 		if err := zw.Flush(); err != nil {
-			log.Printf("[AlbumZip] Flush error after '%s': %v", safeFilename, err)
+			zipLog.Warn("album zip flush failed", "file", t.name, "error", err)
+			if copyErr != nil {
+				result = "aborted"
+				return
+			}
 		}
 		if fl, ok := w.(http.Flusher); ok {
 			fl.Flush()
 		}
 	}
 
-	zw.Close()
-	log.Printf("[AlbumZip] Done streaming zip for album '%s'", albumName)
+	if len(failures) > 0 {
+		if err := writeZipErrors(zw, failures); err != nil {
+			zipLog.Warn("album zip error listing failed", "error", err)
+			result = "aborted"
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		zipLog.Warn("album zip close failed", "error", err)
+		result = "aborted"
+		return
+	}
+	result = "complete"
+	zipLog.Info("album zip done", "tracks", len(tracks), "skipped", len(failures))
+}
+
+// zipErrorsName is the archive entry listing the tracks of an album zip that
+// are missing or incomplete.
+const zipErrorsName = "errors.txt"
+
+// writeZipErrors adds the error listing to zw, one track per line.
+func writeZipErrors(zw *zip.Writer, failures []string) error {
+	fw, err := zw.Create(zipErrorsName)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(fw, strings.Join(failures, "\r\n")+"\r\n")
+	return err
 }
 
 // handleTrackInfo fetches metadata for a single track by ID.
-// Uses the library's Tracks().Get() method (yamusic.TrackResp.Result []Track).
 func (ws *WebServer) handleTrackInfo(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -722,173 +888,211 @@ func (ws *WebServer) handleTrackInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Use the library's native method — no manual NewRequest/Do needed
-	trackResp, resp, err := ws.client.Tracks().Get(ws.ctx, trackID)
+	ctx, cancel := context.WithTimeout(r.Context(), metadataTimeout)
+	defer cancel()
+
+	track, hit, err := ws.track(ctx, trackID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
-		return
-	}
-	if resp.StatusCode != 200 {
-		w.WriteHeader(resp.StatusCode)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: resp.Status})
-		return
-	}
-	if len(trackResp.Result) == 0 {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "track not found"})
+		if errors.Is(err, catalog.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "track not found"})
+			return
+		}
+		writeUpstreamError(w, err)
 		return
 	}
 
-	t := trackResp.Result[0] // yamusic.Track
+	setCacheHeader(w, hit)
+	json.NewEncoder(w).Encode(TrackInfoResponse{
+		TrackResponse: trackResponse(*track),
+		HasLyrics:     track.HasLyrics,
+		SyncedLyrics:  track.HasSyncedLyrics,
+	})
+}
 
-	artistStr := ""
-	artists := make([]string, len(t.Artists))
-	artistIDs := make([]int, len(t.Artists))
-	for j, a := range t.Artists {
-		artists[j] = a.Name
-		artistIDs[j] = a.ID
-		if j > 0 {
-			artistStr += ", "
+// StartWebServer starts the HTTP server. The web app is served from
+// staticDir if set, reloading files as they change, and from the files
+// embedded in the binary otherwise.
+func StartWebServer(port, staticDir string) error {
+	// JSON logs, including those written through the log package
+	var level slog.Level
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL %q", v)
 		}
-		artistStr += a.Name
 	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
 
-	album := ""
-	albumID := 0
-	coverURL := ""
-	if len(t.Albums) > 0 {
-		album = t.Albums[0].Title
-		albumID = t.Albums[0].ID
-		if t.Albums[0].CoverURI != "" {
-			coverURL = "https://" + t.Albums[0].CoverURI
-		}
+	ws, err := NewWebServer()
+	if err != nil {
+		return err
 	}
-	if coverURL == "" && t.CoverURI != "" {
-		coverURL = "https://" + t.CoverURI
+	if staticDir != "" {
+		ws.static = &staticFiles{fsys: os.DirFS(staticDir), live: true}
+		log.Printf("Serving static files from %s", staticDir)
 	}
+	site, err := ws.staticFiles().load()
+	if err != nil {
+		return fmt.Errorf("loading static files: %w", err)
+	}
+	log.Printf("Static files version %s", site.version)
 
-	// Track.ID is a string in the library ("12345"), convert to int for our API
-	trackIDInt, _ := strconv.Atoi(t.ID)
+	if ws.useProxyHeaders {
+		log.Printf("Starting web server on http://localhost:%s%s (X-Forwarded-Prefix enabled)\n", port, ws.basePath)
+	} else {
+		log.Printf("Starting web server on http://localhost:%s%s\n", port, ws.basePath)
+	}
 
-	json.NewEncoder(w).Encode(TrackResponse{
-		ID:        trackIDInt,
-		Title:     t.Title,
-		Artist:    artistStr,
-		Artists:   artists,
-		ArtistIDs: artistIDs,
-		Album:     album,
-		AlbumID:   albumID,
-		Duration:  t.DurationMs,
-		CoverURL:  coverURL,
-		Available: t.Available,
-	})
-}
+	// Listen before serving the app, so a taken port fails startup
+	var metricsLn net.Listener
+	if ws.metrics != nil {
+		if ws.metricsAddr == "" {
+			log.Printf("Serving metrics on /metrics")
+		} else {
+			metricsLn, err = net.Listen("tcp", ws.metricsAddr)
+			if err != nil {
+				return fmt.Errorf("metrics listener: %w", err)
+			}
+			log.Printf("Serving metrics on http://%s/metrics", metricsLn.Addr())
+		}
+	}
 
-// StartWebServer starts the HTTP server
-func StartWebServer(port string) error {
-	ctx := context.Background()
-	ws, err := NewWebServer(ctx)
+	ln, err := net.Listen("tcp", ":"+port)
 	if err != nil {
+		if metricsLn != nil {
+			metricsLn.Close()
+		}
 		return err
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return ws.serve(ctx, ln, metricsLn)
+}
 
-	// Create a new ServeMux for routing
-	mux := http.NewServeMux()
-
-	// Serve static files with base path
-	fs := http.FileServer(http.Dir("./static"))
-	
-	// Universal handler that works with both static BASE_PATH and dynamic X-Forwarded-Prefix
-	universalHandler := func(w http.ResponseWriter, r *http.Request) {
-		basePath := ws.getBasePath(r)
-		path := r.URL.Path
-		
-		// If we have a base path from header but no static BASE_PATH,
-		// we're in proxy mode - serve everything and inject base path into HTML
-		if basePath != "" && ws.basePath == "" && ws.useProxyHeaders {
-			// Proxy has already stripped the prefix, serve normally
-			if path == "/" || path == "/index.html" {
-				ws.handleIndex(w, r)
-			} else {
-				fs.ServeHTTP(w, r)
-			}
-			return
-		}
-		
-		// If we have a static base path, check if request matches it
-		if basePath != "" {
-			// Handle exact base path (with or without trailing slash) - serve index
-			if path == basePath || path == basePath+"/" {
-				ws.handleIndex(w, r)
-				return
-			}
-			
-			// Handle sub-paths under base path - strip prefix and serve static files
-			if strings.HasPrefix(path, basePath+"/") {
-				http.StripPrefix(basePath, fs).ServeHTTP(w, r)
-				return
-			}
-			
-			// Path doesn't match our base path
-			http.NotFound(w, r)
-			return
-		}
-		
-		// No base path - serve at root
-		if path == "/" || path == "/index.html" {
-			ws.handleIndex(w, r)
-		} else {
-			fs.ServeHTTP(w, r)
+// newHTTPServer returns a server for h with the timeouts every listener
+// uses. There is no write timeout: streams and album zips may take long.
+func newHTTPServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// serve serves the app on ln, and the metrics on metricsLn if it is not
+// nil, until ctx is done or either server fails. It then lets requests in
+// flight finish and exports the spans still queued.
+func (ws *WebServer) serve(ctx context.Context, ln, metricsLn net.Listener) error {
+	srv := newHTTPServer(ws.middleware(ws.routes()))
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+	var metricsSrv *http.Server
+	if metricsLn != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", ws.metrics.registry.Handler())
+		metricsSrv = newHTTPServer(mux)
+		go func() {
+			serveErr <- fmt.Errorf("metrics server: %w", metricsSrv.Serve(metricsLn))
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if serr := srv.Shutdown(shutdownCtx); serr != nil {
+		err = errors.Join(err, fmt.Errorf("server shutdown: %w", serr))
+	}
+	if metricsSrv != nil {
+		if serr := metricsSrv.Shutdown(shutdownCtx); serr != nil {
+			err = errors.Join(err, fmt.Errorf("metrics server shutdown: %w", serr))
 		}
 	}
-	
-	// API handler wrapper that supports dynamic base path
-	apiHandler := func(handler http.HandlerFunc) http.HandlerFunc {
-		return enableCORS(func(w http.ResponseWriter, r *http.Request) {
-			handler(w, r)
-		})
+	// Separately bounded, so requests that outlast their grace period
+	// don't cost the spans
+	shutdownCtx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return errors.Join(err, ws.Shutdown(shutdownCtx))
+}
+
+// Shutdown releases what the server holds beyond its requests: it exports
+// the queued trace spans and stops the tracer.
+func (ws *WebServer) Shutdown(ctx context.Context) error {
+	if err := ws.tracer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("tracer shutdown: %w", err)
 	}
-	
+	return nil
+}
+
+// routes returns the server's handler. The web app and API are registered
+// once, relative to the app's root, and mounted under BASE_PATH if it is
+// set. An in-process /metrics stays at the root.
+func (ws *WebServer) routes() http.Handler {
+	app := http.NewServeMux()
+	app.HandleFunc("/", ws.handleApp)
+	for _, route := range []struct {
+		pattern string
+		handler http.HandlerFunc
+	}{
+		{"/api/search", ws.handleSearch},
+		{"/api/download-url", ws.handleDownloadURL},
+		{"/api/stream", ws.handleStream},
+		{"/api/album-tracks", ws.handleAlbumTracks},
+		{"/api/artist-tracks", ws.handleArtistTracks},
+		{"/api/artist", ws.handleArtist},
+		{"/api/album-zip", ws.handleAlbumZip},
+		{"/api/download", ws.handleDownload},
+		{"/api/track-info", ws.handleTrackInfo},
+		{"/api/lyrics", ws.handleLyrics},
+		{"/api/playlists", ws.handlePlaylists},
+		{"/api/playlists/create", ws.handleCreatePlaylist},
+		{"/api/playlist", ws.handlePlaylist},
+		{"/api/playlist/rename", ws.handleRenamePlaylist},
+		{"/api/playlist/add", ws.handlePlaylistAdd},
+		{"/api/playlist/remove", ws.handlePlaylistRemove},
+		{"/api/playlist/move", ws.handlePlaylistMove},
+		{"/api/library", ws.handleLibrary},
+		{"/api/library/disliked", ws.handleDisliked},
+		{"/api/library/like", ws.handleLike},
+		{"/api/library/unlike", ws.handleUnlike},
+		{"/api/library/dislike", ws.handleDislike},
+		{"/api/library/undislike", ws.handleUndislike},
+		{"/api/radio/stations", ws.handleRadioStations},
+		{"/api/radio/tracks", ws.handleRadioTracks},
+		{"/api/radio/feedback", ws.handleRadioFeedback},
+	} {
+		app.HandleFunc(route.pattern, enableCORS(route.handler))
+	}
+	ws.app = app
+
+	mux := app
 	if ws.basePath != "" {
-		// Static base path mode (backwards compatible)
-		// Register handler for base path without trailing slash
-		mux.HandleFunc(ws.basePath, universalHandler)
-		// Register handler for base path with trailing slash to catch all sub-paths
-		mux.HandleFunc(ws.basePath+"/", universalHandler)
-		
-		// API endpoints with base path
-		mux.HandleFunc(ws.basePath+"/api/search", apiHandler(ws.handleSearch))
-		mux.HandleFunc(ws.basePath+"/api/download-url", apiHandler(ws.handleDownloadURL))
-		mux.HandleFunc(ws.basePath+"/api/album-tracks", apiHandler(ws.handleAlbumTracks))
-		mux.HandleFunc(ws.basePath+"/api/artist-tracks", apiHandler(ws.handleArtistTracks))
-		mux.HandleFunc(ws.basePath+"/api/album-zip", apiHandler(ws.handleAlbumZip))
-		mux.HandleFunc(ws.basePath+"/api/track-info", apiHandler(ws.handleTrackInfo))
-		
-		if ws.useProxyHeaders {
-			log.Printf("Starting web server on http://localhost:%s%s (X-Forwarded-Prefix enabled)\n", port, ws.basePath)
-		} else {
-			log.Printf("Starting web server on http://localhost:%s%s\n", port, ws.basePath)
-		}
-	} else {
-		// Root path mode - also supports X-Forwarded-Prefix if enabled
-		mux.HandleFunc("/", universalHandler)
-		
-		// API endpoints at root
-		mux.HandleFunc("/api/search", apiHandler(ws.handleSearch))
-		mux.HandleFunc("/api/download-url", apiHandler(ws.handleDownloadURL))
-		mux.HandleFunc("/api/album-tracks", apiHandler(ws.handleAlbumTracks))
-		mux.HandleFunc("/api/artist-tracks", apiHandler(ws.handleArtistTracks))
-		mux.HandleFunc("/api/album-zip", apiHandler(ws.handleAlbumZip))
-		mux.HandleFunc("/api/track-info", apiHandler(ws.handleTrackInfo))
-		
-		if ws.useProxyHeaders {
-			log.Printf("Starting web server on http://localhost:%s (X-Forwarded-Prefix enabled)\n", port)
-		} else {
-			log.Printf("Starting web server on http://localhost:%s\n", port)
-		}
+		mux = http.NewServeMux()
+		// The bare prefix serves the page too, rather than redirecting
+		mux.HandleFunc(ws.basePath, ws.handleIndex)
+		mux.Handle(ws.basePath+"/", http.StripPrefix(ws.basePath, app))
 	}
+	if ws.metrics != nil && ws.metricsAddr == "" {
+		mux.Handle("/metrics", ws.metrics.registry.Handler())
+	}
+	return mux
+}
 
-	addr := ":" + port
-	return http.ListenAndServe(addr, mux)
+// handleApp serves the web app: the page at the root and static files
+// below it. Behind a proxy that sends X-Forwarded-Prefix the prefix has
+// already been stripped, so the same paths apply.
+func (ws *WebServer) handleApp(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" || r.URL.Path == "/index.html" {
+		ws.handleIndex(w, r)
+		return
+	}
+	ws.staticFiles().ServeHTTP(w, r)
 }
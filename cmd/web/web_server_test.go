@@ -1,20 +1,39 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/catalog/yandextest"
+	"go_yandex_music/internal/naming"
+	"go_yandex_music/internal/tracing"
+	"go_yandex_music/internal/upstream"
 )
 
 // TestHandleSearchMissingQuery tests search endpoint with missing query parameter
 func TestHandleSearchMissingQuery(t *testing.T) {
-	ws := &WebServer{ctx: context.Background()}
+	ws := &WebServer{}
 
 	req := httptest.NewRequest("GET", "/api/search", nil)
 	w := httptest.NewRecorder()
@@ -37,7 +56,7 @@ func TestHandleSearchMissingQuery(t *testing.T) {
 
 // TestHandleDownloadURLMissingID tests download URL endpoint with missing ID
 func TestHandleDownloadURLMissingID(t *testing.T) {
-	ws := &WebServer{ctx: context.Background()}
+	ws := &WebServer{}
 
 	req := httptest.NewRequest("GET", "/api/download-url", nil)
 	w := httptest.NewRecorder()
@@ -51,7 +70,7 @@ func TestHandleDownloadURLMissingID(t *testing.T) {
 
 // TestHandleDownloadURLInvalidID tests download URL endpoint with invalid ID
 func TestHandleDownloadURLInvalidID(t *testing.T) {
-	ws := &WebServer{ctx: context.Background()}
+	ws := &WebServer{}
 
 	req := httptest.NewRequest("GET", "/api/download-url?id=invalid", nil)
 	w := httptest.NewRecorder()
@@ -74,7 +93,7 @@ func TestHandleDownloadURLInvalidID(t *testing.T) {
 
 // TestHandleAlbumTracksMissingParams tests album tracks endpoint with missing parameters
 func TestHandleAlbumTracksMissingParams(t *testing.T) {
-	ws := &WebServer{ctx: context.Background()}
+	ws := &WebServer{}
 
 	// Test missing both params
 	req := httptest.NewRequest("GET", "/api/album-tracks", nil)
@@ -106,7 +125,7 @@ func TestHandleAlbumTracksMissingParams(t *testing.T) {
 
 // TestHandleAlbumTracksInvalidID tests album tracks endpoint with invalid ID
 func TestHandleAlbumTracksInvalidID(t *testing.T) {
-	ws := &WebServer{ctx: context.Background()}
+	ws := &WebServer{}
 
 	req := httptest.NewRequest("GET", "/api/album-tracks?id=invalid&name=test", nil)
 	w := httptest.NewRecorder()
@@ -129,7 +148,7 @@ func TestHandleAlbumTracksInvalidID(t *testing.T) {
 
 // TestHandleArtistTracksMissingParams tests artist tracks endpoint with missing parameters
 func TestHandleArtistTracksMissingParams(t *testing.T) {
-	ws := &WebServer{ctx: context.Background()}
+	ws := &WebServer{}
 
 	// Test missing both params
 	req := httptest.NewRequest("GET", "/api/artist-tracks", nil)
@@ -143,7 +162,7 @@ func TestHandleArtistTracksMissingParams(t *testing.T) {
 
 // TestHandleArtistTracksInvalidID tests artist tracks endpoint with invalid ID
 func TestHandleArtistTracksInvalidID(t *testing.T) {
-	ws := &WebServer{ctx: context.Background()}
+	ws := &WebServer{}
 
 	req := httptest.NewRequest("GET", "/api/artist-tracks?id=invalid&name=test", nil)
 	w := httptest.NewRecorder()
@@ -181,13 +200,21 @@ func TestEnableCORS(t *testing.T) {
 		t.Errorf("Expected Access-Control-Allow-Origin: *, got %s", origin)
 	}
 
-	if methods := w.Header().Get("Access-Control-Allow-Methods"); methods != "GET, POST, OPTIONS" {
-		t.Errorf("Expected Access-Control-Allow-Methods: GET, POST, OPTIONS, got %s", methods)
+	if methods := w.Header().Get("Access-Control-Allow-Methods"); methods != "GET, OPTIONS" {
+		t.Errorf("Expected Access-Control-Allow-Methods: GET, OPTIONS, got %s", methods)
 	}
 
 	if headers := w.Header().Get("Access-Control-Allow-Headers"); headers != "Content-Type" {
 		t.Errorf("Expected Access-Control-Allow-Headers: Content-Type, got %s", headers)
 	}
+
+	// POSTs change the account and are not shared with other origins
+	req = httptest.NewRequest("POST", "/test", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin for POST, got %s", origin)
+	}
 }
 
 // TestEnableCORSOptions tests CORS OPTIONS request
@@ -286,8 +313,7 @@ func TestSearchIntegration(t *testing.T) {
 		t.Skip("Skipping integration test: YA_MUSIC_TOKEN or YA_MUSIC_ID not set")
 	}
 
-	ctx := context.Background()
-	ws, err := NewWebServer(ctx)
+	ws, err := NewWebServer()
 	if err != nil {
 		t.Fatalf("Failed to create web server: %v", err)
 	}
@@ -334,7 +360,6 @@ func TestHandleIndexWithBasePath(t *testing.T) {
 
 	// Create WebServer with base path
 	ws := &WebServer{
-		ctx:      context.Background(),
 		basePath: "/music",
 	}
 
@@ -367,7 +392,7 @@ func TestHandleIndexWithBasePath(t *testing.T) {
 			}
 
 			// Check that BASE_PATH script is injected
-			if !strings.Contains(body, `window.BASE_PATH = '/music'`) {
+			if !strings.Contains(body, `window.BASE_PATH = "/music"`) {
 				t.Errorf("Expected BASE_PATH script, but not found in response")
 				t.Logf("Response body: %s", body)
 			}
@@ -377,53 +402,12 @@ func TestHandleIndexWithBasePath(t *testing.T) {
 
 // TestBasePathNoRedirect tests that accessing base path doesn't cause redirect
 func TestBasePathNoRedirect(t *testing.T) {
-	// Create a temporary static directory with index.html
-	tmpDir := t.TempDir()
-	staticDir := tmpDir + "/static"
-	if err := os.MkdirAll(staticDir, 0755); err != nil {
-		t.Fatalf("Failed to create temp static dir: %v", err)
-	}
-
-	// Create a simple index.html
-	indexHTML := "<head>\n<title>Test</title>\n</head>\n<body>Test</body>"
-	if err := os.WriteFile(staticDir+"/index.html", []byte(indexHTML), 0644); err != nil {
-		t.Fatalf("Failed to write index.html: %v", err)
-	}
-
-	// Change to temp directory
-	oldDir, _ := os.Getwd()
-	defer os.Chdir(oldDir)
-	os.Chdir(tmpDir)
-
 	// Create WebServer with base path
 	ws := &WebServer{
-		ctx:             context.Background(),
 		basePath:        "/music",
 		useProxyHeaders: false,
 	}
-
-	// Create a test server to verify no redirects occur
-	mux := http.NewServeMux()
-	fs := http.FileServer(http.Dir("./static"))
-	
-	basePathHandler := func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		
-		if path == ws.basePath || path == ws.basePath+"/" {
-			ws.handleIndex(w, r)
-			return
-		}
-		
-		if strings.HasPrefix(path, ws.basePath+"/") {
-			http.StripPrefix(ws.basePath, fs).ServeHTTP(w, r)
-			return
-		}
-		
-		http.NotFound(w, r)
-	}
-	
-	mux.HandleFunc(ws.basePath, basePathHandler)
-	mux.HandleFunc(ws.basePath+"/", basePathHandler)
+	mux := ws.routes()
 
 	// Test /music without trailing slash - should NOT redirect
 	req := httptest.NewRequest("GET", "/music", nil)
@@ -431,7 +415,7 @@ func TestBasePathNoRedirect(t *testing.T) {
 	mux.ServeHTTP(w, req)
 
 	if w.Code == http.StatusMovedPermanently || w.Code == http.StatusFound {
-		t.Errorf("Expected no redirect for /music, but got %d with Location: %s", 
+		t.Errorf("Expected no redirect for /music, but got %d with Location: %s",
 			w.Code, w.Header().Get("Location"))
 	}
 
@@ -449,6 +433,44 @@ func TestBasePathNoRedirect(t *testing.T) {
 	}
 }
 
+// TestRoutesBasePath tests that the API and web app are served below
+// BASE_PATH only, and that requests are still counted per API route
+func TestRoutesBasePath(t *testing.T) {
+	ws := &WebServer{basePath: "/music", catalog: newFakeCatalog(), metrics: newWebMetrics()}
+	h := ws.middleware(ws.routes())
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/music/api/album-tracks?id=10&name=Fake+Album", http.StatusOK},
+		{"/music/api/track-info?id=999", http.StatusNotFound},
+		{"/music/index.html", http.StatusOK},
+		{"/api/album-tracks?id=10&name=Fake+Album", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+		{"/metrics", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s: expected status %d, got %d", tt.target, tt.want, w.Code)
+		}
+	}
+
+	out := scrape(t, ws)
+	for _, want := range []string{
+		`yamusic_http_requests_total{route="/api/album-tracks",method="GET",status="200"} 1`,
+		`yamusic_http_requests_total{route="/api/track-info",method="GET",status="404"} 1`,
+		`yamusic_http_requests_total{route="static",method="GET",status="200"} 1`,
+		`yamusic_http_requests_total{route="other",method="GET",status="404"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in metrics:\n%s", want, out)
+		}
+	}
+}
+
 // TestXForwardedPrefix tests X-Forwarded-Prefix header support
 func TestXForwardedPrefix(t *testing.T) {
 	// Create a temporary static directory with index.html
@@ -471,13 +493,13 @@ func TestXForwardedPrefix(t *testing.T) {
 
 	// Create WebServer with proxy headers enabled, no static base path
 	ws := &WebServer{
-		ctx:             context.Background(),
 		basePath:        "",
 		useProxyHeaders: true,
 	}
 
-	// Test with X-Forwarded-Prefix header
+	// Test with X-Forwarded-Prefix header from a proxy on the same host
 	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:5000"
 	req.Header.Set("X-Forwarded-Prefix", "/music")
 	w := httptest.NewRecorder()
 
@@ -496,7 +518,7 @@ func TestXForwardedPrefix(t *testing.T) {
 	}
 
 	// Check that BASE_PATH script uses the forwarded prefix
-	if !strings.Contains(body, `window.BASE_PATH = '/music'`) {
+	if !strings.Contains(body, `window.BASE_PATH = "/music"`) {
 		t.Errorf("Expected BASE_PATH script with '/music', but not found in response")
 		t.Logf("Response body: %s", body)
 	}
@@ -524,7 +546,6 @@ func TestXForwardedPrefixFallback(t *testing.T) {
 
 	// Create WebServer with both proxy headers and static base path
 	ws := &WebServer{
-		ctx:             context.Background(),
 		basePath:        "/api",
 		useProxyHeaders: true,
 	}
@@ -548,20 +569,368 @@ func TestXForwardedPrefixFallback(t *testing.T) {
 	}
 
 	// Check that BASE_PATH script uses the static BASE_PATH
-	if !strings.Contains(body, `window.BASE_PATH = '/api'`) {
+	if !strings.Contains(body, `window.BASE_PATH = "/api"`) {
 		t.Errorf("Expected BASE_PATH script with '/api', but not found in response")
 		t.Logf("Response body: %s", body)
 	}
 }
 
+// testStaticFiles returns a minimal web app for index and static file tests
+func testStaticFiles() *staticFiles {
+	return &staticFiles{
+		fsys: fstest.MapFS{
+			"index.html":     {Data: []byte("<head>\n<link href=\"{{asset \"css/styles.css\"}}\">\n</head>\n<body>Test</body>")},
+			"sw.js":          {Data: []byte("const VERSION = {{.Version}};\nconst ASSETS = {{.Assets}};\n")},
+			"css/styles.css": {Data: []byte("body {}")},
+			"static.go":      {Data: []byte("package static")},
+		},
+		version: "v1.2.3",
+	}
+}
+
+// TestXForwardedPrefixHostile tests that prefixes that aren't plain paths
+// are ignored instead of reaching the page
+func TestXForwardedPrefixHostile(t *testing.T) {
+	ws := &WebServer{useProxyHeaders: true, static: testStaticFiles()}
+
+	hostile := []string{
+		`/music';alert(1);//`,
+		`</script><script>alert(1)</script>`,
+		`/"><script>alert(1)</script>`,
+		`javascript:alert(1)`,
+		`//evil.example`,
+		`/music/../..`,
+		`/music/%2e%2e`,
+		"/music\nX-Injected: 1",
+		"/" + strings.Repeat("a", maxPrefixLen),
+	}
+	for _, prefix := range hostile {
+		t.Run(prefix, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Forwarded-Prefix", prefix)
+			w := httptest.NewRecorder()
+
+			ws.handleIndex(w, req)
+
+			body := w.Body.String()
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if !strings.Contains(body, `<base href="/">`) || !strings.Contains(body, `window.BASE_PATH = "";`) {
+				t.Errorf("Expected the root base path, got %s", body)
+			}
+			if strings.Contains(body, "alert") || strings.Contains(body, "evil") {
+				t.Errorf("Prefix leaked into the page: %s", body)
+			}
+		})
+	}
+}
+
+// TestHandleIndexEscapesBasePath tests that the base path is escaped even if
+// it bypassed validation
+func TestHandleIndexEscapesBasePath(t *testing.T) {
+	ws := &WebServer{basePath: `/a"></script><script>alert(1)//`, static: testStaticFiles()}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleIndex(w, req)
+
+	body := w.Body.String()
+	if strings.Contains(body, "<script>alert") || strings.Contains(body, ws.basePath) {
+		t.Errorf("Base path was not escaped: %s", body)
+	}
+}
+
+// TestStaticFiles tests content-hashed asset URLs, their cache headers and
+// the rendered service worker
+func TestStaticFiles(t *testing.T) {
+	files := testStaticFiles()
+	ws := &WebServer{static: files}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	ws.handleIndex(w, req)
+	hashed := regexp.MustCompile(`css/styles\.[0-9a-f]{10}\.css`).FindString(w.Body.String())
+	if hashed == "" {
+		t.Fatalf("Expected a hashed stylesheet URL in the page, got %s", w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Expected the page to be revalidated, got Cache-Control %q", cc)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		files.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w = get("/" + hashed)
+	if w.Code != http.StatusOK || w.Body.String() != "body {}" {
+		t.Fatalf("Unexpected response for %s: %d %q", hashed, w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != immutableCacheControl {
+		t.Errorf("Expected Cache-Control %q for a hashed URL, got %q", immutableCacheControl, cc)
+	}
+	etag := w.Header().Get("ETag")
+
+	w = get("/css/styles.css")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected the plain URL with no-cache, got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	req = httptest.NewRequest("GET", "/css/styles.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	files.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected %d for a matching ETag, got %d", http.StatusNotModified, w.Code)
+	}
+
+	w = get("/sw.js")
+	want := "const VERSION = \"v1.2.3\";\nconst ASSETS = [\"" + hashed + "\"];\n"
+	if w.Body.String() != want {
+		t.Errorf("Unexpected sw.js:\n%s\nwant:\n%s", w.Body.String(), want)
+	}
+
+	for _, path := range []string{"/css/", "/static.go", "/missing.js", "/css/styles.0000000000.css"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("Expected %d for %s, got %d", http.StatusNotFound, path, w.Code)
+		}
+	}
+}
+
+// TestStaticFilesLive tests that -static-dir picks up changed files and
+// versions the service worker by their content
+func TestStaticFilesLive(t *testing.T) {
+	fsys := testStaticFiles().fsys.(fstest.MapFS)
+	files := &staticFiles{fsys: fsys, live: true, version: "v1.2.3"}
+
+	first, err := files.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	fsys["css/styles.css"] = &fstest.MapFile{Data: []byte("body { color: red }")}
+	second, err := files.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if first.version == "v1.2.3" || first.version == second.version {
+		t.Errorf("Expected content versions that change with the files, got %q and %q", first.version, second.version)
+	}
+	if first.byName["css/styles.css"].hashed == second.byName["css/styles.css"].hashed {
+		t.Error("Expected a new hashed URL for the changed stylesheet")
+	}
+}
+
+// TestEmbeddedStaticFiles tests that the embedded web app loads
+func TestEmbeddedStaticFiles(t *testing.T) {
+	site, err := embeddedStatic().load()
+	if err != nil {
+		t.Fatalf("Embedded static files don't load: %v", err)
+	}
+	for _, name := range []string{"css/styles.css", "js/app.js", "manifest.json"} {
+		if _, ok := site.byName[name]; !ok {
+			t.Errorf("Expected %s to be embedded", name)
+		}
+	}
+}
+
+// captureLogs sends the default slog output to a buffer as JSON for the
+// rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+// TestRequestLogging tests the access log entry and request ID handling
+func TestRequestLogging(t *testing.T) {
+	logs := captureLogs(t)
+	ws := &WebServer{}
+	h := ws.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger(r.Context()).Info("handler")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	req := httptest.NewRequest("GET", "/api/search?q=x", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if id := w.Header().Get("X-Request-ID"); id != "abc-123" {
+		t.Errorf("Expected the request ID to be propagated, got %q", id)
+	}
+	var entries []map[string]any
+	dec := json.NewDecoder(logs)
+	for dec.More() {
+		var e map[string]any
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("Log is not JSON: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected a handler and an access log entry, got %v", entries)
+	}
+	if entries[0]["request_id"] != "abc-123" {
+		t.Errorf("Expected the handler's entry to carry the request ID, got %v", entries[0])
+	}
+	access := entries[1]
+	want := map[string]any{"msg": "request", "method": "GET", "path": "/api/search", "status": 418.0, "bytes": 15.0, "client_ip": "192.0.2.1", "request_id": "abc-123"}
+	for k, v := range want {
+		if access[k] != v {
+			t.Errorf("Access log %s = %v, want %v", k, access[k], v)
+		}
+	}
+	if _, ok := access["latency"]; !ok {
+		t.Error("Expected the latency in the access log")
+	}
+
+	// Missing or malformed IDs are replaced with a generated one
+	for _, id := range []string{"", "has space", strings.Repeat("x", maxRequestIDLen+1)} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-ID", id)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got := w.Header().Get("X-Request-ID"); len(got) != 32 {
+			t.Errorf("Expected a generated ID for %q, got %q", id, got)
+		}
+	}
+}
+
+// TestRecoverPanics tests that a panicking handler gets a JSON 500
+func TestRecoverPanics(t *testing.T) {
+	logs := captureLogs(t)
+	ws := &WebServer{}
+	h := ws.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="x.mp3"`)
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest("GET", "/api/download?id=1", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Error == "" {
+		t.Errorf("Expected an ErrorResponse, got %v (%v)", resp, err)
+	}
+	if w.Header().Get("Content-Disposition") != "" {
+		t.Error("Expected the handler's Content-Disposition to be dropped")
+	}
+	if !strings.Contains(logs.String(), `"panic":"boom"`) || !strings.Contains(logs.String(), `"status":500`) {
+		t.Errorf("Expected the panic and a 500 in the logs, got %s", logs.String())
+	}
+}
+
+// TestTrustedProxies tests that X-Forwarded-Prefix is only honored from
+// trusted proxies when TRUSTED_PROXIES is set
+func TestTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.1, ::1")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+	ws := &WebServer{basePath: "/static", useProxyHeaders: true, trustedProxies: proxies}
+
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{"10.1.2.3:5000", "/music"},
+		{"192.0.2.1:5000", "/music"},
+		{"[::1]:5000", "/music"},
+		{"[::ffff:10.0.0.1]:5000", "/music"},
+		{"192.0.2.2:5000", "/static"},
+		{"203.0.113.9:5000", "/static"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set("X-Forwarded-Prefix", "/music")
+		if got := ws.getBasePath(req); got != tt.want {
+			t.Errorf("getBasePath from %s = %q, want %q", tt.remote, got, tt.want)
+		}
+	}
+
+	if _, err := parseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("Expected an error for an invalid CIDR")
+	}
+	if _, err := parseTrustedProxies("proxy.local"); err == nil {
+		t.Error("Expected an error for a host name")
+	}
+}
+
+// TestTrustedProxiesDefault tests that without TRUSTED_PROXIES only
+// loopback peers may set X-Forwarded-Prefix and X-Forwarded-For
+func TestTrustedProxiesDefault(t *testing.T) {
+	ws := &WebServer{basePath: "/static", useProxyHeaders: true}
+
+	tests := []struct {
+		remote string
+		prefix string
+		ip     string
+	}{
+		{"127.0.0.1:5000", "/music", "198.51.100.7"},
+		{"[::1]:5000", "/music", "198.51.100.7"},
+		{"[::ffff:127.0.0.1]:5000", "/music", "198.51.100.7"},
+		{"10.1.2.3:5000", "/static", "10.1.2.3"},
+		{"203.0.113.9:5000", "/static", "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set("X-Forwarded-Prefix", "/music")
+		req.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+		if got := ws.getBasePath(req); got != tt.prefix {
+			t.Errorf("getBasePath from %s = %q, want %q", tt.remote, got, tt.prefix)
+		}
+		if got := ws.clientIP(req); got != tt.ip {
+			t.Errorf("clientIP from %s = %q, want %q", tt.remote, got, tt.ip)
+		}
+	}
+}
+
+// TestCleanPrefix tests base path normalization and validation
+func TestCleanPrefix(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"", "", true},
+		{"/", "", true},
+		{"music", "/music", true},
+		{"/music/", "/music", true},
+		{"/apps/music-1.0_beta~x", "/apps/music-1.0_beta~x", true},
+		{"/music//x", "", false},
+		{"/music/.", "", false},
+		{"/a b", "", false},
+		{"/a?b", "", false},
+		{"/a#b", "", false},
+		{"/a%20b", "", false},
+		{"/музыка", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cleanPrefix(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cleanPrefix(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
 // TestAlbumTracksIntegration tests the album tracks endpoint with actual API
 func TestAlbumTracksIntegration(t *testing.T) {
 	if os.Getenv("YA_MUSIC_TOKEN") == "" || os.Getenv("YA_MUSIC_ID") == "" {
 		t.Skip("Skipping integration test: YA_MUSIC_TOKEN or YA_MUSIC_ID not set")
 	}
 
-	ctx := context.Background()
-	ws, err := NewWebServer(ctx)
+	ws, err := NewWebServer()
 	if err != nil {
 		t.Fatalf("Failed to create web server: %v", err)
 	}
@@ -624,3 +993,1670 @@ func TestAlbumTracksIntegration(t *testing.T) {
 		}
 	}
 }
+
+// TestHandleStreamMissingID tests stream endpoint with missing ID
+func TestHandleStreamMissingID(t *testing.T) {
+	ws := &WebServer{}
+
+	req := httptest.NewRequest("GET", "/api/stream", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleStream(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleStreamInvalidID tests stream endpoint with invalid ID
+func TestHandleStreamInvalidID(t *testing.T) {
+	ws := &WebServer{}
+
+	req := httptest.NewRequest("GET", "/api/stream?id=invalid", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleStream(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var errResp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+
+	if errResp.Error != "invalid track ID" {
+		t.Errorf("Expected 'invalid track ID', got '%s'", errResp.Error)
+	}
+}
+
+// TestProxyAudioRange tests that Range requests are forwarded and partial content is relayed
+func TestProxyAudioRange(t *testing.T) {
+	audio := []byte("ID3fake-mp3-payload-0123456789")
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", `"abc"`)
+		http.ServeContent(w, r, "track.mp3", time.Time{}, bytes.NewReader(audio))
+	}))
+	defer cdn.Close()
+
+	req := httptest.NewRequest("GET", "/api/stream?id=1", nil)
+	req.Header.Set("Range", "bytes=3-9")
+	w := httptest.NewRecorder()
+
+	expired, err := (&WebServer{}).proxyAudio(w, req, cdn.URL)
+	if err != nil || expired {
+		t.Fatalf("proxyAudio returned expired=%v err=%v", expired, err)
+	}
+
+	if w.Code != http.StatusPartialContent {
+		t.Errorf("Expected status %d, got %d", http.StatusPartialContent, w.Code)
+	}
+	if got := w.Body.String(); got != string(audio[3:10]) {
+		t.Errorf("Expected body %q, got %q", audio[3:10], got)
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "7" {
+		t.Errorf("Expected Content-Length 7, got %s", cl)
+	}
+	if cr := w.Header().Get("Content-Range"); cr != fmt.Sprintf("bytes 3-9/%d", len(audio)) {
+		t.Errorf("Unexpected Content-Range: %s", cr)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "audio/mpeg" {
+		t.Errorf("Expected Content-Type audio/mpeg, got %s", ct)
+	}
+
+	// A mismatched If-Range validator must fall back to the full body
+	req = httptest.NewRequest("GET", "/api/stream?id=1", nil)
+	req.Header.Set("Range", "bytes=3-9")
+	req.Header.Set("If-Range", `"stale"`)
+	w = httptest.NewRecorder()
+
+	if _, err := (&WebServer{}).proxyAudio(w, req, cdn.URL); err != nil {
+		t.Fatalf("proxyAudio failed: %v", err)
+	}
+	if w.Code != http.StatusOK || w.Body.Len() != len(audio) {
+		t.Errorf("Expected full 200 response, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+}
+
+// TestProxyAudioExpired tests that a rejected CDN URL is reported as expired without writing a response
+func TestProxyAudioExpired(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer cdn.Close()
+
+	req := httptest.NewRequest("GET", "/api/stream?id=1", nil)
+	w := httptest.NewRecorder()
+
+	expired, err := (&WebServer{}).proxyAudio(w, req, cdn.URL)
+	if !expired || err != nil {
+		t.Errorf("Expected expired=true and no error, got expired=%v err=%v", expired, err)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected nothing written for an expired URL, got %q", w.Body.String())
+	}
+}
+
+// TestHandleDownloadMissingID tests tagged download endpoint with missing ID
+func TestHandleDownloadMissingID(t *testing.T) {
+	ws := &WebServer{}
+
+	req := httptest.NewRequest("GET", "/api/download", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleDownload(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleDownloadInvalidID tests tagged download endpoint with invalid ID
+func TestHandleDownloadInvalidID(t *testing.T) {
+	ws := &WebServer{}
+
+	req := httptest.NewRequest("GET", "/api/download?id=invalid", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleDownload(w, req)
+
+	var errResp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+
+	if w.Code != http.StatusBadRequest || errResp.Error != "invalid track ID" {
+		t.Errorf("Expected 400 'invalid track ID', got %d '%s'", w.Code, errResp.Error)
+	}
+}
+
+// TestHandleDownloadNoURL tests that a track without a download URL is
+// answered like other upstream errors
+func TestHandleDownloadNoURL(t *testing.T) {
+	ws := &WebServer{catalog: newFakeCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/download?id=101", nil)
+	w := httptest.NewRecorder()
+	ws.handleDownload(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+}
+
+// TestHandleDownloadFilename tests that Cyrillic titles survive the
+// Content-Disposition header
+func TestHandleDownloadFilename(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xfbaudio"))
+	}))
+	defer cdn.Close()
+
+	fake := catalog.NewFake()
+	fake.AddAlbum(catalog.Album{ID: 20, Title: "Альбом", Volumes: [][]catalog.Track{{
+		{ID: 200, Title: `Say "Привет"`, Available: true, Artists: []catalog.Artist{{ID: 7, Name: "Группа"}}},
+	}}})
+	fake.DownloadURLs[200] = cdn.URL + "/200.mp3"
+	ws := &WebServer{catalog: fake, client: cdn.Client()}
+
+	req := httptest.NewRequest("GET", "/api/download?id=200", nil)
+	w := httptest.NewRecorder()
+	ws.handleDownload(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	if err != nil || disposition != "attachment" {
+		t.Fatalf("Unparsable Content-Disposition %q: %v", w.Header().Get("Content-Disposition"), err)
+	}
+	// Quotes are replaced by the naming template; the header is not broken
+	if want := "Say _Привет_ - Группа.mp3"; params["filename"] != want {
+		t.Errorf("Expected filename %q, got %q", want, params["filename"])
+	}
+}
+
+// TestAttachment tests Content-Disposition values for awkward file names
+func TestAttachment(t *testing.T) {
+	for _, name := range []string{"plain.mp3", `say "hi".mp3`, "Привет.zip", `back\slash;semi.mp3`} {
+		disposition, params, err := mime.ParseMediaType(attachment(name))
+		if err != nil || disposition != "attachment" || params["filename"] != name {
+			t.Errorf("attachment(%q) = %q, parsed as %q %v, %v", name, attachment(name), disposition, params, err)
+		}
+	}
+}
+
+// TestAlbumTag tests that album volumes map to track and disc numbers
+func TestAlbumTag(t *testing.T) {
+	album := &catalog.Album{
+		Title:   "Double Album",
+		Year:    1999,
+		Genre:   "rock",
+		Artists: []catalog.Artist{{Name: "Band"}},
+		Volumes: [][]catalog.Track{
+			{{ID: 1, Title: "One"}, {ID: 2, Title: "Two"}},
+			{{ID: 3, Title: "Three", Version: "Live", Artists: []catalog.Artist{{Name: "Band"}, {Name: "Guest"}}}},
+		},
+	}
+
+	vol, idx, ok := album.Find(3)
+	if !ok || vol != 1 || idx != 0 {
+		t.Fatalf("Expected track 3 at volume 1 index 0, got %d/%d (found=%v)", vol, idx, ok)
+	}
+
+	tag := albumTag(album, vol, idx)
+	if tag.Track != 1 || tag.TrackTotal != 1 || tag.Disc != 2 || tag.DiscTotal != 2 {
+		t.Errorf("Unexpected position %d/%d disc %d/%d", tag.Track, tag.TrackTotal, tag.Disc, tag.DiscTotal)
+	}
+	if tag.Title != "Three (Live)" || tag.AlbumArtist != "Band" || len(tag.Artists) != 2 || tag.Year != 1999 || tag.Genre != "rock" {
+		t.Errorf("Unexpected tag fields: %+v", tag)
+	}
+}
+
+// newFakeCatalog returns a fake catalog holding one album with two tracks
+func newFakeCatalog() *catalog.Fake {
+	fake := catalog.NewFake()
+	fake.AddAlbum(catalog.Album{
+		ID:         10,
+		Title:      "Fake Album",
+		Year:       2020,
+		CoverURI:   "avatars.example/10/%%",
+		TrackCount: 2,
+		Artists:    []catalog.Artist{{ID: 5, Name: "Fake Artist"}},
+		Volumes: [][]catalog.Track{{
+			{ID: 100, Title: "First Song", DurationMs: 1000, Available: true, Artists: []catalog.Artist{{ID: 5, Name: "Fake Artist"}}},
+			{ID: 101, Title: "Second Song", DurationMs: 2000, Available: false, Artists: []catalog.Artist{{ID: 5, Name: "Fake Artist"}, {ID: 6, Name: "Guest"}}},
+		}},
+	})
+	fake.DownloadURLs[100] = "https://cdn.example/100.mp3"
+	return fake
+}
+
+// TestHandleSearchFake tests search results against the fake catalog
+func TestHandleSearchFake(t *testing.T) {
+	ws := &WebServer{catalog: newFakeCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/search?q=song", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleSearch(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var resp SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode search response: %v", err)
+	}
+
+	if len(resp.Tracks) != 2 || resp.Total != 2 {
+		t.Fatalf("Expected 2 tracks, got %d (total %d)", len(resp.Tracks), resp.Total)
+	}
+	second := resp.Tracks[1]
+	if second.Artist != "Fake Artist, Guest" || second.Album != "Fake Album" || second.AlbumID != 10 || second.Available {
+		t.Errorf("Unexpected track response: %+v", second)
+	}
+	if second.CoverURL != "https://avatars.example/10/%%" {
+		t.Errorf("Unexpected cover URL: %s", second.CoverURL)
+	}
+}
+
+// TestHandleSearchUpstreamError tests that upstream failures surface as errors
+func TestHandleSearchUpstreamError(t *testing.T) {
+	fake := newFakeCatalog()
+	fake.Err = &catalog.StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	ws := &WebServer{catalog: fake}
+
+	req := httptest.NewRequest("GET", "/api/search?q=song", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleSearch(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	fake.Err = errors.New("connection reset")
+	w = httptest.NewRecorder()
+	ws.handleSearch(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+// TestHandleSearchPaging tests type filtering and paging through search results
+func TestHandleSearchPaging(t *testing.T) {
+	ws := &WebServer{catalog: newFakeCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/search?q=song&type=track&page=0&pageSize=1", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleSearch(w, req)
+
+	var resp SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode search response: %v", err)
+	}
+	if len(resp.Tracks) != 1 || resp.Tracks[0].ID != 100 || len(resp.Albums) != 0 {
+		t.Fatalf("Expected only the first track, got %+v", resp)
+	}
+	if resp.Type != "track" || resp.PageSize != 1 || resp.Totals["track"] != 2 || !resp.HasMore || resp.NextPage == nil || *resp.NextPage != 1 {
+		t.Errorf("Unexpected paging info: %+v", resp)
+	}
+
+	// The last page has no next page
+	req = httptest.NewRequest("GET", "/api/search?q=song&type=track&page=1&pageSize=1", nil)
+	w = httptest.NewRecorder()
+	ws.handleSearch(w, req)
+
+	resp = SearchResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode search response: %v", err)
+	}
+	if len(resp.Tracks) != 1 || resp.Tracks[0].ID != 101 || resp.HasMore || resp.NextPage != nil {
+		t.Errorf("Unexpected last page: %+v", resp)
+	}
+
+	// Albums only
+	req = httptest.NewRequest("GET", "/api/search?q=fake&type=album", nil)
+	w = httptest.NewRecorder()
+	ws.handleSearch(w, req)
+
+	resp = SearchResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode search response: %v", err)
+	}
+	if len(resp.Albums) != 1 || len(resp.Tracks) != 0 || len(resp.Artists) != 0 {
+		t.Errorf("Expected only albums, got %+v", resp)
+	}
+
+	for _, query := range []string{"type=video", "page=-1", "pageSize=0", "pageSize=abc"} {
+		req = httptest.NewRequest("GET", "/api/search?q=song&"+query, nil)
+		w = httptest.NewRecorder()
+		ws.handleSearch(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+// TestHandleAlbumTracksFake tests album track listing against the fake catalog
+func TestHandleAlbumTracksFake(t *testing.T) {
+	ws := &WebServer{catalog: newFakeCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/album-tracks?id=10&name=Fake+Album", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleAlbumTracks(w, req)
+
+	var resp SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || len(resp.Tracks) != 2 || resp.Tracks[0].Title != "First Song" {
+		t.Errorf("Unexpected album tracks response %d: %+v", w.Code, resp)
+	}
+
+	// Unknown album
+	req = httptest.NewRequest("GET", "/api/album-tracks?id=99&name=Missing", nil)
+	w = httptest.NewRecorder()
+	ws.handleAlbumTracks(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown album, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestHandleArtistTracksFake tests the paginated artist track list
+func TestHandleArtistTracksFake(t *testing.T) {
+	ws := &WebServer{catalog: newFakeCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/artist-tracks?id=6", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleArtistTracks(w, req)
+
+	var resp TrackPageResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Tracks) != 1 || resp.Tracks[0].ID != 101 {
+		t.Errorf("Expected only track 101, got %+v", resp.Tracks)
+	}
+
+	// Second page of one track each
+	req = httptest.NewRequest("GET", "/api/artist-tracks?id=5&page=1&pageSize=1", nil)
+	w = httptest.NewRecorder()
+	ws.handleArtistTracks(w, req)
+
+	resp = TrackPageResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Tracks) != 1 || resp.Tracks[0].ID != 101 || resp.Total != 2 || resp.HasMore {
+		t.Errorf("Unexpected second page: %+v", resp)
+	}
+
+	// Out of range page size
+	req = httptest.NewRequest("GET", "/api/artist-tracks?id=5&pageSize=1000", nil)
+	w = httptest.NewRecorder()
+	ws.handleArtistTracks(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a huge page size, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleArtistMissingID tests artist endpoint without an ID
+func TestHandleArtistMissingID(t *testing.T) {
+	ws := &WebServer{}
+
+	req := httptest.NewRequest("GET", "/api/artist", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleArtist(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleArtistFake tests the artist page against the fake catalog
+func TestHandleArtistFake(t *testing.T) {
+	fake := newFakeCatalog()
+	fake.AddAlbum(catalog.Album{
+		ID:      11,
+		Title:   "Fake Single",
+		Type:    catalog.AlbumSingle,
+		Artists: []catalog.Artist{{ID: 5, Name: "Fake Artist"}},
+		Volumes: [][]catalog.Track{{{ID: 102, Title: "Single Song", Available: true, Artists: []catalog.Artist{{ID: 5, Name: "Fake Artist"}}}}},
+	})
+	fake.Similar[5] = []catalog.Artist{{ID: 6, Name: "Guest"}}
+	ws := &WebServer{catalog: fake}
+
+	req := httptest.NewRequest("GET", "/api/artist?id=5", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleArtist(w, req)
+
+	var resp ArtistPageResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || resp.Artist.Name != "Fake Artist" || len(resp.PopularTracks) != 3 || resp.Tracks.Total != 3 {
+		t.Fatalf("Unexpected artist page %d: %+v", w.Code, resp)
+	}
+	if len(resp.Albums) != 1 || len(resp.Singles) != 1 || resp.Singles[0].Title != "Fake Single" || len(resp.Compilations) != 0 {
+		t.Errorf("Unexpected releases: albums=%+v singles=%+v", resp.Albums, resp.Singles)
+	}
+	if len(resp.Similar) != 1 || resp.Similar[0].Name != "Guest" {
+		t.Errorf("Unexpected similar artists: %+v", resp.Similar)
+	}
+
+	// The guest only appears on the album
+	req = httptest.NewRequest("GET", "/api/artist?id=6", nil)
+	w = httptest.NewRecorder()
+	ws.handleArtist(w, req)
+
+	resp = ArtistPageResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Albums) != 0 || len(resp.AppearsOn) != 1 || resp.AppearsOn[0].ID != 10 {
+		t.Errorf("Expected one appearance, got albums=%+v appearsOn=%+v", resp.Albums, resp.AppearsOn)
+	}
+
+	req = httptest.NewRequest("GET", "/api/artist?id=99", nil)
+	w = httptest.NewRecorder()
+	ws.handleArtist(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown artist, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestHandleTrackInfoFake tests track info lookups against the fake catalog
+func TestHandleTrackInfoFake(t *testing.T) {
+	ws := &WebServer{catalog: newFakeCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/track-info?id=100", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleTrackInfo(w, req)
+
+	var track TrackResponse
+	if err := json.NewDecoder(w.Body).Decode(&track); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || track.ID != 100 || track.Album != "Fake Album" || track.Duration != 1000 {
+		t.Errorf("Unexpected track info %d: %+v", w.Code, track)
+	}
+
+	req = httptest.NewRequest("GET", "/api/track-info?id=999", nil)
+	w = httptest.NewRecorder()
+	ws.handleTrackInfo(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown track, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestHandleLyricsFake tests synced, plain and missing lyrics
+func TestHandleLyricsFake(t *testing.T) {
+	fake := newFakeCatalog()
+	fake.TrackLyrics[100] = &catalog.Lyrics{
+		Text:    "Hello\nWorld",
+		Lines:   []catalog.LyricLine{{Time: 1500 * time.Millisecond, Text: "Hello"}, {Time: 3 * time.Second, Text: "World"}},
+		Writers: []string{"Fake Writer"},
+	}
+	fake.TrackLyrics[101] = &catalog.Lyrics{Text: "Just words"}
+	ws := &WebServer{catalog: fake}
+
+	get := func(query string) (*httptest.ResponseRecorder, LyricsResponse) {
+		req := httptest.NewRequest("GET", "/api/lyrics?"+query, nil)
+		w := httptest.NewRecorder()
+		ws.handleLyrics(w, req)
+		var resp LyricsResponse
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return w, resp
+	}
+
+	w, resp := get("id=100")
+	if w.Code != http.StatusOK || !resp.Synced || resp.TrackID != 100 || len(resp.Lines) != 2 {
+		t.Fatalf("Unexpected synced lyrics %d: %+v", w.Code, resp)
+	}
+	if resp.Lines[0].TimeMs != 1500 || resp.Lines[1].Text != "World" || resp.Text != "Hello\nWorld" {
+		t.Errorf("Unexpected synced lines: %+v", resp)
+	}
+
+	w, resp = get("id=101")
+	if w.Code != http.StatusOK || resp.Synced || resp.Text != "Just words" || resp.Lines != nil {
+		t.Errorf("Unexpected plain lyrics %d: %+v", w.Code, resp)
+	}
+
+	delete(fake.TrackLyrics, 101)
+	for query, want := range map[string]int{
+		"id=101": http.StatusNotFound,
+		"id=999": http.StatusNotFound,
+		"id=abc": http.StatusBadRequest,
+		"":       http.StatusBadRequest,
+	} {
+		w, _ := get(query)
+		if w.Code != want {
+			t.Errorf("%q: expected status %d, got %d", query, want, w.Code)
+		}
+	}
+	w, _ = get("id=101")
+	var errResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errResp)
+	if !strings.Contains(errResp.Error, "no lyrics") {
+		t.Errorf("Expected a no lyrics error, got %q", errResp.Error)
+	}
+
+	// Track info says up front whether there is anything to show
+	fake.Tracks[100].HasLyrics = true
+	fake.Tracks[100].HasSyncedLyrics = true
+	req := httptest.NewRequest("GET", "/api/track-info?id=100", nil)
+	rec := httptest.NewRecorder()
+	ws.handleTrackInfo(rec, req)
+	var info TrackInfoResponse
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode track info: %v", err)
+	}
+	if !info.HasLyrics || !info.SyncedLyrics || info.ID != 100 {
+		t.Errorf("Expected lyrics flags in track info, got %+v", info)
+	}
+}
+
+// TestHandleDownloadURLFake tests download URL lookups against the fake catalog
+func TestHandleDownloadURLFake(t *testing.T) {
+	ws := &WebServer{catalog: newFakeCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/download-url?id=100", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleDownloadURL(w, req)
+
+	var resp DownloadURLResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.URL != "https://cdn.example/100.mp3" {
+		t.Errorf("Unexpected URL: %s", resp.URL)
+	}
+
+	req = httptest.NewRequest("GET", "/api/download-url?id=101", nil)
+	w = httptest.NewRecorder()
+	ws.handleDownloadURL(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d without a URL, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestHandleStreamFake tests the stream proxy end to end with a fake CDN
+func TestHandleStreamFake(t *testing.T) {
+	audio := []byte("fake-mp3-bytes")
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "track.mp3", time.Time{}, bytes.NewReader(audio))
+	}))
+	defer cdn.Close()
+
+	fake := newFakeCatalog()
+	fake.DownloadURLs[100] = cdn.URL
+	ws := &WebServer{catalog: fake, streamURLs: newURLCache()}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/api/stream?id=100", nil)
+		w := httptest.NewRecorder()
+		ws.handleStream(w, req)
+
+		if w.Code != http.StatusOK || w.Body.String() != string(audio) {
+			t.Fatalf("Unexpected stream response %d: %q", w.Code, w.Body.String())
+		}
+	}
+
+	// The second request must reuse the cached download URL
+	if fake.Calls["DownloadURL"] != 1 {
+		t.Errorf("Expected 1 DownloadURL call, got %d", fake.Calls["DownloadURL"])
+	}
+}
+
+// TestHandleStreamUpstreamError tests that catalog failures map to the same
+// statuses as the other handlers
+func TestHandleStreamUpstreamError(t *testing.T) {
+	fake := newFakeCatalog()
+	ws := &WebServer{catalog: fake, streamURLs: newURLCache()}
+
+	req := httptest.NewRequest("GET", "/api/stream?id=101", nil)
+	w := httptest.NewRecorder()
+	ws.handleStream(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d without a URL, got %d", http.StatusNotFound, w.Code)
+	}
+
+	fake.Err = upstream.ErrCircuitOpen
+	req = httptest.NewRequest("GET", "/api/stream?id=100", nil)
+	w = httptest.NewRecorder()
+	ws.handleStream(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d with the breaker open, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+// TestHandleAlbumZipFake tests that the album zip contains tagged tracks
+func TestHandleAlbumZipFake(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xfbaudio"))
+	}))
+	defer cdn.Close()
+
+	fake := newFakeCatalog()
+	fake.DownloadURLs[100] = cdn.URL
+	fake.Albums[10].CoverURI = "" // no cover fetch from the test
+	ws := &WebServer{catalog: fake}
+
+	req := httptest.NewRequest("GET", "/api/album-zip?id=10&name=Fake+Album", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleAlbumZip(w, req)
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Response is not a zip: %v", err)
+	}
+	// Track 101 is unavailable, so only one entry is expected
+	if len(zr.File) != 1 || zr.File[0].Name != "01. Fake Artist - First Song.mp3" {
+		t.Fatalf("Unexpected zip entries: %v", zr.File)
+	}
+	f, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatalf("Failed to open zip entry: %v", err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	if !bytes.HasPrefix(data, []byte("ID3")) || !bytes.Contains(data, []byte("Fake Album")) {
+		t.Errorf("Expected an ID3 tag with the album title, got %q", data)
+	}
+}
+
+// TestHandleAlbumZipTemplate tests that entries follow the zip naming template
+func TestHandleAlbumZipTemplate(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xfbaudio"))
+	}))
+	defer cdn.Close()
+
+	fake := newFakeCatalog()
+	fake.DownloadURLs[100] = cdn.URL
+	fake.Albums[10].CoverURI = ""
+	ws := &WebServer{catalog: fake, zipTemplate: naming.MustParse("{albumartist}/{album}/{disc}-{track} {title}[ ({version})]")}
+
+	req := httptest.NewRequest("GET", "/api/album-zip?id=10&name=Fake+Album", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleAlbumZip(w, req)
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Response is not a zip: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "Fake Artist/Fake Album/1-01 First Song.mp3" {
+		t.Fatalf("Unexpected zip entries: %v", zr.File)
+	}
+}
+
+// TestHandleAlbumZipFlakyCDN tests that a track survives a transient CDN error
+func TestHandleAlbumZipFlakyCDN(t *testing.T) {
+	var hits int
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("\xff\xfbaudio"))
+	}))
+	defer cdn.Close()
+
+	fake := newFakeCatalog()
+	fake.DownloadURLs[100] = cdn.URL
+	fake.Albums[10].CoverURI = ""
+	ws := &WebServer{catalog: fake, client: upstream.NewClient(upstream.Config{BaseDelay: time.Millisecond})}
+
+	req := httptest.NewRequest("GET", "/api/album-zip?id=10&name=Fake+Album", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleAlbumZip(w, req)
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Response is not a zip: %v", err)
+	}
+	if len(zr.File) != 1 || hits != 2 {
+		t.Errorf("Expected the track after one retry, got %d entries after %d CDN hits", len(zr.File), hits)
+	}
+}
+
+// TestHandleAlbumZipBrokenTrack tests that a track cut off mid-transfer is
+// counted as skipped and named in the archive's error listing
+func TestHandleAlbumZipBrokenTrack(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Promise more than is sent, so the body ends early
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte("\xff\xfbaudio"))
+	}))
+	defer cdn.Close()
+
+	fake := newFakeCatalog()
+	fake.DownloadURLs[100] = cdn.URL
+	fake.Albums[10].CoverURI = ""
+	ws := &WebServer{catalog: fake, metrics: newWebMetrics()}
+
+	w := httptest.NewRecorder()
+	ws.handleAlbumZip(w, httptest.NewRequest("GET", "/api/album-zip?id=10&name=Fake+Album", nil))
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Response is not a zip: %v", err)
+	}
+	if len(zr.File) != 2 || zr.File[1].Name != zipErrorsName {
+		t.Fatalf("Expected the track and an error listing, got %v", zr.File)
+	}
+	f, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatalf("Failed to open error listing: %v", err)
+	}
+	defer f.Close()
+	listing, _ := io.ReadAll(f)
+	if !strings.Contains(string(listing), "01. Fake Artist - First Song.mp3: incomplete") {
+		t.Errorf("Expected the broken track in the listing, got %q", listing)
+	}
+	if out := scrape(t, ws); !strings.Contains(out, `yamusic_zip_tracks_skipped_total{reason="copy"} 1`) {
+		t.Errorf("Expected the broken track to count as skipped:\n%s", out)
+	}
+}
+
+// TestHandleAlbumZipCancelled tests that the zip streamer stops fetching
+// tracks once the client goes away
+func TestHandleAlbumZipCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var hits int
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		cancel() // the client disconnects while the first track is downloading
+		w.Write([]byte("\xff\xfbaudio"))
+	}))
+	defer cdn.Close()
+
+	fake := newFakeCatalog()
+	fake.Albums[10].Volumes[0][1].Available = true
+	fake.DownloadURLs[100] = cdn.URL
+	fake.DownloadURLs[101] = cdn.URL
+	fake.Albums[10].CoverURI = ""
+	ws := &WebServer{catalog: fake}
+
+	req := httptest.NewRequest("GET", "/api/album-zip?id=10&name=Fake+Album", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	ws.handleAlbumZip(w, req)
+
+	if hits != 1 {
+		t.Errorf("Expected the CDN to be hit once, got %d", hits)
+	}
+	if fake.Calls["DownloadURL"] > 1 {
+		t.Errorf("Expected no download URL requests after cancellation, got %d", fake.Calls["DownloadURL"])
+	}
+}
+
+// TestSearchEmulated runs the search handler against the Yandex API emulator,
+// exercising the real yamusic-backed catalog without credentials
+func TestSearchEmulated(t *testing.T) {
+	srv := yandextest.NewServer(os.DirFS("../../internal/catalog/testdata/yandex"))
+	defer srv.Close()
+
+	ws := &WebServer{catalog: catalog.NewYandex(srv.Client(), srv.HTTPClient(), 1)}
+
+	req := httptest.NewRequest("GET", "/api/search?q=chick+corea", nil)
+	w := httptest.NewRecorder()
+
+	ws.handleSearch(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var resp SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode search response: %v", err)
+	}
+	if len(resp.Tracks) != 2 || len(resp.Albums) != 1 || len(resp.Artists) != 1 || !resp.MisspellCorrected {
+		t.Errorf("Unexpected emulated search response: %+v", resp)
+	}
+}
+
+// TestResponseCacheLRU tests expiry and least-recently-used eviction
+func TestResponseCacheLRU(t *testing.T) {
+	c := newResponseCache(2)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	calls := 0
+	fetch := func(v string) func(context.Context) (interface{}, error) {
+		return func(context.Context) (interface{}, error) {
+			calls++
+			return v, nil
+		}
+	}
+	ctx := context.Background()
+
+	c.do(ctx, "a", time.Minute, fetch("a"))
+	c.do(ctx, "b", time.Hour, fetch("b"))
+	if v, hit, _ := c.do(ctx, "a", time.Minute, fetch("a2")); !hit || v != "a" {
+		t.Errorf("Expected a cache hit for 'a', got %v (hit=%v)", v, hit)
+	}
+
+	// 'b' is now the least recently used and gets evicted by 'c'
+	c.do(ctx, "c", time.Hour, fetch("c"))
+	if _, hit, _ := c.do(ctx, "b", time.Hour, fetch("b")); hit {
+		t.Error("Expected 'b' to be evicted")
+	}
+
+	// 'a' expires after its TTL
+	now = now.Add(2 * time.Minute)
+	if v, hit, _ := c.do(ctx, "a", time.Minute, fetch("a2")); hit || v != "a2" {
+		t.Errorf("Expected expired 'a' to be refetched, got %v (hit=%v)", v, hit)
+	}
+	if calls != 5 {
+		t.Errorf("Expected 5 fetches, got %d", calls)
+	}
+
+	// Errors are not cached
+	c.do(ctx, "err", time.Hour, func(context.Context) (interface{}, error) { return nil, errors.New("boom") })
+	if _, hit, err := c.do(ctx, "err", time.Hour, fetch("ok")); hit || err != nil {
+		t.Errorf("Expected the failed fetch to be retried, got hit=%v err=%v", hit, err)
+	}
+}
+
+// TestResponseCacheSingleflight tests that concurrent misses share one fetch
+func TestResponseCacheSingleflight(t *testing.T) {
+	c := newResponseCache(10)
+	release := make(chan struct{})
+	calls := 0
+	var mu sync.Mutex
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, err := c.do(context.Background(), "k", time.Minute, func(context.Context) (interface{}, error) {
+				mu.Lock()
+				calls++
+				mu.Unlock()
+				<-release
+				return "v", nil
+			})
+			if err != nil || v != "v" {
+				t.Errorf("Unexpected result %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls)
+	}
+}
+
+// TestResponseCachePanic tests that a panicking fetch fails the callers
+// waiting for it and doesn't leave the key stuck
+func TestResponseCachePanic(t *testing.T) {
+	c := newResponseCache(10)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	leader := make(chan interface{})
+	go func() {
+		defer func() { leader <- recover() }()
+		c.do(context.Background(), "k", time.Minute, func(context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waiter := make(chan error)
+	go func() {
+		v, _, err := c.do(context.Background(), "k", time.Minute, func(context.Context) (interface{}, error) {
+			return "unexpected", nil
+		})
+		if v != nil {
+			t.Errorf("Expected no value for the waiter, got %v", v)
+		}
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if v := <-leader; v != "boom" {
+		t.Errorf("Expected the panic to reach the leader's caller, got %v", v)
+	}
+	if err := <-waiter; err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected the waiter to get the panic as an error, got %v", err)
+	}
+
+	// The key can be fetched again
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	v, _, err := c.do(ctx, "k", time.Minute, func(context.Context) (interface{}, error) { return "v", nil })
+	if err != nil || v != "v" {
+		t.Errorf("Expected a fresh fetch after the panic, got %v, %v", v, err)
+	}
+}
+
+// TestHandleAlbumTracksCached tests the X-Cache header and that a repeated
+// request doesn't reach the catalog
+func TestHandleAlbumTracksCached(t *testing.T) {
+	fake := newFakeCatalog()
+	ws := &WebServer{catalog: fake, cache: newResponseCache(defaultCacheSize)}
+
+	for _, want := range []string{"MISS", "HIT"} {
+		req := httptest.NewRequest("GET", "/api/album-tracks?id=10&name=Fake+Album", nil)
+		w := httptest.NewRecorder()
+		ws.handleAlbumTracks(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("X-Cache") != want {
+			t.Errorf("Expected %d with X-Cache %s, got %d with %q", http.StatusOK, want, w.Code, w.Header().Get("X-Cache"))
+		}
+	}
+	if fake.Calls["AlbumWithTracks"] != 1 {
+		t.Errorf("Expected 1 AlbumWithTracks call, got %d", fake.Calls["AlbumWithTracks"])
+	}
+}
+
+// newPlaylistCatalog returns the fake catalog with an account (uid 1), one
+// liked track and one playlist (kind 1000, revision 5) holding both tracks
+func newPlaylistCatalog() *catalog.Fake {
+	fake := newFakeCatalog()
+	fake.UID = 1
+	fake.Liked = []int{100}
+	fake.LikedRev = 9
+	fake.AddPlaylist(catalog.Playlist{
+		OwnerUID: 1,
+		Kind:     1000,
+		Title:    "Mix",
+		Revision: 5,
+		Tracks:   []catalog.Track{*fake.Tracks[100], *fake.Tracks[101]},
+	})
+	return fake
+}
+
+// playlistRequest sends a JSON POST to a playlist handler and decodes the
+// returned playlist
+func playlistRequest(t *testing.T, handler http.HandlerFunc, body string) (int, PlaylistResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/playlist", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	var resp PlaylistResponse
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode playlist: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+// TestHandlePlaylistsFake tests that the liked playlist is listed first
+func TestHandlePlaylistsFake(t *testing.T) {
+	ws := &WebServer{catalog: newPlaylistCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/playlists", nil)
+	w := httptest.NewRecorder()
+	ws.handlePlaylists(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp PlaylistsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode playlists: %v", err)
+	}
+	if len(resp.Playlists) != 2 || resp.Playlists[0].Kind != catalog.LikedKind || resp.Playlists[0].TrackCount != 1 {
+		t.Fatalf("Unexpected playlists: %+v", resp.Playlists)
+	}
+	if p := resp.Playlists[1]; p.Kind != 1000 || p.Title != "Mix" || p.Revision != 5 || p.TrackCount != 2 {
+		t.Errorf("Unexpected playlist: %+v", p)
+	}
+}
+
+// TestHandlePlaylistFake tests fetching a playlist's tracks
+func TestHandlePlaylistFake(t *testing.T) {
+	ws := &WebServer{catalog: newPlaylistCatalog()}
+
+	req := httptest.NewRequest("GET", "/api/playlist?owner=1&kind=1000", nil)
+	w := httptest.NewRecorder()
+	ws.handlePlaylist(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp PlaylistTracksResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode playlist: %v", err)
+	}
+	if resp.Playlist.Title != "Mix" || len(resp.Tracks) != 2 || resp.Tracks[1].ID != 101 || resp.Tracks[1].AlbumID != 10 {
+		t.Errorf("Unexpected playlist response: %+v", resp)
+	}
+
+	for _, query := range []string{"", "?kind=abc", "?kind=1000&owner=x"} {
+		req := httptest.NewRequest("GET", "/api/playlist"+query, nil)
+		w := httptest.NewRecorder()
+		ws.handlePlaylist(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+// TestHandlePlaylistEditFake tests create, rename, add, move and remove,
+// each based on the revision returned by the previous edit
+func TestHandlePlaylistEditFake(t *testing.T) {
+	fake := newPlaylistCatalog()
+	ws := &WebServer{catalog: fake}
+
+	code, created := playlistRequest(t, ws.handleCreatePlaylist, `{"title": " New "}`)
+	if code != http.StatusOK || created.Title != "New" || created.Kind != 1001 {
+		t.Fatalf("Unexpected create result %d: %+v", code, created)
+	}
+
+	code, p := playlistRequest(t, ws.handleRenamePlaylist, `{"kind": 1000, "title": "Renamed"}`)
+	if code != http.StatusOK || p.Title != "Renamed" || p.Revision != 6 {
+		t.Fatalf("Unexpected rename result %d: %+v", code, p)
+	}
+
+	code, p = playlistRequest(t, ws.handlePlaylistAdd, `{"kind": 1000, "revision": 6, "trackIds": [101]}`)
+	if code != http.StatusOK || p.TrackCount != 3 || p.Revision != 7 {
+		t.Fatalf("Unexpected add result %d: %+v", code, p)
+	}
+	code, p = playlistRequest(t, ws.handlePlaylistMove, `{"kind": 1000, "revision": 7, "from": 0, "to": 2}`)
+	if code != http.StatusOK || p.Revision != 8 {
+		t.Fatalf("Unexpected move result %d: %+v", code, p)
+	}
+	code, p = playlistRequest(t, ws.handlePlaylistRemove, `{"kind": 1000, "revision": 8, "from": 0}`)
+	if code != http.StatusOK || p.TrackCount != 2 || p.Revision != 9 {
+		t.Fatalf("Unexpected remove result %d: %+v", code, p)
+	}
+
+	// [100 101 101] -> move -> [101 101 100] -> remove first -> [101 100]
+	got, _ := fake.Playlist(context.Background(), 1, 1000)
+	if got.Tracks[0].ID != 101 || got.Tracks[1].ID != 100 {
+		t.Errorf("Unexpected track order: %d, %d", got.Tracks[0].ID, got.Tracks[1].ID)
+	}
+}
+
+// TestHandlePlaylistEditErrors tests stale revisions, the read-only liked
+// playlist and invalid requests
+func TestHandlePlaylistEditErrors(t *testing.T) {
+	ws := &WebServer{catalog: newPlaylistCatalog()}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		want    int
+	}{
+		{"stale add", ws.handlePlaylistAdd, `{"kind": 1000, "revision": 4, "trackIds": [100]}`, http.StatusConflict},
+		{"stale add at", ws.handlePlaylistAdd, `{"kind": 1000, "revision": 4, "trackIds": [100], "at": 0}`, http.StatusConflict},
+		{"stale move", ws.handlePlaylistMove, `{"kind": 1000, "revision": 4, "from": 0, "to": 1}`, http.StatusConflict},
+		{"liked", ws.handlePlaylistRemove, `{"kind": 3, "revision": 9, "from": 0}`, http.StatusForbidden},
+		{"unknown track", ws.handlePlaylistAdd, `{"kind": 1000, "revision": 5, "trackIds": [999]}`, http.StatusNotFound},
+		{"move out of range", ws.handlePlaylistMove, `{"kind": 1000, "revision": 5, "from": 0, "to": 7}`, http.StatusBadRequest},
+		{"bad range", ws.handlePlaylistRemove, `{"kind": 1000, "revision": 5, "from": 2, "to": 1}`, http.StatusBadRequest},
+		{"empty title", ws.handleCreatePlaylist, `{"title": "  "}`, http.StatusBadRequest},
+		{"bad json", ws.handleRenamePlaylist, `{"kind": `, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code, _ := playlistRequest(t, tt.handler, tt.body); code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/playlists/create", nil)
+	w := httptest.NewRecorder()
+	ws.handleCreatePlaylist(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for GET, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+// TestHandlePlaylistCrossOrigin tests that other sites can't edit
+// playlists through the server, with or without a CORS preflight
+func TestHandlePlaylistCrossOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		headers     map[string]string
+		want        int
+	}{
+		{"text/plain form", "text/plain", map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, http.StatusUnsupportedMediaType},
+		{"no content type", "", nil, http.StatusUnsupportedMediaType},
+		{"cross-site", "application/json", map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"same-site", "application/json", map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"foreign origin", "application/json", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"same origin", "application/json; charset=utf-8", map[string]string{"Origin": "http://example.com", "Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"old browser", "application/json", map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+		{"not a browser", "application/json", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		fake := newPlaylistCatalog()
+		ws := &WebServer{catalog: fake}
+		req := httptest.NewRequest("POST", "/api/playlists/create", strings.NewReader(`{"title": "Pwned"}`))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		enableCORS(ws.handleCreatePlaylist)(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+		if created := fake.Calls["CreatePlaylist"] > 0; created != (tt.want == http.StatusOK) {
+			t.Errorf("%s: playlist created: %v", tt.name, created)
+		}
+	}
+}
+
+// libraryRequest sends a JSON POST to a library handler
+func libraryRequest(t *testing.T, handler http.HandlerFunc, body string) (int, LikeResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/library/like", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	var resp LikeResponse
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode like response: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+// TestHandleLibraryFake tests liking items and listing the library
+func TestHandleLibraryFake(t *testing.T) {
+	fake := newFakeCatalog()
+	ws := &WebServer{catalog: fake}
+
+	for _, body := range []string{`{"type": "track", "id": 101}`, `{"type": "album", "id": 10}`, `{"type": "artist", "id": 6}`} {
+		if code, resp := libraryRequest(t, ws.handleLike, body); code != http.StatusOK || !resp.Liked {
+			t.Fatalf("Unexpected like result for %s: %d %+v", body, code, resp)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/library", nil)
+	w := httptest.NewRecorder()
+	ws.handleLibrary(w, req)
+	var resp SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode library: %v", err)
+	}
+	if len(resp.Tracks) != 1 || resp.Tracks[0].ID != 101 || len(resp.Albums) != 1 || len(resp.Artists) != 1 || resp.Artists[0].Name != "Guest" || resp.Total != 3 {
+		t.Errorf("Unexpected library: %+v", resp)
+	}
+
+	if code, _ := libraryRequest(t, ws.handleUnlike, `{"type": "album", "id": 10}`); code != http.StatusOK {
+		t.Fatalf("Unlike failed with %d", code)
+	}
+	req = httptest.NewRequest("GET", "/api/library?type=album", nil)
+	w = httptest.NewRecorder()
+	ws.handleLibrary(w, req)
+	resp = SearchResponse{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Albums) != 0 || len(resp.Tracks) != 0 {
+		t.Errorf("Expected no albums and only albums listed, got %+v", resp)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"unknown type", ws.handleLike, `{"type": "playlist", "id": 1}`},
+		{"missing id", ws.handleLike, `{"type": "track"}`},
+		{"dislike album", ws.handleDislike, `{"type": "album", "id": 10}`},
+	}
+	for _, tt := range tests {
+		if code, _ := libraryRequest(t, tt.handler, tt.body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusBadRequest, code)
+		}
+	}
+}
+
+// TestHandleLibraryCrossOrigin tests that other sites can't like or
+// dislike tracks through the server
+func TestHandleLibraryCrossOrigin(t *testing.T) {
+	fake := newFakeCatalog()
+	ws := &WebServer{catalog: fake}
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		contentType string
+		site        string
+		want        int
+	}{
+		{"like form", ws.handleLike, "text/plain", "cross-site", http.StatusUnsupportedMediaType},
+		{"unlike form", ws.handleUnlike, "text/plain", "cross-site", http.StatusUnsupportedMediaType},
+		{"dislike form", ws.handleDislike, "application/x-www-form-urlencoded", "cross-site", http.StatusUnsupportedMediaType},
+		{"undislike form", ws.handleUndislike, "multipart/form-data", "cross-site", http.StatusUnsupportedMediaType},
+		{"like cross-site", ws.handleLike, "application/json", "cross-site", http.StatusForbidden},
+		{"dislike cross-site", ws.handleDislike, "application/json", "cross-site", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/api/library/like", strings.NewReader(`{"type": "track", "id": 100}`))
+		req.Header.Set("Content-Type", tt.contentType)
+		req.Header.Set("Origin", "https://evil.example")
+		req.Header.Set("Sec-Fetch-Site", tt.site)
+		w := httptest.NewRecorder()
+		enableCORS(tt.handler)(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+	for _, method := range []string{"Like", "Unlike", "Dislike", "Undislike"} {
+		if fake.Calls[method] != 0 {
+			t.Errorf("Expected no %s calls, got %d", method, fake.Calls[method])
+		}
+	}
+}
+
+// TestHandleSearchHidesDisliked tests that disliked tracks disappear from
+// search results, cached ones included, and come back when undisliked
+func TestHandleSearchHidesDisliked(t *testing.T) {
+	fake := newFakeCatalog()
+	ws := &WebServer{catalog: fake, cache: newResponseCache(defaultCacheSize), dislikes: catalog.NewDislikes(fake)}
+
+	search := func() []int {
+		req := httptest.NewRequest("GET", "/api/search?q=song", nil)
+		w := httptest.NewRecorder()
+		ws.handleSearch(w, req)
+		var resp SearchResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		ids := []int{}
+		for _, t := range resp.Tracks {
+			ids = append(ids, t.ID)
+		}
+		return ids
+	}
+
+	if ids := search(); len(ids) != 2 {
+		t.Fatalf("Expected 2 tracks before disliking, got %v", ids)
+	}
+	if code, resp := libraryRequest(t, ws.handleDislike, `{"id": 100}`); code != http.StatusOK || !resp.Disliked {
+		t.Fatalf("Unexpected dislike result: %d %+v", code, resp)
+	}
+	if ids := search(); len(ids) != 1 || ids[0] != 101 {
+		t.Errorf("Expected only track 101 after disliking 100, got %v", ids)
+	}
+
+	req := httptest.NewRequest("GET", "/api/library/disliked", nil)
+	w := httptest.NewRecorder()
+	ws.handleDisliked(w, req)
+	var disliked SearchResponse
+	json.NewDecoder(w.Body).Decode(&disliked)
+	if len(disliked.Tracks) != 1 || disliked.Tracks[0].ID != 100 {
+		t.Errorf("Unexpected disliked tracks: %+v", disliked.Tracks)
+	}
+
+	libraryRequest(t, ws.handleLike, `{"type": "track", "id": 100}`)
+	if ids := search(); len(ids) != 2 {
+		t.Errorf("Expected a like to lift the dislike, got %v", ids)
+	}
+}
+
+// TestHandleRadioFake tests listing stations, fetching batches without
+// disliked tracks and sending feedback
+func TestHandleRadioFake(t *testing.T) {
+	fake := newFakeCatalog()
+	fake.StationList = []catalog.Station{{ID: "genre:jazz", Name: "Jazz"}}
+	fake.Disliked = []int{101}
+	ws := &WebServer{catalog: fake, dislikes: catalog.NewDislikes(fake)}
+
+	req := httptest.NewRequest("GET", "/api/radio/stations", nil)
+	w := httptest.NewRecorder()
+	ws.handleRadioStations(w, req)
+	var stations StationsResponse
+	json.NewDecoder(w.Body).Decode(&stations)
+	if len(stations.Stations) != 2 || stations.Stations[0].ID != catalog.MyWave || stations.Stations[1].Type != "genre" {
+		t.Errorf("Unexpected stations: %+v", stations)
+	}
+
+	req = httptest.NewRequest("GET", "/api/radio/tracks?station=artist:5", nil)
+	w = httptest.NewRecorder()
+	ws.handleRadioTracks(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var batch StationBatchResponse
+	json.NewDecoder(w.Body).Decode(&batch)
+	if batch.BatchID == "" || len(batch.Tracks) != 1 || batch.Tracks[0].ID != 100 {
+		t.Errorf("Expected the batch without the disliked track 101, got %+v", batch)
+	}
+
+	body := `{"station": "artist:5", "batchId": "b", "type": "skip", "trackId": 100, "playedSeconds": 3}`
+	req = httptest.NewRequest("POST", "/api/radio/feedback", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	ws.handleRadioFeedback(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	fb := fake.Feedback["artist:5"]
+	if len(fb) != 1 || fb[0].Type != catalog.FeedbackSkip || fb[0].Track != (catalog.TrackRef{ID: 100, AlbumID: 10}) || fb[0].PlayedSeconds != 3 {
+		t.Errorf("Unexpected feedback recorded: %+v", fb)
+	}
+
+	for _, tt := range []struct{ method, url, body string }{
+		{"GET", "/api/radio/tracks", ""},
+		{"GET", "/api/radio/tracks?station=../x", ""},
+		{"GET", "/api/radio/tracks?station=user:onyourwave&last=x", ""},
+		{"POST", "/api/radio/feedback", `{"station": "artist:5", "type": "liked", "trackId": 100}`},
+		{"POST", "/api/radio/feedback", `{"station": "artist:5", "type": "trackStarted"}`},
+	} {
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		if tt.method == "GET" {
+			ws.handleRadioTracks(w, req)
+		} else {
+			ws.handleRadioFeedback(w, req)
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: expected status %d, got %d", tt.method, tt.url, tt.body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// TestHandleRadioFeedbackCrossOrigin tests that other sites can't send
+// radio feedback such as skips through the server
+func TestHandleRadioFeedbackCrossOrigin(t *testing.T) {
+	fake := newFakeCatalog()
+	ws := &WebServer{catalog: fake}
+
+	body := `{"station": "user:onyourwave", "batchId": "b", "type": "skip", "trackId": 100, "playedSeconds": 3}`
+	for _, tt := range []struct {
+		contentType string
+		want        int
+	}{
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/json", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("POST", "/api/radio/feedback", strings.NewReader(body))
+		req.Header.Set("Content-Type", tt.contentType)
+		req.Header.Set("Origin", "https://evil.example")
+		req.Header.Set("Sec-Fetch-Site", "cross-site")
+		w := httptest.NewRecorder()
+		enableCORS(ws.handleRadioFeedback)(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.contentType, tt.want, w.Code)
+		}
+	}
+	if fake.Calls["RadioFeedback"] != 0 {
+		t.Errorf("Expected no feedback sent, got %d calls", fake.Calls["RadioFeedback"])
+	}
+}
+
+// scrape returns the server's metrics in the Prometheus text format
+func scrape(t *testing.T, ws *WebServer) string {
+	t.Helper()
+	var b strings.Builder
+	if _, err := ws.metrics.registry.WriteTo(&b); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	return b.String()
+}
+
+// TestMetrics tests request, upstream and cache metrics recorded while
+// serving API requests through the middleware
+func TestMetrics(t *testing.T) {
+	m := newWebMetrics()
+	fake := newFakeCatalog()
+	ws := &WebServer{catalog: catalog.Observe(fake, m.observeUpstream), metrics: m, cache: newResponseCache(defaultCacheSize)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/album-tracks", ws.handleAlbumTracks)
+	mux.HandleFunc("/api/track", ws.handleTrackInfo)
+	h := ws.middleware(mux)
+
+	for _, target := range []string{
+		"/api/album-tracks?id=10&name=Fake+Album",
+		"/api/album-tracks?id=10&name=Fake+Album",
+		"/api/track?id=999",
+		"/nowhere",
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+	fake.Err = errors.New("connection reset")
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/track?id=100", nil))
+
+	out := scrape(t, ws)
+	for _, want := range []string{
+		`yamusic_http_requests_total{route="/api/album-tracks",method="GET",status="200"} 2`,
+		`yamusic_http_requests_total{route="/api/track",method="GET",status="404"} 1`,
+		`yamusic_http_requests_total{route="/api/track",method="GET",status="500"} 1`,
+		`yamusic_http_requests_total{route="other",method="GET",status="404"} 1`,
+		`yamusic_http_request_duration_seconds_count{route="/api/album-tracks",method="GET"} 2`,
+		`yamusic_upstream_request_duration_seconds_count{operation="AlbumWithTracks"} 1`,
+		`yamusic_upstream_errors_total{operation="Track"} 1`,
+		`yamusic_cache_lookups_total{cache="album",result="hit"} 1`,
+		`yamusic_cache_lookups_total{cache="album",result="miss"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in metrics:\n%s", want, out)
+		}
+	}
+	// Not-found answers are not upstream errors
+	if strings.Contains(out, `yamusic_upstream_errors_total{operation="Track"} 2`) {
+		t.Errorf("Expected only the failed Track call to count as an error:\n%s", out)
+	}
+}
+
+// TestMetricsAlbumZip tests zip stream, byte and skipped track metrics
+func TestMetricsAlbumZip(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xfbaudio"))
+	}))
+	defer cdn.Close()
+
+	fake := newFakeCatalog()
+	fake.DownloadURLs[100] = cdn.URL
+	fake.Albums[10].CoverURI = ""
+	ws := &WebServer{catalog: fake, metrics: newWebMetrics()}
+
+	w := httptest.NewRecorder()
+	ws.handleAlbumZip(w, httptest.NewRequest("GET", "/api/album-zip?id=10&name=Fake+Album", nil))
+
+	out := scrape(t, ws)
+	for _, want := range []string{
+		`yamusic_zip_streams_total{result="complete"} 1`,
+		fmt.Sprintf("yamusic_zip_bytes_total %d\n", w.Body.Len()),
+		`yamusic_zip_tracks_skipped_total{reason="unavailable"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in metrics:\n%s", want, out)
+		}
+	}
+}
+
+// TestTracing tests that a request continues the caller's trace and that
+// album zips get catalog and per-track spans below the request's span
+func TestTracing(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xfbaudio"))
+	}))
+	defer cdn.Close()
+
+	var mu sync.Mutex
+	var spans []tracing.SpanData
+	tracer := tracing.NewTracer(tracing.ExporterFunc(func(_ context.Context, batch []tracing.SpanData) error {
+		mu.Lock()
+		spans = append(spans, batch...)
+		mu.Unlock()
+		return nil
+	}))
+
+	fake := newFakeCatalog()
+	fake.DownloadURLs[100] = cdn.URL + "/get-mp3/1f2e/100.mp3"
+	fake.Albums[10].CoverURI = ""
+	ws := &WebServer{
+		catalog: catalog.Observe(fake, traceCatalog(tracer)),
+		tracer:  tracer,
+		client:  upstream.NewClient(upstream.Config{Tracer: tracer}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/album-zip", ws.handleAlbumZip)
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/api/album-zip?id=10&name=Fake+Album", nil)
+	req.Header.Set("traceparent", parent)
+	ws.middleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+	ws.Shutdown(context.Background())
+
+	byName := make(map[string]tracing.SpanData)
+	for _, s := range spans {
+		if s.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Span %q is not in the caller's trace", s.Name)
+		}
+		byName[s.Name] = s
+	}
+	server, ok := byName["GET /api/album-zip"]
+	if !ok || server.Kind != tracing.KindServer || server.Parent.String() != "00f067aa0ba902b7" {
+		t.Fatalf("Expected a server span continuing the caller's, got %+v", spans)
+	}
+	track := byName["album zip track"]
+	download := byName["album zip download"]
+	for child, parent := range map[string]tracing.SpanData{
+		"catalog.AlbumWithTracks": server,
+		"album zip track":         server,
+		"catalog.DownloadURL":     track,
+		"album zip download":      track,
+		"GET /get-mp3/{id}/{id}":  download,
+	} {
+		if s, ok := byName[child]; !ok || s.Parent != parent.SpanContext.SpanID {
+			t.Errorf("Expected span %q below %q, got %+v", child, parent.Name, spans)
+		}
+	}
+}
+
+// TestServeShutdown tests that stopping the server exports the spans of
+// the requests it served
+func TestServeShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var spans []string
+	tracer := tracing.NewTracer(tracing.ExporterFunc(func(_ context.Context, batch []tracing.SpanData) error {
+		mu.Lock()
+		for _, s := range batch {
+			spans = append(spans, s.Name)
+		}
+		mu.Unlock()
+		return nil
+	}))
+	ws := &WebServer{catalog: newFakeCatalog(), tracer: tracer}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ws.serve(ctx, ln, nil)
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/api/album-tracks?id=10&name=Fake+Album")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("serve returned %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Contains(spans, "GET /api/album-tracks") {
+		t.Errorf("Expected the request's span to be exported on shutdown, got %v", spans)
+	}
+}
+
+// TestServeMetricsListener tests that the separate metrics listener serves
+// only /metrics and is shut down with the app
+func TestServeMetricsListener(t *testing.T) {
+	ws := &WebServer{catalog: newFakeCatalog(), metrics: newWebMetrics(), metricsAddr: "127.0.0.1:0"}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	metricsLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ws.serve(ctx, ln, metricsLn)
+	}()
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"http://" + metricsLn.Addr().String() + "/metrics", http.StatusOK},
+		{"http://" + metricsLn.Addr().String() + "/api/album-tracks?id=10", http.StatusNotFound},
+		{"http://" + ln.Addr().String() + "/metrics", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(tt.url)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", tt.url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s: expected status %d, got %d", tt.url, tt.status, resp.StatusCode)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("serve returned %v", err)
+	}
+	if _, err := http.Get("http://" + metricsLn.Addr().String() + "/metrics"); err == nil {
+		t.Error("Expected the metrics listener to be closed after shutdown")
+	}
+}
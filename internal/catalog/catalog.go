@@ -0,0 +1,241 @@
+// Package catalog is the boundary between the players and the Yandex Music
+// API. Handlers and the CLI talk to a Catalog instead of *yamusic.Client,
+// so they can run against the Fake in tests.
+package catalog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Catalog is the part of Yandex Music used by both binaries.
+type Catalog interface {
+	Playlists
+	Library
+	Radio
+
+	// Search looks up tracks, albums and artists matching query.
+	Search(ctx context.Context, query string, opts SearchOptions) (*SearchResult, error)
+	// Track returns a single track with the albums it appears on.
+	Track(ctx context.Context, id int) (*Track, error)
+	// TracksByID returns several tracks at once, skipping unknown IDs.
+	TracksByID(ctx context.Context, ids []int) ([]Track, error)
+	// AlbumWithTracks returns an album with its tracks grouped by volume.
+	AlbumWithTracks(ctx context.Context, id int) (*Album, error)
+	// Lyrics returns a track's lyrics, synced when available. Tracks without
+	// lyrics fail with ErrNoLyrics.
+	Lyrics(ctx context.Context, trackID int) (*Lyrics, error)
+	// DownloadURL returns a short-lived direct link to the track's MP3.
+	DownloadURL(ctx context.Context, trackID int) (string, error)
+	// ArtistPage returns an artist with their popular tracks, releases and
+	// similar artists.
+	ArtistPage(ctx context.Context, id int) (*ArtistPage, error)
+	// ArtistTracks returns one page of all tracks by an artist. page is
+	// 0-based.
+	ArtistTracks(ctx context.Context, id, page, pageSize int) (*TrackPage, error)
+}
+
+// ErrNotFound is returned when the requested item does not exist.
+var ErrNotFound = errors.New("catalog: not found")
+
+// StatusError reports a non-200 response from the upstream API.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return "catalog: upstream returned " + e.Status
+}
+
+// Artist is a performer credited on tracks and albums.
+type Artist struct {
+	ID       int
+	Name     string
+	CoverURI string
+}
+
+// TrackPosition is where a track sits on an album. Both fields are 1-based.
+type TrackPosition struct {
+	Volume int
+	Index  int
+}
+
+// Track is a single recording.
+type Track struct {
+	ID         int
+	Title      string
+	Version    string
+	DurationMs int
+	Available  bool
+	Explicit   bool
+	CoverURI   string
+	Artists    []Artist
+	Albums     []Album // Albums the track appears on, with Position set
+
+	HasLyrics       bool // Plain text lyrics are available
+	HasSyncedLyrics bool // Time-synced lyrics are available
+}
+
+// Album is a release. Volumes is only filled by AlbumWithTracks and
+// Position only for albums embedded in a Track.
+type Album struct {
+	ID         int
+	Title      string
+	Year       int
+	Genre      string
+	CoverURI   string
+	TrackCount int
+	Available  bool
+	Type       string // "" for a regular album, AlbumSingle or AlbumCompilation
+	Artists    []Artist
+	Position   TrackPosition
+	Volumes    [][]Track
+}
+
+// Album types as reported by the API.
+const (
+	AlbumSingle      = "single"
+	AlbumCompilation = "compilation"
+	AlbumPodcast     = "podcast"
+)
+
+// Search result types for SearchOptions.Type.
+const (
+	SearchAll      = "all"
+	SearchTrack    = "track"
+	SearchAlbum    = "album"
+	SearchArtist   = "artist"
+	SearchPlaylist = "playlist"
+	SearchPodcast  = "podcast"
+)
+
+// SearchOptions controls a search request.
+type SearchOptions struct {
+	Type      string // One of the Search* constants; SearchAll if empty
+	Page      int    // 0-based
+	PageSize  int    // Results per type; 0 leaves it to the API
+	NoCorrect bool   // Disable spelling correction
+}
+
+// SearchResult holds one page of search results.
+type SearchResult struct {
+	Tracks            []Track
+	Albums            []Album
+	Artists           []Artist
+	Playlists         []Playlist
+	Podcasts          []Album
+	MisspellCorrected bool
+	MisspellResult    string
+
+	// Pagers holds the paging state of each returned result type, keyed by
+	// the Search* constants.
+	Pagers map[string]Pager
+}
+
+// HasMore reports whether any result type has another page.
+func (r *SearchResult) HasMore() bool {
+	for _, p := range r.Pagers {
+		if p.HasMore() {
+			return true
+		}
+	}
+	return false
+}
+
+// Playlist is a user's playlist. Playlists are identified by their owner's
+// UID together with the kind.
+type Playlist struct {
+	OwnerUID   int
+	OwnerLogin string
+	OwnerName  string
+	Kind       int
+	Title      string
+	TrackCount int
+	DurationMs int
+	CoverURI   string
+	Revision   int     // Incremented by every change; required to modify the playlist
+	Tracks     []Track // Only filled when the playlist is fetched with its tracks
+}
+
+// Pager describes one page of a longer list. Page is 0-based.
+type Pager struct {
+	Page     int
+	PageSize int
+	Total    int
+}
+
+// HasMore reports whether another page follows this one.
+func (p Pager) HasMore() bool {
+	return p.PageSize > 0 && (p.Page+1)*p.PageSize < p.Total
+}
+
+// TrackPage is one page of tracks.
+type TrackPage struct {
+	Tracks []Track
+	Pager  Pager
+}
+
+// ArtistPage is what the artist screen shows.
+type ArtistPage struct {
+	Artist        Artist
+	PopularTracks []Track
+	Albums        []Album  // The artist's own releases, including singles and compilations
+	AppearsOn     []Album  // Other artists' releases featuring the artist
+	Similar       []Artist // Similar artists
+}
+
+// ArtistNames joins the names of artists with ", ".
+func ArtistNames(artists []Artist) string {
+	names := make([]string, len(artists))
+	for i, a := range artists {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// CoverURL turns a Yandex cover URI ("avatars.yandex.net/.../%%") into an
+// https URL for an image of the given size, e.g. "400x400".
+func CoverURL(uri, size string) string {
+	if uri == "" {
+		return ""
+	}
+	return "https://" + strings.ReplaceAll(uri, "%%", size)
+}
+
+// Find returns the 0-based volume and index of a track within the album.
+func (a *Album) Find(trackID int) (vol, idx int, ok bool) {
+	for v, volume := range a.Volumes {
+		for i, t := range volume {
+			if t.ID == trackID {
+				return v, i, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// Cover returns the best cover URI for the track: its first album's cover,
+// or the track's own.
+func (t *Track) Cover() string {
+	if len(t.Albums) > 0 && t.Albums[0].CoverURI != "" {
+		return t.Albums[0].CoverURI
+	}
+	return t.CoverURI
+}
+
+// FullTitle returns the title with the version appended, e.g. "Song (Live)".
+func (t *Track) FullTitle() string {
+	if t.Version == "" {
+		return t.Title
+	}
+	return t.Title + " (" + t.Version + ")"
+}
+
+// parseID converts a Yandex ID, which the API sends as either a number or a
+// string, to an int.
+func parseID(s string) (int, error) {
+	return strconv.Atoi(s)
+}
@@ -0,0 +1,724 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Fake is an in-memory Catalog for tests. Populate the maps before use;
+// setting Err makes every call fail with it.
+type Fake struct {
+	mu sync.Mutex
+
+	Tracks         map[int]*Track
+	Albums         map[int]*Album
+	Artists        map[int]*Artist
+	DownloadURLs   map[int]string
+	TrackLyrics    map[int]*Lyrics  // Lyrics per track ID
+	Similar        map[int][]Artist // Similar artists per artist ID
+	Playlists      map[PlaylistID]*Playlist
+	UID            int   // The account's UID, owner of created playlists
+	Liked          []int // IDs of liked tracks, newest first
+	LikedRev       int   // Revision of the liked tracks playlist
+	LikedAlbumIDs  []int
+	LikedArtistIDs []int
+	Disliked       []int // IDs of disliked tracks
+	StationList    []Station
+	Feedback       map[string][]Feedback // Radio feedback received per station
+	Err            error
+
+	// Calls counts invocations per method name, e.g. Calls["Search"].
+	Calls map[string]int
+}
+
+// NewFake returns an empty Fake.
+func NewFake() *Fake {
+	return &Fake{
+		Tracks:       make(map[int]*Track),
+		Albums:       make(map[int]*Album),
+		Artists:      make(map[int]*Artist),
+		DownloadURLs: make(map[int]string),
+		TrackLyrics:  make(map[int]*Lyrics),
+		Similar:      make(map[int][]Artist),
+		Playlists:    make(map[PlaylistID]*Playlist),
+		Feedback:     make(map[string][]Feedback),
+		Calls:        make(map[string]int),
+	}
+}
+
+// AddAlbum stores an album and all of its tracks. Tracks get the album
+// attached with their position, like the real API returns them.
+func (f *Fake) AddAlbum(album Album) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for v, volume := range album.Volumes {
+		for i, t := range volume {
+			ref := album
+			ref.Volumes = nil
+			ref.Position = TrackPosition{Volume: v + 1, Index: i + 1}
+			t.Albums = []Album{ref}
+			volume[i] = t
+			track := t
+			f.Tracks[t.ID] = &track
+			for _, artist := range t.Artists {
+				if _, ok := f.Artists[artist.ID]; !ok {
+					f.Artists[artist.ID] = &artist
+				}
+			}
+		}
+	}
+	f.Albums[album.ID] = &album
+	for i := range album.Artists {
+		artist := album.Artists[i]
+		f.Artists[artist.ID] = &artist
+	}
+}
+
+func (f *Fake) call(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Calls == nil {
+		f.Calls = make(map[string]int)
+	}
+	f.Calls[name]++
+	return f.Err
+}
+
+// fakeSearchPageSize is the page size the Fake uses when none is requested.
+const fakeSearchPageSize = 10
+
+// Search implements Catalog with a case-insensitive substring match on
+// titles and artist names. Albums with type AlbumPodcast are podcasts.
+func (f *Fake) Search(ctx context.Context, query string, opts SearchOptions) (*SearchResult, error) {
+	if err := f.call("Search"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := strings.ToLower(query)
+	match := func(s ...string) bool {
+		for _, v := range s {
+			if strings.Contains(strings.ToLower(v), q) {
+				return true
+			}
+		}
+		return false
+	}
+	typ := opts.Type
+	if typ == "" {
+		typ = SearchAll
+	}
+	want := func(t string) bool { return typ == SearchAll || typ == t }
+	size := opts.PageSize
+	if size <= 0 {
+		size = fakeSearchPageSize
+	}
+
+	res := &SearchResult{
+		Tracks:    []Track{},
+		Albums:    []Album{},
+		Artists:   []Artist{},
+		Playlists: []Playlist{},
+		Podcasts:  []Album{},
+		Pagers:    make(map[string]Pager),
+	}
+	if want(SearchTrack) {
+		var all []Track
+		for _, id := range sortedKeys(f.Tracks) {
+			if t := f.Tracks[id]; match(t.Title, ArtistNames(t.Artists)) {
+				all = append(all, *t)
+			}
+		}
+		res.Tracks, res.Pagers[SearchTrack] = pageOf(all, opts.Page, size)
+	}
+	if want(SearchAlbum) || want(SearchPodcast) {
+		var albums, podcasts []Album
+		for _, id := range sortedKeys(f.Albums) {
+			a := f.Albums[id]
+			if !match(a.Title, ArtistNames(a.Artists)) {
+				continue
+			}
+			album := *a
+			album.Volumes = nil
+			if album.Type == AlbumPodcast {
+				podcasts = append(podcasts, album)
+			} else {
+				albums = append(albums, album)
+			}
+		}
+		if want(SearchAlbum) {
+			res.Albums, res.Pagers[SearchAlbum] = pageOf(albums, opts.Page, size)
+		}
+		if want(SearchPodcast) {
+			res.Podcasts, res.Pagers[SearchPodcast] = pageOf(podcasts, opts.Page, size)
+		}
+	}
+	if want(SearchArtist) {
+		var all []Artist
+		for _, id := range sortedKeys(f.Artists) {
+			if a := f.Artists[id]; match(a.Name) {
+				all = append(all, *a)
+			}
+		}
+		res.Artists, res.Pagers[SearchArtist] = pageOf(all, opts.Page, size)
+	}
+	return res, nil
+}
+
+// Track implements Catalog.
+func (f *Fake) Track(ctx context.Context, id int) (*Track, error) {
+	if err := f.call("Track"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.Tracks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	track := *t
+	return &track, nil
+}
+
+// TracksByID implements Catalog.
+func (f *Fake) TracksByID(ctx context.Context, ids []int) ([]Track, error) {
+	if err := f.call("TracksByID"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tracks := []Track{}
+	for _, id := range ids {
+		if t, ok := f.Tracks[id]; ok {
+			tracks = append(tracks, *t)
+		}
+	}
+	return tracks, nil
+}
+
+// AlbumWithTracks implements Catalog.
+func (f *Fake) AlbumWithTracks(ctx context.Context, id int) (*Album, error) {
+	if err := f.call("AlbumWithTracks"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.Albums[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	album := *a
+	return &album, nil
+}
+
+// Lyrics implements Catalog.
+func (f *Fake) Lyrics(ctx context.Context, trackID int) (*Lyrics, error) {
+	if err := f.call("Lyrics"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.Tracks[trackID]; !ok {
+		return nil, ErrNotFound
+	}
+	l, ok := f.TrackLyrics[trackID]
+	if !ok {
+		return nil, ErrNoLyrics
+	}
+	lyrics := *l
+	return &lyrics, nil
+}
+
+// DownloadURL implements Catalog.
+func (f *Fake) DownloadURL(ctx context.Context, trackID int) (string, error) {
+	if err := f.call("DownloadURL"); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	url, ok := f.DownloadURLs[trackID]
+	if !ok {
+		return "", fmt.Errorf("no download URL for track %d: %w", trackID, ErrNotFound)
+	}
+	return url, nil
+}
+
+// ArtistPage implements Catalog. Albums credited to the artist are their
+// own; other albums with one of their tracks count as appearances. The
+// popular tracks are simply the first few of their tracks.
+func (f *Fake) ArtistPage(ctx context.Context, id int) (*ArtistPage, error) {
+	if err := f.call("ArtistPage"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.Artists[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	page := &ArtistPage{
+		Artist:        *a,
+		PopularTracks: f.artistTracks(id),
+		Albums:        []Album{},
+		AppearsOn:     []Album{},
+		Similar:       append([]Artist{}, f.Similar[id]...),
+	}
+	if len(page.PopularTracks) > 5 {
+		page.PopularTracks = page.PopularTracks[:5]
+	}
+	for _, albumID := range sortedKeys(f.Albums) {
+		album := *f.Albums[albumID]
+		featured := false
+		for _, volume := range album.Volumes {
+			for _, t := range volume {
+				featured = featured || hasArtist(t.Artists, id)
+			}
+		}
+		album.Volumes = nil
+		switch {
+		case hasArtist(album.Artists, id):
+			page.Albums = append(page.Albums, album)
+		case featured:
+			page.AppearsOn = append(page.AppearsOn, album)
+		}
+	}
+	return page, nil
+}
+
+// ArtistTracks implements Catalog.
+func (f *Fake) ArtistTracks(ctx context.Context, id, page, pageSize int) (*TrackPage, error) {
+	if err := f.call("ArtistTracks"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.Artists[id]; !ok {
+		return nil, ErrNotFound
+	}
+	tracks, pager := pageOf(f.artistTracks(id), page, pageSize)
+	return &TrackPage{Tracks: tracks, Pager: pager}, nil
+}
+
+// AddPlaylist stores a playlist. Its tracks must already be in f.Tracks for
+// edits to resolve them.
+func (f *Fake) AddPlaylist(p Playlist) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p.TrackCount = len(p.Tracks)
+	f.Playlists[PlaylistID{Owner: p.OwnerUID, Kind: p.Kind}] = &p
+}
+
+// UserPlaylists implements Catalog.
+func (f *Fake) UserPlaylists(ctx context.Context) ([]Playlist, error) {
+	if err := f.call("UserPlaylists"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	liked := f.liked()
+	liked.Tracks = nil
+	out := []Playlist{liked}
+	for _, id := range f.playlistIDs() {
+		if id.Owner == f.UID {
+			p := *f.Playlists[id]
+			p.Tracks = nil
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// Playlist implements Catalog.
+func (f *Fake) Playlist(ctx context.Context, owner, kind int) (*Playlist, error) {
+	if err := f.call("Playlist"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if owner == 0 {
+		owner = f.UID
+	}
+	if owner == f.UID && kind == LikedKind {
+		liked := f.liked()
+		return &liked, nil
+	}
+	p, ok := f.Playlists[PlaylistID{Owner: owner, Kind: kind}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	playlist := *p
+	playlist.Tracks = append([]Track{}, p.Tracks...)
+	return &playlist, nil
+}
+
+// CreatePlaylist implements Catalog. Kinds are allocated from 1000 up.
+func (f *Fake) CreatePlaylist(ctx context.Context, title string, public bool) (*Playlist, error) {
+	if err := f.call("CreatePlaylist"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	kind := 1000
+	for id := range f.Playlists {
+		if id.Owner == f.UID && id.Kind >= kind {
+			kind = id.Kind + 1
+		}
+	}
+	p := &Playlist{OwnerUID: f.UID, Kind: kind, Title: title, Revision: 1, Tracks: []Track{}}
+	f.Playlists[PlaylistID{Owner: f.UID, Kind: kind}] = p
+	playlist := *p
+	return &playlist, nil
+}
+
+// RenamePlaylist implements Catalog.
+func (f *Fake) RenamePlaylist(ctx context.Context, kind int, title string) (*Playlist, error) {
+	if err := f.call("RenamePlaylist"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if kind == LikedKind {
+		return nil, ErrReadOnly
+	}
+	p, ok := f.Playlists[PlaylistID{Owner: f.UID, Kind: kind}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	p.Title = title
+	p.Revision++
+	playlist := *p
+	playlist.Tracks = nil
+	return &playlist, nil
+}
+
+// ChangePlaylist implements Catalog.
+func (f *Fake) ChangePlaylist(ctx context.Context, kind, revision int, ops []PlaylistOp) (*Playlist, error) {
+	if err := f.call("ChangePlaylist"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if kind == LikedKind {
+		return nil, ErrReadOnly
+	}
+	p, ok := f.Playlists[PlaylistID{Owner: f.UID, Kind: kind}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if revision != p.Revision {
+		return nil, ErrWrongRevision
+	}
+	refs := make([]TrackRef, len(p.Tracks))
+	for i := range p.Tracks {
+		refs[i] = p.Tracks[i].Ref()
+	}
+	refs, err := ApplyOps(refs, ops)
+	if err != nil {
+		return nil, &StatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"}
+	}
+	tracks := make([]Track, len(refs))
+	for i, ref := range refs {
+		t, ok := f.Tracks[ref.ID]
+		if !ok {
+			return nil, fmt.Errorf("track %d: %w", ref.ID, ErrNotFound)
+		}
+		tracks[i] = *t
+	}
+	p.Tracks = tracks
+	p.TrackCount = len(tracks)
+	p.DurationMs = 0
+	for _, t := range tracks {
+		p.DurationMs += t.DurationMs
+	}
+	p.Revision++
+	playlist := *p
+	playlist.Tracks = nil
+	return &playlist, nil
+}
+
+// Like implements Catalog. New likes go first, like the API lists them.
+func (f *Fake) Like(ctx context.Context, kind string, id int) error {
+	if err := f.call("Like"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list, err := f.likes(kind)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(*list, id) {
+		*list = append([]int{id}, *list...)
+	}
+	if kind == LikeTrack {
+		f.LikedRev++
+		f.Disliked = slices.DeleteFunc(f.Disliked, func(v int) bool { return v == id })
+	}
+	return nil
+}
+
+// Unlike implements Catalog.
+func (f *Fake) Unlike(ctx context.Context, kind string, id int) error {
+	if err := f.call("Unlike"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list, err := f.likes(kind)
+	if err != nil {
+		return err
+	}
+	*list = slices.DeleteFunc(*list, func(v int) bool { return v == id })
+	if kind == LikeTrack {
+		f.LikedRev++
+	}
+	return nil
+}
+
+// Dislike implements Catalog.
+func (f *Fake) Dislike(ctx context.Context, trackID int) error {
+	if err := f.call("Dislike"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !slices.Contains(f.Disliked, trackID) {
+		f.Disliked = append(f.Disliked, trackID)
+	}
+	if slices.Contains(f.Liked, trackID) {
+		f.Liked = slices.DeleteFunc(f.Liked, func(v int) bool { return v == trackID })
+		f.LikedRev++
+	}
+	return nil
+}
+
+// Undislike implements Catalog.
+func (f *Fake) Undislike(ctx context.Context, trackID int) error {
+	if err := f.call("Undislike"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Disliked = slices.DeleteFunc(f.Disliked, func(v int) bool { return v == trackID })
+	return nil
+}
+
+// LikedTracks implements Catalog.
+func (f *Fake) LikedTracks(ctx context.Context) ([]Track, error) {
+	if err := f.call("LikedTracks"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.liked().Tracks, nil
+}
+
+// LikedAlbums implements Catalog.
+func (f *Fake) LikedAlbums(ctx context.Context) ([]Album, error) {
+	if err := f.call("LikedAlbums"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	albums := []Album{}
+	for _, id := range f.LikedAlbumIDs {
+		if a, ok := f.Albums[id]; ok {
+			album := *a
+			album.Volumes = nil
+			albums = append(albums, album)
+		}
+	}
+	return albums, nil
+}
+
+// LikedArtists implements Catalog.
+func (f *Fake) LikedArtists(ctx context.Context) ([]Artist, error) {
+	if err := f.call("LikedArtists"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	artists := []Artist{}
+	for _, id := range f.LikedArtistIDs {
+		if a, ok := f.Artists[id]; ok {
+			artists = append(artists, *a)
+		}
+	}
+	return artists, nil
+}
+
+// DislikedTrackIDs implements Catalog.
+func (f *Fake) DislikedTrackIDs(ctx context.Context) ([]int, error) {
+	if err := f.call("DislikedTrackIDs"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int{}, f.Disliked...), nil
+}
+
+// likes returns the list of liked IDs of a kind. f.mu must be held.
+func (f *Fake) likes(kind string) (*[]int, error) {
+	switch kind {
+	case LikeTrack:
+		return &f.Liked, nil
+	case LikeAlbum:
+		return &f.LikedAlbumIDs, nil
+	case LikeArtist:
+		return &f.LikedArtistIDs, nil
+	}
+	return nil, fmt.Errorf("catalog: can't like a %q", kind)
+}
+
+// liked builds the liked tracks playlist. f.mu must be held.
+func (f *Fake) liked() Playlist {
+	p := Playlist{OwnerUID: f.UID, Kind: LikedKind, Title: LikedTitle, Revision: f.LikedRev, Tracks: []Track{}}
+	for _, id := range f.Liked {
+		if t, ok := f.Tracks[id]; ok {
+			p.Tracks = append(p.Tracks, *t)
+			p.DurationMs += t.DurationMs
+		}
+	}
+	p.TrackCount = len(p.Tracks)
+	return p
+}
+
+// playlistIDs returns the stored playlist IDs ordered by owner and kind.
+// f.mu must be held.
+func (f *Fake) playlistIDs() []PlaylistID {
+	ids := make([]PlaylistID, 0, len(f.Playlists))
+	for id := range f.Playlists {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b PlaylistID) int {
+		if a.Owner != b.Owner {
+			return a.Owner - b.Owner
+		}
+		return a.Kind - b.Kind
+	})
+	return ids
+}
+
+// fakeBatchSize is the number of tracks per station batch.
+const fakeBatchSize = 5
+
+// Stations implements Catalog. My Wave is always listed first.
+func (f *Fake) Stations(ctx context.Context) ([]Station, error) {
+	if err := f.call("Stations"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Station{{ID: MyWave, Name: "My Wave"}}, f.StationList...), nil
+}
+
+// StationTracks implements Catalog. User stations play every track, artist
+// stations the artist's tracks, track stations every other track and genre
+// stations the tracks of albums of that genre. Batches continue after
+// lastTrackID and wrap around.
+func (f *Fake) StationTracks(ctx context.Context, station string, lastTrackID int) (*StationBatch, error) {
+	if err := f.call("StationTracks"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	typ, tag, _ := strings.Cut(station, ":")
+	var pool []Track
+	for _, id := range sortedKeys(f.Tracks) {
+		t := f.Tracks[id]
+		var ok bool
+		switch typ {
+		case StationUser:
+			ok = true
+		case StationArtist:
+			ok = hasArtist(t.Artists, atoi(tag))
+		case StationTrack:
+			ok = t.ID != atoi(tag)
+		case StationGenre:
+			ok = len(t.Albums) > 0 && f.Albums[t.Albums[0].ID] != nil && f.Albums[t.Albums[0].ID].Genre == tag
+		default:
+			return nil, ErrNotFound
+		}
+		if ok {
+			pool = append(pool, *t)
+		}
+	}
+
+	batch := &StationBatch{Station: station, BatchID: fmt.Sprintf("batch-%d", f.Calls["StationTracks"]), Tracks: []Track{}}
+	if len(pool) == 0 {
+		return batch, nil
+	}
+	start := 0
+	for i, t := range pool {
+		if t.ID == lastTrackID {
+			start = i + 1
+		}
+	}
+	for i := 0; i < min(fakeBatchSize, len(pool)); i++ {
+		batch.Tracks = append(batch.Tracks, pool[(start+i)%len(pool)])
+	}
+	return batch, nil
+}
+
+// RadioFeedback implements Catalog by recording fb in f.Feedback.
+func (f *Fake) RadioFeedback(ctx context.Context, station string, fb Feedback) error {
+	if err := f.call("RadioFeedback"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Feedback == nil {
+		f.Feedback = make(map[string][]Feedback)
+	}
+	f.Feedback[station] = append(f.Feedback[station], fb)
+	return nil
+}
+
+func atoi(s string) int {
+	n, _ := parseID(s)
+	return n
+}
+
+// artistTracks returns all tracks by the artist ordered by ID. f.mu must be
+// held.
+func (f *Fake) artistTracks(id int) []Track {
+	tracks := []Track{}
+	for _, trackID := range sortedKeys(f.Tracks) {
+		if t := f.Tracks[trackID]; hasArtist(t.Artists, id) {
+			tracks = append(tracks, *t)
+		}
+	}
+	return tracks
+}
+
+func hasArtist(artists []Artist, id int) bool {
+	for _, a := range artists {
+		if a.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// pageOf returns the requested page of items, never nil.
+func pageOf[T any](items []T, page, size int) ([]T, Pager) {
+	start := min(page*size, len(items))
+	end := min(start+size, len(items))
+	return append([]T{}, items[start:end]...), Pager{Page: page, PageSize: size, Total: len(items)}
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
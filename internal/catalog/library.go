@@ -0,0 +1,192 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+)
+
+// What can be liked, for Library.Like and Library.Unlike.
+const (
+	LikeTrack  = "track"
+	LikeAlbum  = "album"
+	LikeArtist = "artist"
+)
+
+// Library is the account's likes and dislikes. Liking a track removes its
+// dislike and the other way round.
+type Library interface {
+	// Like adds a track, album or artist to the library. kind is one of
+	// the Like* constants.
+	Like(ctx context.Context, kind string, id int) error
+	// Unlike removes a track, album or artist from the library.
+	Unlike(ctx context.Context, kind string, id int) error
+	// Dislike marks a track as disliked.
+	Dislike(ctx context.Context, trackID int) error
+	// Undislike removes a track's dislike.
+	Undislike(ctx context.Context, trackID int) error
+	// LikedTracks returns the liked tracks, newest first.
+	LikedTracks(ctx context.Context) ([]Track, error)
+	// LikedAlbums returns the liked albums without tracks.
+	LikedAlbums(ctx context.Context) ([]Album, error)
+	// LikedArtists returns the liked artists.
+	LikedArtists(ctx context.Context) ([]Artist, error)
+	// DislikedTrackIDs returns the IDs of the disliked tracks.
+	DislikedTrackIDs(ctx context.Context) ([]int, error)
+}
+
+// ValidLikeKind reports whether kind is one of the Like* constants.
+func ValidLikeKind(kind string) bool {
+	return kind == LikeTrack || kind == LikeAlbum || kind == LikeArtist
+}
+
+// dislikesTTL is how long a loaded set of dislikes is trusted. Dislikes
+// made through Dislikes.Set are applied immediately; the reload picks up
+// those made in other clients.
+const dislikesTTL = 10 * time.Minute
+
+// Dislikes filters disliked tracks out of results. The set is loaded from
+// the library on first use and reloaded after a while. Filtering is best
+// effort: if the set can't be loaded, tracks are returned unfiltered and
+// loading is retried on the next call. A nil *Dislikes filters nothing.
+//
+// The library is called without holding the lock: concurrent callers share
+// one load, and while a stale set is being reloaded they keep using it.
+type Dislikes struct {
+	lib Library
+
+	mu      sync.Mutex
+	ids     map[int]bool // Replaced, never modified, so callers can keep it
+	loaded  time.Time
+	loading chan struct{} // Closed when the load in progress ends, nil if none
+	pending map[int]bool  // Set calls made during the load in progress
+	now     func() time.Time
+}
+
+// NewDislikes returns a filter backed by lib.
+func NewDislikes(lib Library) *Dislikes {
+	return &Dislikes{lib: lib, now: time.Now}
+}
+
+// Filter returns tracks without the disliked ones. The input slice is not
+// modified.
+func (d *Dislikes) Filter(ctx context.Context, tracks []Track) []Track {
+	if d == nil || len(tracks) == 0 {
+		return tracks
+	}
+	ids := d.load(ctx)
+	if len(ids) == 0 {
+		return tracks
+	}
+	out := make([]Track, 0, len(tracks))
+	for _, t := range tracks {
+		if !ids[t.ID] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Set records a dislike or its removal made through this process.
+func (d *Dislikes) Set(trackID int, disliked bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.loading != nil {
+		// The list being loaded may predate this change
+		if d.pending == nil {
+			d.pending = make(map[int]bool)
+		}
+		d.pending[trackID] = disliked
+	}
+	if d.ids == nil {
+		// Not loaded yet; the first load will include it
+		return
+	}
+	d.ids = withDislike(d.ids, trackID, disliked)
+}
+
+// withDislike returns a copy of ids with trackID added or removed.
+func withDislike(ids map[int]bool, trackID int, disliked bool) map[int]bool {
+	ids = maps.Clone(ids)
+	if disliked {
+		ids[trackID] = true
+	} else {
+		delete(ids, trackID)
+	}
+	return ids
+}
+
+// load returns the set, reloading it first when it is missing or stale.
+// Only the first caller reloads; the others wait for it if there is no set
+// yet and otherwise go on with the stale one.
+func (d *Dislikes) load(ctx context.Context) (ids map[int]bool) {
+	d.mu.Lock()
+	ids = d.ids
+	if ids != nil && d.now().Sub(d.loaded) < dislikesTTL {
+		d.mu.Unlock()
+		return ids
+	}
+	if wait := d.loading; wait != nil {
+		d.mu.Unlock()
+		if ids != nil {
+			return ids
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.ids
+	}
+	done := make(chan struct{})
+	d.loading = done
+	d.mu.Unlock()
+
+	// Deferred before the call, so a load that panics still releases the
+	// callers waiting for it and lets the next one try again
+	var list []int
+	err := errLoadAborted
+	defer func() {
+		ids = d.finishLoad(done, list, err)
+	}()
+	list, err = d.lib.DislikedTrackIDs(ctx)
+	return ids
+}
+
+// errLoadAborted stands for the result of a load that never returned.
+var errLoadAborted = errors.New("catalog: loading the dislike list was aborted")
+
+// finishLoad ends the load in progress, which signals done, and stores
+// list unless err is set. It returns the dislikes now known.
+func (d *Dislikes) finishLoad(done chan struct{}, list []int, err error) map[int]bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer close(done)
+	d.loading = nil
+	pending := d.pending
+	d.pending = nil
+	if err != nil {
+		return d.ids
+	}
+	ids := make(map[int]bool, len(list))
+	for _, id := range list {
+		ids[id] = true
+	}
+	for id, disliked := range pending {
+		if disliked {
+			ids[id] = true
+		} else {
+			delete(ids, id)
+		}
+	}
+	d.ids = ids
+	d.loaded = d.now()
+	return ids
+}
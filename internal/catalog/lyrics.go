@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoLyrics is returned by Lyrics for tracks without lyrics.
+var ErrNoLyrics = errors.New("catalog: track has no lyrics")
+
+// Lyrics are a track's words. Lines is only set for synced lyrics.
+type Lyrics struct {
+	Text    string      // Plain text, one line per lyric line
+	Lines   []LyricLine // Timed lines in order; nil if not synced
+	Writers []string
+}
+
+// Synced reports whether the lyrics carry timestamps.
+func (l *Lyrics) Synced() bool {
+	return len(l.Lines) > 0
+}
+
+// LyricLine is one line of synced lyrics.
+type LyricLine struct {
+	Time time.Duration // Offset from the start of the track
+	Text string
+}
+
+// LineAt returns the index of the line being sung at offset, or -1 before
+// the first line.
+func (l *Lyrics) LineAt(offset time.Duration) int {
+	return sort.Search(len(l.Lines), func(i int) bool { return l.Lines[i].Time > offset }) - 1
+}
+
+// lrcTimestamp matches one [mm:ss.xx] tag; the fraction is optional and
+// may have 1 to 3 digits.
+var lrcTimestamp = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+
+// ParseLRC parses LRC lyrics into lines ordered by time. A line may carry
+// several timestamps; metadata tags such as [ar:...] and untimed lines are
+// ignored.
+func ParseLRC(lrc string) []LyricLine {
+	var lines []LyricLine
+	for _, raw := range strings.Split(lrc, "\n") {
+		raw = strings.TrimSpace(raw)
+		var times []time.Duration
+		for {
+			m := lrcTimestamp.FindStringSubmatch(raw)
+			if m == nil {
+				break
+			}
+			mins, _ := strconv.Atoi(m[1])
+			secs, _ := strconv.Atoi(m[2])
+			t := time.Duration(mins)*time.Minute + time.Duration(secs)*time.Second
+			if frac := m[3]; frac != "" {
+				// "5" is 500ms, "05" is 50ms, "005" is 5ms
+				ms, _ := strconv.Atoi((frac + "00")[:3])
+				t += time.Duration(ms) * time.Millisecond
+			}
+			times = append(times, t)
+			raw = raw[len(m[0]):]
+		}
+		text := strings.TrimSpace(raw)
+		for _, t := range times {
+			lines = append(lines, LyricLine{Time: t, Text: text})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time < lines[j].Time })
+	return lines
+}
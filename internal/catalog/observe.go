@@ -0,0 +1,133 @@
+package catalog
+
+import (
+	"context"
+)
+
+// ObserveFunc is called as each call made through Observe starts, with the
+// method name as op. It returns the context for the call, e.g. carrying a
+// span, and a function that is given the call's error when it returns.
+type ObserveFunc func(ctx context.Context, op string) (context.Context, func(err error))
+
+// Observe returns a Catalog that calls c and reports each call to observe,
+// e.g. for latency and error metrics or tracing.
+func Observe(c Catalog, observe ObserveFunc) Catalog {
+	return &observed{next: c, observe: observe}
+}
+
+type observed struct {
+	next    Catalog
+	observe ObserveFunc
+}
+
+// call runs f as operation op.
+func call[T any](ctx context.Context, o *observed, op string, f func(ctx context.Context) (T, error)) (T, error) {
+	ctx, done := o.observe(ctx, op)
+	v, err := f(ctx)
+	done(err)
+	return v, err
+}
+
+// callErr is call for methods that only return an error.
+func callErr(ctx context.Context, o *observed, op string, f func(ctx context.Context) error) error {
+	_, err := call(ctx, o, op, func(ctx context.Context) (struct{}, error) { return struct{}{}, f(ctx) })
+	return err
+}
+
+func (o *observed) Search(ctx context.Context, query string, opts SearchOptions) (*SearchResult, error) {
+	return call(ctx, o, "Search", func(ctx context.Context) (*SearchResult, error) { return o.next.Search(ctx, query, opts) })
+}
+
+func (o *observed) Track(ctx context.Context, id int) (*Track, error) {
+	return call(ctx, o, "Track", func(ctx context.Context) (*Track, error) { return o.next.Track(ctx, id) })
+}
+
+func (o *observed) TracksByID(ctx context.Context, ids []int) ([]Track, error) {
+	return call(ctx, o, "TracksByID", func(ctx context.Context) ([]Track, error) { return o.next.TracksByID(ctx, ids) })
+}
+
+func (o *observed) AlbumWithTracks(ctx context.Context, id int) (*Album, error) {
+	return call(ctx, o, "AlbumWithTracks", func(ctx context.Context) (*Album, error) { return o.next.AlbumWithTracks(ctx, id) })
+}
+
+func (o *observed) Lyrics(ctx context.Context, trackID int) (*Lyrics, error) {
+	return call(ctx, o, "Lyrics", func(ctx context.Context) (*Lyrics, error) { return o.next.Lyrics(ctx, trackID) })
+}
+
+func (o *observed) DownloadURL(ctx context.Context, trackID int) (string, error) {
+	return call(ctx, o, "DownloadURL", func(ctx context.Context) (string, error) { return o.next.DownloadURL(ctx, trackID) })
+}
+
+func (o *observed) ArtistPage(ctx context.Context, id int) (*ArtistPage, error) {
+	return call(ctx, o, "ArtistPage", func(ctx context.Context) (*ArtistPage, error) { return o.next.ArtistPage(ctx, id) })
+}
+
+func (o *observed) ArtistTracks(ctx context.Context, id, page, pageSize int) (*TrackPage, error) {
+	return call(ctx, o, "ArtistTracks", func(ctx context.Context) (*TrackPage, error) { return o.next.ArtistTracks(ctx, id, page, pageSize) })
+}
+
+func (o *observed) UserPlaylists(ctx context.Context) ([]Playlist, error) {
+	return call(ctx, o, "UserPlaylists", func(ctx context.Context) ([]Playlist, error) { return o.next.UserPlaylists(ctx) })
+}
+
+func (o *observed) Playlist(ctx context.Context, owner, kind int) (*Playlist, error) {
+	return call(ctx, o, "Playlist", func(ctx context.Context) (*Playlist, error) { return o.next.Playlist(ctx, owner, kind) })
+}
+
+func (o *observed) CreatePlaylist(ctx context.Context, title string, public bool) (*Playlist, error) {
+	return call(ctx, o, "CreatePlaylist", func(ctx context.Context) (*Playlist, error) { return o.next.CreatePlaylist(ctx, title, public) })
+}
+
+func (o *observed) RenamePlaylist(ctx context.Context, kind int, title string) (*Playlist, error) {
+	return call(ctx, o, "RenamePlaylist", func(ctx context.Context) (*Playlist, error) { return o.next.RenamePlaylist(ctx, kind, title) })
+}
+
+func (o *observed) ChangePlaylist(ctx context.Context, kind, revision int, ops []PlaylistOp) (*Playlist, error) {
+	return call(ctx, o, "ChangePlaylist", func(ctx context.Context) (*Playlist, error) { return o.next.ChangePlaylist(ctx, kind, revision, ops) })
+}
+
+func (o *observed) Like(ctx context.Context, kind string, id int) error {
+	return callErr(ctx, o, "Like", func(ctx context.Context) error { return o.next.Like(ctx, kind, id) })
+}
+
+func (o *observed) Unlike(ctx context.Context, kind string, id int) error {
+	return callErr(ctx, o, "Unlike", func(ctx context.Context) error { return o.next.Unlike(ctx, kind, id) })
+}
+
+func (o *observed) Dislike(ctx context.Context, trackID int) error {
+	return callErr(ctx, o, "Dislike", func(ctx context.Context) error { return o.next.Dislike(ctx, trackID) })
+}
+
+func (o *observed) Undislike(ctx context.Context, trackID int) error {
+	return callErr(ctx, o, "Undislike", func(ctx context.Context) error { return o.next.Undislike(ctx, trackID) })
+}
+
+func (o *observed) LikedTracks(ctx context.Context) ([]Track, error) {
+	return call(ctx, o, "LikedTracks", func(ctx context.Context) ([]Track, error) { return o.next.LikedTracks(ctx) })
+}
+
+func (o *observed) LikedAlbums(ctx context.Context) ([]Album, error) {
+	return call(ctx, o, "LikedAlbums", func(ctx context.Context) ([]Album, error) { return o.next.LikedAlbums(ctx) })
+}
+
+func (o *observed) LikedArtists(ctx context.Context) ([]Artist, error) {
+	return call(ctx, o, "LikedArtists", func(ctx context.Context) ([]Artist, error) { return o.next.LikedArtists(ctx) })
+}
+
+func (o *observed) DislikedTrackIDs(ctx context.Context) ([]int, error) {
+	return call(ctx, o, "DislikedTrackIDs", func(ctx context.Context) ([]int, error) { return o.next.DislikedTrackIDs(ctx) })
+}
+
+func (o *observed) Stations(ctx context.Context) ([]Station, error) {
+	return call(ctx, o, "Stations", func(ctx context.Context) ([]Station, error) { return o.next.Stations(ctx) })
+}
+
+func (o *observed) StationTracks(ctx context.Context, station string, lastTrackID int) (*StationBatch, error) {
+	return call(ctx, o, "StationTracks", func(ctx context.Context) (*StationBatch, error) {
+		return o.next.StationTracks(ctx, station, lastTrackID)
+	})
+}
+
+func (o *observed) RadioFeedback(ctx context.Context, station string, fb Feedback) error {
+	return callErr(ctx, o, "RadioFeedback", func(ctx context.Context) error { return o.next.RadioFeedback(ctx, station, fb) })
+}
@@ -0,0 +1,118 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// LikedKind is the kind of the account's "liked tracks" playlist. It can be
+// listed and viewed like any other playlist but is changed through likes.
+const LikedKind = 3
+
+// PlaylistID identifies a playlist by its owner's UID and kind.
+type PlaylistID struct {
+	Owner int
+	Kind  int
+}
+
+// ErrWrongRevision is returned when a playlist change is based on an
+// outdated revision. Fetch the playlist again and rebuild the diff.
+var ErrWrongRevision = errors.New("catalog: playlist revision is out of date")
+
+// ErrReadOnly is returned when changing a playlist that can't be edited
+// directly, such as the liked tracks.
+var ErrReadOnly = errors.New("catalog: playlist is read-only")
+
+// Playlists is the playlist side of the catalog. Owner 0 and the edit
+// methods, which take no owner, refer to the account's own playlists.
+type Playlists interface {
+	// UserPlaylists lists the account's playlists without tracks, the liked
+	// tracks first.
+	UserPlaylists(ctx context.Context) ([]Playlist, error)
+	// Playlist returns a playlist of any user with its tracks.
+	Playlist(ctx context.Context, owner, kind int) (*Playlist, error)
+	// CreatePlaylist creates an empty playlist.
+	CreatePlaylist(ctx context.Context, title string, public bool) (*Playlist, error)
+	// RenamePlaylist changes a playlist's title.
+	RenamePlaylist(ctx context.Context, kind int, title string) (*Playlist, error)
+	// ChangePlaylist applies ops to the playlist at the given revision and
+	// returns it with its new revision. A stale revision fails with
+	// ErrWrongRevision and changes nothing.
+	ChangePlaylist(ctx context.Context, kind, revision int, ops []PlaylistOp) (*Playlist, error)
+}
+
+// Playlist diff operations.
+const (
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// TrackRef identifies a track within an album, as playlists store them.
+type TrackRef struct {
+	ID      int
+	AlbumID int
+}
+
+// Ref returns the reference to the track on its first album.
+func (t *Track) Ref() TrackRef {
+	ref := TrackRef{ID: t.ID}
+	if len(t.Albums) > 0 {
+		ref.AlbumID = t.Albums[0].ID
+	}
+	return ref
+}
+
+// PlaylistOp is one step of a playlist diff. Ops are applied in order, each
+// to the result of the previous one.
+type PlaylistOp struct {
+	Op     string
+	At     int        // OpInsert: index of the first inserted track
+	Tracks []TrackRef // OpInsert: tracks to insert
+	From   int        // OpDelete: first removed index
+	To     int        // OpDelete: index after the last removed one
+}
+
+// InsertOp inserts tracks before index at; at equal to the track count
+// appends them.
+func InsertOp(at int, tracks ...TrackRef) PlaylistOp {
+	return PlaylistOp{Op: OpInsert, At: at, Tracks: tracks}
+}
+
+// DeleteOp removes the tracks with indexes in [from, to).
+func DeleteOp(from, to int) PlaylistOp {
+	return PlaylistOp{Op: OpDelete, From: from, To: to}
+}
+
+// MoveOps returns the diff that moves the track at index from so that it
+// ends up at index to.
+func MoveOps(p *Playlist, from, to int) ([]PlaylistOp, error) {
+	if from < 0 || from >= len(p.Tracks) || to < 0 || to >= len(p.Tracks) {
+		return nil, fmt.Errorf("move %d to %d: index out of range [0, %d)", from, to, len(p.Tracks))
+	}
+	return []PlaylistOp{DeleteOp(from, from+1), InsertOp(to, p.Tracks[from].Ref())}, nil
+}
+
+// ApplyOps applies a diff to a track list and returns the new list. The
+// input is not modified.
+func ApplyOps(tracks []TrackRef, ops []PlaylistOp) ([]TrackRef, error) {
+	out := append([]TrackRef(nil), tracks...)
+	for _, op := range ops {
+		switch op.Op {
+		case OpInsert:
+			if op.At < 0 || op.At > len(out) {
+				return nil, fmt.Errorf("insert at %d: index out of range [0, %d]", op.At, len(out))
+			}
+			rest := append([]TrackRef(nil), out[op.At:]...)
+			out = append(append(out[:op.At], op.Tracks...), rest...)
+		case OpDelete:
+			if op.From < 0 || op.To > len(out) || op.From >= op.To {
+				return nil, fmt.Errorf("delete [%d, %d): invalid range for %d tracks", op.From, op.To, len(out))
+			}
+			out = append(out[:op.From], out[op.To:]...)
+		default:
+			return nil, fmt.Errorf("unknown playlist op %q", op.Op)
+		}
+	}
+	return out, nil
+}
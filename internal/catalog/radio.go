@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Radio is the rotor: endless, recommendation-driven stations. Stations
+// are identified by "type:tag", e.g. "genre:rock" or "artist:2001".
+type Radio interface {
+	// Stations lists the stations that can be played, My Wave first.
+	Stations(ctx context.Context) ([]Station, error)
+	// StationTracks returns the next batch of a station's tracks. lastTrackID
+	// is the track played last, 0 when the station is just starting.
+	StationTracks(ctx context.Context, station string, lastTrackID int) (*StationBatch, error)
+	// RadioFeedback reports playback so the station adapts.
+	RadioFeedback(ctx context.Context, station string, fb Feedback) error
+}
+
+// MyWave is the personal station.
+const MyWave = "user:onyourwave"
+
+// Station types.
+const (
+	StationUser   = "user"
+	StationGenre  = "genre"
+	StationArtist = "artist"
+	StationTrack  = "track"
+)
+
+// Feedback types, sent in this order: RadioStarted once, then
+// TrackStarted for every track followed by TrackFinished or Skip.
+const (
+	FeedbackRadioStarted  = "radioStarted"
+	FeedbackTrackStarted  = "trackStarted"
+	FeedbackTrackFinished = "trackFinished"
+	FeedbackSkip          = "skip"
+)
+
+// Station is a radio station.
+type Station struct {
+	ID      string // "type:tag"
+	Name    string
+	IconURI string
+}
+
+// Type returns the station type, e.g. StationGenre.
+func (s Station) Type() string {
+	typ, _, _ := strings.Cut(s.ID, ":")
+	return typ
+}
+
+// StationBatch is one batch of a station's tracks. Feedback about them
+// carries the BatchID.
+type StationBatch struct {
+	Station string
+	BatchID string
+	Tracks  []Track
+}
+
+// Feedback is a playback event on a station.
+type Feedback struct {
+	Type          string // One of the Feedback* constants
+	BatchID       string
+	Track         TrackRef  // Unset for FeedbackRadioStarted
+	PlayedSeconds float64   // For FeedbackTrackFinished and FeedbackSkip
+	Time          time.Time // When it happened; now if zero
+}
+
+// ArtistStation returns the ID of the station based on an artist.
+func ArtistStation(artistID int) string {
+	return StationArtist + ":" + strconv.Itoa(artistID)
+}
+
+// TrackStation returns the ID of the station based on a track.
+func TrackStation(trackID int) string {
+	return StationTrack + ":" + strconv.Itoa(trackID)
+}
+
+// GenreStation returns the ID of a genre's station, e.g. "genre:jazz".
+func GenreStation(genre string) string {
+	return StationGenre + ":" + genre
+}
+
+// ValidStation reports whether id looks like a station ID.
+func ValidStation(id string) bool {
+	typ, tag, ok := strings.Cut(id, ":")
+	return ok && typ != "" && tag != "" && !strings.ContainsAny(id, "/?#")
+}
@@ -0,0 +1,412 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"pkg.botr.me/yamusic"
+)
+
+// Yandex is the Catalog backed by the Yandex Music API.
+type Yandex struct {
+	client     *yamusic.Client
+	httpClient *http.Client // For files outside the API, such as lyrics
+	uid        int
+}
+
+// NewYandex wraps a yamusic client authenticated as the account uid. The
+// uid addresses the account's own playlists and likes. httpClient fetches
+// files the API links to; nil means http.DefaultClient.
+func NewYandex(client *yamusic.Client, httpClient *http.Client, uid int) *Yandex {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Yandex{client: client, httpClient: httpClient, uid: uid}
+}
+
+// get performs a GET against the API and decodes the "result" envelope into v.
+func (y *Yandex) get(ctx context.Context, path string, v interface{}) error {
+	return y.do(ctx, "GET", path, nil, v)
+}
+
+// post sends form as a POST and decodes the "result" envelope into v.
+func (y *Yandex) post(ctx context.Context, path string, form url.Values, v interface{}) error {
+	return y.do(ctx, "POST", path, form, v)
+}
+
+func (y *Yandex) do(ctx context.Context, method, path string, body interface{}, v interface{}) error {
+	req, err := y.client.NewRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	envelope := struct {
+		Result interface{} `json:"result"`
+	}{Result: v}
+	resp, err := y.client.Do(ctx, req, &envelope)
+	if resp != nil && resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return err
+}
+
+// Search implements Catalog.
+func (y *Yandex) Search(ctx context.Context, query string, opts SearchOptions) (*SearchResult, error) {
+	typ := opts.Type
+	if typ == "" {
+		typ = SearchAll
+	}
+	params := url.Values{
+		"text":      {query},
+		"type":      {typ},
+		"page":      {strconv.Itoa(opts.Page)},
+		"nocorrect": {strconv.FormatBool(opts.NoCorrect)},
+	}
+	if opts.PageSize > 0 {
+		params.Set("page-size", strconv.Itoa(opts.PageSize))
+	}
+	var raw struct {
+		MisspellCorrected bool                           `json:"misspellCorrected"`
+		MisspellResult    string                         `json:"misspellResult"`
+		Tracks            *rawSearchSection[rawTrack]    `json:"tracks"`
+		Albums            *rawSearchSection[rawAlbum]    `json:"albums"`
+		Artists           *rawSearchSection[rawArtist]   `json:"artists"`
+		Playlists         *rawSearchSection[rawPlaylist] `json:"playlists"`
+		Podcasts          *rawSearchSection[rawAlbum]    `json:"podcasts"`
+	}
+	if err := y.get(ctx, "search?"+params.Encode(), &raw); err != nil {
+		return nil, err
+	}
+
+	res := &SearchResult{
+		Tracks:            []Track{},
+		Albums:            []Album{},
+		Artists:           []Artist{},
+		Playlists:         []Playlist{},
+		Podcasts:          []Album{},
+		MisspellCorrected: raw.MisspellCorrected,
+		MisspellResult:    raw.MisspellResult,
+		Pagers:            make(map[string]Pager),
+	}
+	if raw.Tracks != nil {
+		res.Tracks = tracks(raw.Tracks.Results)
+		res.Pagers[SearchTrack] = raw.Tracks.pager(opts.Page)
+	}
+	if raw.Albums != nil {
+		res.Albums = albums(raw.Albums.Results)
+		res.Pagers[SearchAlbum] = raw.Albums.pager(opts.Page)
+	}
+	if raw.Artists != nil {
+		res.Artists = artists(raw.Artists.Results)
+		res.Pagers[SearchArtist] = raw.Artists.pager(opts.Page)
+	}
+	if raw.Playlists != nil {
+		res.Playlists = playlists(raw.Playlists.Results)
+		res.Pagers[SearchPlaylist] = raw.Playlists.pager(opts.Page)
+	}
+	if raw.Podcasts != nil {
+		res.Podcasts = albums(raw.Podcasts.Results)
+		res.Pagers[SearchPodcast] = raw.Podcasts.pager(opts.Page)
+	}
+	return res, nil
+}
+
+// Track implements Catalog.
+func (y *Yandex) Track(ctx context.Context, id int) (*Track, error) {
+	var raw []rawTrack
+	if err := y.get(ctx, "tracks/"+strconv.Itoa(id), &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, ErrNotFound
+	}
+	track, ok := raw[0].track()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &track, nil
+}
+
+// tracksChunk is how many track IDs TracksByID resolves per request.
+const tracksChunk = 200
+
+// TracksByID implements Catalog.
+func (y *Yandex) TracksByID(ctx context.Context, ids []int) ([]Track, error) {
+	out := make([]Track, 0, len(ids))
+	for start := 0; start < len(ids); start += tracksChunk {
+		chunk := ids[start:min(start+tracksChunk, len(ids))]
+		strs := make([]string, len(chunk))
+		for i, id := range chunk {
+			strs[i] = strconv.Itoa(id)
+		}
+		var raw []rawTrack
+		if err := y.post(ctx, "tracks", url.Values{"track-ids": {strings.Join(strs, ",")}}, &raw); err != nil {
+			return nil, err
+		}
+		out = append(out, tracks(raw)...)
+	}
+	return out, nil
+}
+
+// AlbumWithTracks implements Catalog.
+func (y *Yandex) AlbumWithTracks(ctx context.Context, id int) (*Album, error) {
+	var raw rawAlbum
+	if err := y.get(ctx, "albums/"+strconv.Itoa(id)+"/with-tracks", &raw); err != nil {
+		return nil, err
+	}
+	album := raw.album()
+	return &album, nil
+}
+
+// DownloadURL implements Catalog.
+func (y *Yandex) DownloadURL(ctx context.Context, trackID int) (string, error) {
+	return y.client.Tracks().GetDownloadURL(ctx, trackID)
+}
+
+// ArtistPage implements Catalog.
+func (y *Yandex) ArtistPage(ctx context.Context, id int) (*ArtistPage, error) {
+	var raw struct {
+		Artist         rawArtist   `json:"artist"`
+		Albums         []rawAlbum  `json:"albums"`
+		AlsoAlbums     []rawAlbum  `json:"alsoAlbums"`
+		PopularTracks  []rawTrack  `json:"popularTracks"`
+		SimilarArtists []rawArtist `json:"similarArtists"`
+	}
+	if err := y.get(ctx, "artists/"+strconv.Itoa(id)+"/brief-info", &raw); err != nil {
+		return nil, err
+	}
+	return &ArtistPage{
+		Artist:        raw.Artist.artist(),
+		PopularTracks: tracks(raw.PopularTracks),
+		Albums:        albums(raw.Albums),
+		AppearsOn:     albums(raw.AlsoAlbums),
+		Similar:       artists(raw.SimilarArtists),
+	}, nil
+}
+
+// ArtistTracks implements Catalog.
+func (y *Yandex) ArtistTracks(ctx context.Context, id, page, pageSize int) (*TrackPage, error) {
+	params := url.Values{
+		"page":      {strconv.Itoa(page)},
+		"page-size": {strconv.Itoa(pageSize)},
+	}
+	var raw struct {
+		Pager  rawPager   `json:"pager"`
+		Tracks []rawTrack `json:"tracks"`
+	}
+	if err := y.get(ctx, "artists/"+strconv.Itoa(id)+"/tracks?"+params.Encode(), &raw); err != nil {
+		return nil, err
+	}
+	return &TrackPage{Tracks: tracks(raw.Tracks), Pager: raw.Pager.pager()}, nil
+}
+
+// The raw* types mirror the API's JSON. Track IDs come back as strings from
+// some endpoints and as numbers from others, hence json.Number.
+
+type rawArtist struct {
+	ID    json.Number `json:"id"`
+	Name  string      `json:"name"`
+	Cover struct {
+		URI string `json:"uri"`
+	} `json:"cover"`
+}
+
+func (a rawArtist) artist() Artist {
+	id, _ := parseID(a.ID.String())
+	return Artist{ID: id, Name: a.Name, CoverURI: a.Cover.URI}
+}
+
+type rawAlbum struct {
+	ID            json.Number  `json:"id"`
+	Title         string       `json:"title"`
+	Year          int          `json:"year"`
+	Genre         string       `json:"genre"`
+	CoverURI      string       `json:"coverUri"`
+	TrackCount    int          `json:"trackCount"`
+	Available     bool         `json:"available"`
+	Type          string       `json:"type"`
+	Artists       []rawArtist  `json:"artists"`
+	Volumes       [][]rawTrack `json:"volumes"`
+	TrackPosition struct {
+		Volume int `json:"volume"`
+		Index  int `json:"index"`
+	} `json:"trackPosition"`
+}
+
+func (a rawAlbum) album() Album {
+	id, _ := parseID(a.ID.String())
+	album := Album{
+		ID:         id,
+		Title:      a.Title,
+		Year:       a.Year,
+		Genre:      a.Genre,
+		CoverURI:   a.CoverURI,
+		TrackCount: a.TrackCount,
+		Available:  a.Available,
+		Type:       a.Type,
+		Artists:    artists(a.Artists),
+		Position:   TrackPosition{Volume: a.TrackPosition.Volume, Index: a.TrackPosition.Index},
+	}
+	for _, volume := range a.Volumes {
+		tracks := make([]Track, 0, len(volume))
+		for _, t := range volume {
+			if track, ok := t.track(); ok {
+				tracks = append(tracks, track)
+			}
+		}
+		album.Volumes = append(album.Volumes, tracks)
+	}
+	return album
+}
+
+type rawTrack struct {
+	ID         json.Number `json:"id"`
+	Title      string      `json:"title"`
+	Version    string      `json:"version"`
+	DurationMs int         `json:"durationMs"`
+	Available  bool        `json:"available"`
+	Explicit   bool        `json:"explicit"`
+	CoverURI   string      `json:"coverUri"`
+	Artists    []rawArtist `json:"artists"`
+	Albums     []rawAlbum  `json:"albums"`
+	LyricsInfo struct {
+		HasAvailableSyncLyrics bool `json:"hasAvailableSyncLyrics"`
+		HasAvailableTextLyrics bool `json:"hasAvailableTextLyrics"`
+	} `json:"lyricsInfo"`
+}
+
+// track converts the raw track; ok is false if the ID is not numeric
+// (e.g. user-uploaded tracks).
+func (t rawTrack) track() (Track, bool) {
+	id, err := parseID(t.ID.String())
+	if err != nil {
+		return Track{}, false
+	}
+	track := Track{
+		ID:         id,
+		Title:      t.Title,
+		Version:    t.Version,
+		DurationMs: t.DurationMs,
+		Available:  t.Available,
+		Explicit:   t.Explicit,
+		CoverURI:   t.CoverURI,
+		Artists:    artists(t.Artists),
+
+		HasLyrics:       t.LyricsInfo.HasAvailableTextLyrics || t.LyricsInfo.HasAvailableSyncLyrics,
+		HasSyncedLyrics: t.LyricsInfo.HasAvailableSyncLyrics,
+	}
+	for _, a := range t.Albums {
+		track.Albums = append(track.Albums, a.album())
+	}
+	return track, true
+}
+
+// rawSearchSection is one result type of a search response.
+type rawSearchSection[T any] struct {
+	Total   int `json:"total"`
+	PerPage int `json:"perPage"`
+	Results []T `json:"results"`
+}
+
+func (s *rawSearchSection[T]) pager(page int) Pager {
+	return Pager{Page: page, PageSize: s.PerPage, Total: s.Total}
+}
+
+type rawPlaylist struct {
+	Owner struct {
+		UID   json.Number `json:"uid"`
+		Login string      `json:"login"`
+		Name  string      `json:"name"`
+	} `json:"owner"`
+	Kind       int    `json:"kind"`
+	Title      string `json:"title"`
+	TrackCount int    `json:"trackCount"`
+	DurationMs int    `json:"durationMs"`
+	Revision   int    `json:"revision"`
+	OgImage    string `json:"ogImage"`
+	Cover      struct {
+		URI      string   `json:"uri"`
+		ItemsURI []string `json:"itemsUri"`
+	} `json:"cover"`
+	Tracks []struct {
+		Track *rawTrack `json:"track"`
+	} `json:"tracks"`
+}
+
+func (p rawPlaylist) playlist() Playlist {
+	uid, _ := parseID(p.Owner.UID.String())
+	playlist := Playlist{
+		OwnerUID:   uid,
+		OwnerLogin: p.Owner.Login,
+		OwnerName:  p.Owner.Name,
+		Kind:       p.Kind,
+		Title:      p.Title,
+		TrackCount: p.TrackCount,
+		DurationMs: p.DurationMs,
+		Revision:   p.Revision,
+		CoverURI:   p.Cover.URI,
+	}
+	// Mosaic covers have no single image; use the first tile
+	if playlist.CoverURI == "" && len(p.Cover.ItemsURI) > 0 {
+		playlist.CoverURI = p.Cover.ItemsURI[0]
+	}
+	if playlist.CoverURI == "" {
+		playlist.CoverURI = p.OgImage
+	}
+	for _, item := range p.Tracks {
+		if item.Track == nil {
+			continue
+		}
+		if track, ok := item.Track.track(); ok {
+			playlist.Tracks = append(playlist.Tracks, track)
+		}
+	}
+	return playlist
+}
+
+func playlists(raw []rawPlaylist) []Playlist {
+	out := make([]Playlist, len(raw))
+	for i, p := range raw {
+		out[i] = p.playlist()
+	}
+	return out
+}
+
+type rawPager struct {
+	Page    int `json:"page"`
+	PerPage int `json:"perPage"`
+	Total   int `json:"total"`
+}
+
+func (p rawPager) pager() Pager {
+	return Pager{Page: p.Page, PageSize: p.PerPage, Total: p.Total}
+}
+
+func tracks(raw []rawTrack) []Track {
+	out := make([]Track, 0, len(raw))
+	for _, t := range raw {
+		if track, ok := t.track(); ok {
+			out = append(out, track)
+		}
+	}
+	return out
+}
+
+func albums(raw []rawAlbum) []Album {
+	out := make([]Album, len(raw))
+	for i, a := range raw {
+		out[i] = a.album()
+	}
+	return out
+}
+
+func artists(raw []rawArtist) []Artist {
+	out := make([]Artist, len(raw))
+	for i, a := range raw {
+		out[i] = a.artist()
+	}
+	return out
+}
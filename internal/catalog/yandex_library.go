@@ -0,0 +1,86 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Like implements Catalog.
+func (y *Yandex) Like(ctx context.Context, kind string, id int) error {
+	return y.changeLikes(ctx, "likes", kind, "add-multiple", id)
+}
+
+// Unlike implements Catalog.
+func (y *Yandex) Unlike(ctx context.Context, kind string, id int) error {
+	return y.changeLikes(ctx, "likes", kind, "remove", id)
+}
+
+// Dislike implements Catalog.
+func (y *Yandex) Dislike(ctx context.Context, trackID int) error {
+	return y.changeLikes(ctx, "dislikes", LikeTrack, "add-multiple", trackID)
+}
+
+// Undislike implements Catalog.
+func (y *Yandex) Undislike(ctx context.Context, trackID int) error {
+	return y.changeLikes(ctx, "dislikes", LikeTrack, "remove", trackID)
+}
+
+// changeLikes posts to users/{uid}/{list}/{kind}s/{action}, e.g.
+// likes/albums/add-multiple with album-ids.
+func (y *Yandex) changeLikes(ctx context.Context, list, kind, action string, id int) error {
+	if !ValidLikeKind(kind) {
+		return fmt.Errorf("catalog: can't like a %q", kind)
+	}
+	path := "users/" + strconv.Itoa(y.uid) + "/" + list + "/" + kind + "s/" + action
+	return y.post(ctx, path, url.Values{kind + "-ids": {strconv.Itoa(id)}}, nil)
+}
+
+// LikedTracks implements Catalog.
+func (y *Yandex) LikedTracks(ctx context.Context) ([]Track, error) {
+	liked, err := y.likedPlaylist(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return liked.Tracks, nil
+}
+
+// LikedAlbums implements Catalog.
+func (y *Yandex) LikedAlbums(ctx context.Context) ([]Album, error) {
+	var raw []struct {
+		Album *rawAlbum `json:"album"`
+	}
+	if err := y.get(ctx, "users/"+strconv.Itoa(y.uid)+"/likes/albums?rich=true", &raw); err != nil {
+		return nil, err
+	}
+	out := make([]Album, 0, len(raw))
+	for _, like := range raw {
+		if like.Album != nil {
+			out = append(out, like.Album.album())
+		}
+	}
+	return out, nil
+}
+
+// LikedArtists implements Catalog.
+func (y *Yandex) LikedArtists(ctx context.Context) ([]Artist, error) {
+	var raw []rawArtist
+	if err := y.get(ctx, "users/"+strconv.Itoa(y.uid)+"/likes/artists?with-timestamps=false", &raw); err != nil {
+		return nil, err
+	}
+	return artists(raw), nil
+}
+
+// DislikedTrackIDs implements Catalog.
+func (y *Yandex) DislikedTrackIDs(ctx context.Context) ([]int, error) {
+	var raw struct {
+		Library struct {
+			Tracks []rawTrackRef `json:"tracks"`
+		} `json:"library"`
+	}
+	if err := y.get(ctx, "users/"+strconv.Itoa(y.uid)+"/dislikes/tracks", &raw); err != nil {
+		return nil, err
+	}
+	return trackIDs(raw.Library.Tracks), nil
+}
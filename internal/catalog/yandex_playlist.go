@@ -0,0 +1,176 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// LikedTitle is the title given to the liked tracks playlist.
+const LikedTitle = "Liked tracks"
+
+// UserPlaylists implements Catalog.
+func (y *Yandex) UserPlaylists(ctx context.Context) ([]Playlist, error) {
+	liked, err := y.likedPlaylist(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	var raw []rawPlaylist
+	if err := y.get(ctx, y.playlistPath("list"), &raw); err != nil {
+		return nil, err
+	}
+	return append([]Playlist{*liked}, playlists(raw)...), nil
+}
+
+// Playlist implements Catalog.
+func (y *Yandex) Playlist(ctx context.Context, owner, kind int) (*Playlist, error) {
+	if owner == 0 {
+		owner = y.uid
+	}
+	if owner == y.uid && kind == LikedKind {
+		return y.likedPlaylist(ctx, true)
+	}
+	var raw rawPlaylist
+	path := "users/" + strconv.Itoa(owner) + "/playlists/" + strconv.Itoa(kind) + "?rich-tracks=true"
+	if err := y.get(ctx, path, &raw); err != nil {
+		return nil, err
+	}
+	playlist := raw.playlist()
+	return &playlist, nil
+}
+
+// CreatePlaylist implements Catalog.
+func (y *Yandex) CreatePlaylist(ctx context.Context, title string, public bool) (*Playlist, error) {
+	visibility := "private"
+	if public {
+		visibility = "public"
+	}
+	var raw rawPlaylist
+	form := url.Values{"title": {title}, "visibility": {visibility}}
+	if err := y.post(ctx, y.playlistPath("create"), form, &raw); err != nil {
+		return nil, err
+	}
+	playlist := raw.playlist()
+	return &playlist, nil
+}
+
+// RenamePlaylist implements Catalog.
+func (y *Yandex) RenamePlaylist(ctx context.Context, kind int, title string) (*Playlist, error) {
+	if kind == LikedKind {
+		return nil, ErrReadOnly
+	}
+	var raw rawPlaylist
+	if err := y.post(ctx, y.playlistPath(strconv.Itoa(kind)+"/name"), url.Values{"value": {title}}, &raw); err != nil {
+		return nil, err
+	}
+	playlist := raw.playlist()
+	return &playlist, nil
+}
+
+// ChangePlaylist implements Catalog. The API rejects a stale revision with
+// 412 Precondition Failed.
+func (y *Yandex) ChangePlaylist(ctx context.Context, kind, revision int, ops []PlaylistOp) (*Playlist, error) {
+	if kind == LikedKind {
+		return nil, ErrReadOnly
+	}
+	diff, err := json.Marshal(rawDiff(ops))
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"diff":     {string(diff)},
+		"revision": {strconv.Itoa(revision)},
+	}
+	var raw rawPlaylist
+	err = y.post(ctx, y.playlistPath(strconv.Itoa(kind)+"/change-relative"), form, &raw)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusPreconditionFailed {
+		return nil, ErrWrongRevision
+	}
+	if err != nil {
+		return nil, err
+	}
+	playlist := raw.playlist()
+	return &playlist, nil
+}
+
+// playlistPath returns the path of an endpoint under the account's
+// playlists.
+func (y *Yandex) playlistPath(rest string) string {
+	return "users/" + strconv.Itoa(y.uid) + "/playlists/" + rest
+}
+
+// likedPlaylist builds the liked tracks playlist from the account's likes.
+// Likes only carry IDs, so the tracks are resolved separately when
+// withTracks is set.
+func (y *Yandex) likedPlaylist(ctx context.Context, withTracks bool) (*Playlist, error) {
+	var raw struct {
+		Library struct {
+			Revision int           `json:"revision"`
+			Tracks   []rawTrackRef `json:"tracks"`
+		} `json:"library"`
+	}
+	if err := y.get(ctx, "users/"+strconv.Itoa(y.uid)+"/likes/tracks", &raw); err != nil {
+		return nil, err
+	}
+	playlist := &Playlist{
+		OwnerUID:   y.uid,
+		Kind:       LikedKind,
+		Title:      LikedTitle,
+		TrackCount: len(raw.Library.Tracks),
+		Revision:   raw.Library.Revision,
+	}
+	if !withTracks {
+		return playlist, nil
+	}
+
+	liked, err := y.TracksByID(ctx, trackIDs(raw.Library.Tracks))
+	if err != nil {
+		return nil, err
+	}
+	playlist.Tracks = liked
+	for _, t := range playlist.Tracks {
+		playlist.DurationMs += t.DurationMs
+	}
+	if len(playlist.Tracks) > 0 {
+		playlist.CoverURI = playlist.Tracks[0].Cover()
+	}
+	return playlist, nil
+}
+
+type rawTrackRef struct {
+	ID      json.Number `json:"id"`
+	AlbumID json.Number `json:"albumId"`
+}
+
+// trackIDs returns the numeric IDs of refs, skipping user-uploaded tracks.
+func trackIDs(refs []rawTrackRef) []int {
+	ids := make([]int, 0, len(refs))
+	for _, ref := range refs {
+		if id, err := parseID(ref.ID.String()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// rawDiff converts ops to the JSON diff format of change-relative.
+func rawDiff(ops []PlaylistOp) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(ops))
+	for i, op := range ops {
+		switch op.Op {
+		case OpInsert:
+			refs := make([]map[string]string, len(op.Tracks))
+			for j, t := range op.Tracks {
+				refs[j] = map[string]string{"id": strconv.Itoa(t.ID), "albumId": strconv.Itoa(t.AlbumID)}
+			}
+			out[i] = map[string]interface{}{"op": op.Op, "at": op.At, "tracks": refs}
+		default:
+			out[i] = map[string]interface{}{"op": op.Op, "from": op.From, "to": op.To}
+		}
+	}
+	return out
+}
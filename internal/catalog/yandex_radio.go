@@ -0,0 +1,101 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Stations implements Catalog. The API's list doesn't include My Wave, so
+// it is added in front.
+func (y *Yandex) Stations(ctx context.Context) ([]Station, error) {
+	var raw []struct {
+		Station rawStation `json:"station"`
+	}
+	if err := y.get(ctx, "rotor/stations/list", &raw); err != nil {
+		return nil, err
+	}
+	stations := []Station{{ID: MyWave, Name: "My Wave"}}
+	for _, s := range raw {
+		if st := s.Station.station(); st.ID != MyWave {
+			stations = append(stations, st)
+		}
+	}
+	return stations, nil
+}
+
+// StationTracks implements Catalog.
+func (y *Yandex) StationTracks(ctx context.Context, station string, lastTrackID int) (*StationBatch, error) {
+	if !ValidStation(station) {
+		return nil, fmt.Errorf("catalog: invalid station %q", station)
+	}
+	params := url.Values{"settings2": {"true"}}
+	if lastTrackID != 0 {
+		params.Set("queue", strconv.Itoa(lastTrackID))
+	}
+	var raw struct {
+		BatchID  string `json:"batchId"`
+		Sequence []struct {
+			Track *rawTrack `json:"track"`
+		} `json:"sequence"`
+	}
+	if err := y.get(ctx, "rotor/station/"+station+"/tracks?"+params.Encode(), &raw); err != nil {
+		return nil, err
+	}
+	batch := &StationBatch{Station: station, BatchID: raw.BatchID, Tracks: []Track{}}
+	for _, item := range raw.Sequence {
+		if item.Track == nil {
+			continue
+		}
+		if track, ok := item.Track.track(); ok {
+			batch.Tracks = append(batch.Tracks, track)
+		}
+	}
+	return batch, nil
+}
+
+// RadioFeedback implements Catalog.
+func (y *Yandex) RadioFeedback(ctx context.Context, station string, fb Feedback) error {
+	if !ValidStation(station) {
+		return fmt.Errorf("catalog: invalid station %q", station)
+	}
+	at := fb.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	body := map[string]interface{}{
+		"type":      fb.Type,
+		"timestamp": at.UTC().Format(time.RFC3339Nano),
+	}
+	switch fb.Type {
+	case FeedbackRadioStarted:
+		body["from"] = "go_yandex_music"
+	default:
+		body["trackId"] = strconv.Itoa(fb.Track.ID) + ":" + strconv.Itoa(fb.Track.AlbumID)
+	}
+	if fb.Type == FeedbackTrackFinished || fb.Type == FeedbackSkip {
+		body["totalPlayedSeconds"] = fb.PlayedSeconds
+	}
+	path := "rotor/station/" + station + "/feedback"
+	if fb.BatchID != "" {
+		path += "?" + url.Values{"batch-id": {fb.BatchID}}.Encode()
+	}
+	return y.do(ctx, "POST", path, body, nil)
+}
+
+type rawStation struct {
+	ID struct {
+		Type string `json:"type"`
+		Tag  string `json:"tag"`
+	} `json:"id"`
+	Name string `json:"name"`
+	Icon struct {
+		ImageURL string `json:"imageUrl"`
+	} `json:"icon"`
+}
+
+func (s rawStation) station() Station {
+	return Station{ID: s.ID.Type + ":" + s.ID.Tag, Name: s.Name, IconURI: s.Icon.ImageURL}
+}
@@ -0,0 +1,541 @@
+package catalog_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go_yandex_music/internal/catalog"
+	"go_yandex_music/internal/catalog/yandextest"
+)
+
+func newEmulator(t *testing.T) (*yandextest.Server, *catalog.Yandex) {
+	t.Helper()
+	srv := yandextest.NewServer(os.DirFS("testdata/yandex"))
+	t.Cleanup(srv.Close)
+	return srv, catalog.NewYandex(srv.Client(), srv.HTTPClient(), 1)
+}
+
+func TestYandexSearch(t *testing.T) {
+	_, c := newEmulator(t)
+
+	res, err := c.Search(context.Background(), "chick corea", catalog.SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if len(res.Tracks) != 2 || len(res.Albums) != 1 || len(res.Artists) != 1 {
+		t.Fatalf("Unexpected result sizes: %d tracks, %d albums, %d artists", len(res.Tracks), len(res.Albums), len(res.Artists))
+	}
+	if !res.MisspellCorrected || res.MisspellResult != "chick corea" {
+		t.Errorf("Expected misspell correction to be reported, got %v %q", res.MisspellCorrected, res.MisspellResult)
+	}
+
+	spain := res.Tracks[0]
+	if spain.ID != 1001 || spain.Title != "Spain" || !spain.Available {
+		t.Errorf("Unexpected first track: %+v", spain)
+	}
+	if len(spain.Albums) != 1 || spain.Albums[0].Position != (catalog.TrackPosition{Volume: 1, Index: 2}) {
+		t.Errorf("Expected album position 1/2, got %+v", spain.Albums)
+	}
+
+	live := res.Tracks[1]
+	if live.FullTitle() != "500 Miles High (Live)" || !live.Explicit || catalog.ArtistNames(live.Artists) != "Chick Corea, Stanley Clarke" {
+		t.Errorf("Unexpected second track: %+v", live)
+	}
+	if res.Artists[0].CoverURI == "" {
+		t.Error("Expected artist cover URI")
+	}
+
+	if len(res.Playlists) != 1 || res.Playlists[0].OwnerUID != 777 || res.Playlists[0].Kind != 1005 || res.Playlists[0].CoverURI == "" {
+		t.Errorf("Unexpected playlists: %+v", res.Playlists)
+	}
+	if p := res.Pagers[catalog.SearchPlaylist]; p.Total != 25 || !p.HasMore() || res.Pagers[catalog.SearchTrack].HasMore() || !res.HasMore() {
+		t.Errorf("Unexpected pagers: %+v", res.Pagers)
+	}
+}
+
+func TestYandexTrack(t *testing.T) {
+	_, c := newEmulator(t)
+
+	track, err := c.Track(context.Background(), 1001)
+	if err != nil {
+		t.Fatalf("Track failed: %v", err)
+	}
+	if track.ID != 1001 || track.Cover() != "avatars.yandex.net/get-music-content/3001/%%" {
+		t.Errorf("Unexpected track: %+v", track)
+	}
+
+	_, err = c.Track(context.Background(), 404)
+	var statusErr *catalog.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 StatusError for missing track, got %v", err)
+	}
+}
+
+func TestYandexAlbumWithTracks(t *testing.T) {
+	_, c := newEmulator(t)
+
+	album, err := c.AlbumWithTracks(context.Background(), 3001)
+	if err != nil {
+		t.Fatalf("AlbumWithTracks failed: %v", err)
+	}
+	if album.Title != "Light as a Feather" || album.Year != 1973 || len(album.Volumes) != 1 {
+		t.Fatalf("Unexpected album: %+v", album)
+	}
+
+	vol, idx, ok := album.Find(1001)
+	if !ok || vol != 0 || idx != 1 {
+		t.Errorf("Expected Spain at 0/1, got %d/%d (found=%v)", vol, idx, ok)
+	}
+}
+
+func TestYandexUpstreamError(t *testing.T) {
+	srv, c := newEmulator(t)
+	srv.Handle("/albums/3001/with-tracks", func(w http.ResponseWriter, r *http.Request) {
+		yandextest.Error(w, http.StatusServiceUnavailable, "unavailable", "try later")
+	})
+
+	_, err := c.AlbumWithTracks(context.Background(), 3001)
+	var statusErr *catalog.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 StatusError, got %v", err)
+	}
+}
+
+func TestYandexArtistPage(t *testing.T) {
+	_, c := newEmulator(t)
+
+	page, err := c.ArtistPage(context.Background(), 2001)
+	if err != nil {
+		t.Fatalf("ArtistPage failed: %v", err)
+	}
+	if page.Artist.Name != "Chick Corea" || len(page.PopularTracks) != 2 || len(page.Similar) != 2 {
+		t.Fatalf("Unexpected artist page: %+v", page)
+	}
+	if len(page.Albums) != 3 || page.Albums[1].Type != catalog.AlbumSingle || page.Albums[2].Type != catalog.AlbumCompilation {
+		t.Errorf("Unexpected albums: %+v", page.Albums)
+	}
+	if len(page.AppearsOn) != 1 || page.AppearsOn[0].Title != "School Days" {
+		t.Errorf("Unexpected appearances: %+v", page.AppearsOn)
+	}
+}
+
+func TestYandexArtistTracks(t *testing.T) {
+	srv, c := newEmulator(t)
+
+	page, err := c.ArtistTracks(context.Background(), 2001, 0, 2)
+	if err != nil {
+		t.Fatalf("ArtistTracks failed: %v", err)
+	}
+	if len(page.Tracks) != 2 || page.Pager != (catalog.Pager{Page: 0, PageSize: 2, Total: 5}) || !page.Pager.HasMore() {
+		t.Errorf("Unexpected track page: %+v", page)
+	}
+	if reqs := srv.Requests(); reqs[len(reqs)-1] != "/artists/2001/tracks" {
+		t.Errorf("Unexpected request path: %v", reqs)
+	}
+}
+
+func TestYandexSearchParams(t *testing.T) {
+	srv, c := newEmulator(t)
+	var query url.Values
+	srv.Handle("/search", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"result": {"albums": {"total": 45, "perPage": 20, "results": []}}}`))
+	})
+
+	res, err := c.Search(context.Background(), "corea", catalog.SearchOptions{Type: catalog.SearchAlbum, Page: 2, PageSize: 20})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if query.Get("type") != "album" || query.Get("page") != "2" || query.Get("page-size") != "20" {
+		t.Errorf("Unexpected query: %v", query)
+	}
+	if len(res.Pagers) != 1 || res.Pagers[catalog.SearchAlbum] != (catalog.Pager{Page: 2, PageSize: 20, Total: 45}) || res.HasMore() {
+		t.Errorf("Unexpected pagers on the last page: %+v", res.Pagers)
+	}
+}
+
+func TestYandexUserPlaylists(t *testing.T) {
+	_, c := newEmulator(t)
+
+	lists, err := c.UserPlaylists(context.Background())
+	if err != nil {
+		t.Fatalf("UserPlaylists failed: %v", err)
+	}
+	if len(lists) != 2 {
+		t.Fatalf("Expected liked + 1 playlist, got %+v", lists)
+	}
+	if liked := lists[0]; liked.Kind != catalog.LikedKind || liked.OwnerUID != 1 || liked.TrackCount != 2 || liked.Revision != 42 {
+		t.Errorf("Unexpected liked playlist: %+v", liked)
+	}
+	if p := lists[1]; p.Kind != 1001 || p.Title != "Road trip" || p.Revision != 7 || p.CoverURI == "" {
+		t.Errorf("Unexpected playlist: %+v", p)
+	}
+}
+
+func TestYandexPlaylist(t *testing.T) {
+	srv, c := newEmulator(t)
+
+	p, err := c.Playlist(context.Background(), 777, 1005)
+	if err != nil {
+		t.Fatalf("Playlist failed: %v", err)
+	}
+	if p.Title != "Fusion Essentials" || len(p.Tracks) != 2 || p.Tracks[1].Ref() != (catalog.TrackRef{ID: 1002, AlbumID: 3002}) {
+		t.Errorf("Unexpected playlist: %+v", p)
+	}
+
+	var ids string
+	srv.Handle("/tracks", func(w http.ResponseWriter, r *http.Request) {
+		ids = r.FormValue("track-ids")
+		data, _ := os.ReadFile("testdata/yandex/tracks.json")
+		w.Write(data)
+	})
+	liked, err := c.Playlist(context.Background(), 1, catalog.LikedKind)
+	if err != nil {
+		t.Fatalf("Playlist(liked) failed: %v", err)
+	}
+	if ids != "1002,1001" || len(liked.Tracks) != 2 || liked.DurationMs != 1077000 || liked.Title != catalog.LikedTitle {
+		t.Errorf("Unexpected liked playlist (track-ids %q): %+v", ids, liked)
+	}
+}
+
+func TestYandexChangePlaylist(t *testing.T) {
+	srv, c := newEmulator(t)
+	var form url.Values
+	srv.Handle("/users/1/playlists/1001/change-relative", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		if form.Get("revision") != "7" {
+			yandextest.Error(w, http.StatusPreconditionFailed, "wrong-revision", "revision mismatch")
+			return
+		}
+		w.Write([]byte(`{"result": {"owner": {"uid": 1}, "kind": 1001, "title": "Road trip", "trackCount": 13, "revision": 8}}`))
+	})
+
+	ops := []catalog.PlaylistOp{catalog.DeleteOp(0, 1), catalog.InsertOp(3, catalog.TrackRef{ID: 1001, AlbumID: 3001})}
+	p, err := c.ChangePlaylist(context.Background(), 1001, 7, ops)
+	if err != nil {
+		t.Fatalf("ChangePlaylist failed: %v", err)
+	}
+	if p.Revision != 8 || p.TrackCount != 13 {
+		t.Errorf("Unexpected playlist: %+v", p)
+	}
+	want := `[{"from":0,"op":"delete","to":1},{"at":3,"op":"insert","tracks":[{"albumId":"3001","id":"1001"}]}]`
+	if form.Get("diff") != want {
+		t.Errorf("Unexpected diff:\n got %s\nwant %s", form.Get("diff"), want)
+	}
+
+	if _, err := c.ChangePlaylist(context.Background(), 1001, 6, ops); !errors.Is(err, catalog.ErrWrongRevision) {
+		t.Errorf("Expected ErrWrongRevision for a stale revision, got %v", err)
+	}
+	if _, err := c.ChangePlaylist(context.Background(), catalog.LikedKind, 42, ops); !errors.Is(err, catalog.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly for the liked playlist, got %v", err)
+	}
+}
+
+func TestApplyOps(t *testing.T) {
+	refs := []catalog.TrackRef{{ID: 1}, {ID: 2}, {ID: 3}}
+	p := &catalog.Playlist{Tracks: []catalog.Track{{ID: 1}, {ID: 2}, {ID: 3}}}
+
+	ops, err := catalog.MoveOps(p, 0, 2)
+	if err != nil {
+		t.Fatalf("MoveOps failed: %v", err)
+	}
+	got, err := catalog.ApplyOps(refs, ops)
+	if err != nil {
+		t.Fatalf("ApplyOps failed: %v", err)
+	}
+	if len(got) != 3 || got[0].ID != 2 || got[1].ID != 3 || got[2].ID != 1 {
+		t.Errorf("Unexpected order after move: %+v", got)
+	}
+	if refs[0].ID != 1 {
+		t.Error("ApplyOps modified its input")
+	}
+
+	if _, err := catalog.ApplyOps(refs, []catalog.PlaylistOp{catalog.DeleteOp(2, 5)}); err == nil {
+		t.Error("Expected an error for an out-of-range delete")
+	}
+	if _, err := catalog.MoveOps(p, 3, 0); err == nil {
+		t.Error("Expected an error for an out-of-range move")
+	}
+}
+
+func TestYandexLibrary(t *testing.T) {
+	srv, c := newEmulator(t)
+
+	albums, err := c.LikedAlbums(context.Background())
+	if err != nil || len(albums) != 1 || albums[0].ID != 3001 {
+		t.Errorf("Unexpected liked albums %+v (%v)", albums, err)
+	}
+	liked, err := c.LikedArtists(context.Background())
+	if err != nil || len(liked) != 2 || liked[1].Name != "Stanley Clarke" {
+		t.Errorf("Unexpected liked artists %+v (%v)", liked, err)
+	}
+	disliked, err := c.DislikedTrackIDs(context.Background())
+	if err != nil || len(disliked) != 1 || disliked[0] != 1002 {
+		t.Errorf("Unexpected disliked tracks %v (%v)", disliked, err)
+	}
+
+	var form url.Values
+	srv.Handle("/users/1/likes/albums/add-multiple", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"result": "ok"}`))
+	})
+	if err := c.Like(context.Background(), catalog.LikeAlbum, 3001); err != nil {
+		t.Fatalf("Like failed: %v", err)
+	}
+	if form.Get("album-ids") != "3001" {
+		t.Errorf("Unexpected like form: %v", form)
+	}
+	if err := c.Like(context.Background(), "playlist", 1); err == nil {
+		t.Error("Expected an error for an unknown like kind")
+	}
+}
+
+func TestDislikesFilter(t *testing.T) {
+	fake := catalog.NewFake()
+	fake.Disliked = []int{2}
+	d := catalog.NewDislikes(fake)
+	tracks := []catalog.Track{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	got := d.Filter(context.Background(), tracks)
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 3 || len(tracks) != 3 {
+		t.Errorf("Unexpected filtered tracks: %+v", got)
+	}
+
+	d.Set(3, true)
+	d.Set(2, false)
+	got = d.Filter(context.Background(), tracks)
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Errorf("Unexpected tracks after Set: %+v", got)
+	}
+	if fake.Calls["DislikedTrackIDs"] != 1 {
+		t.Errorf("Expected dislikes to be loaded once, got %d", fake.Calls["DislikedTrackIDs"])
+	}
+
+	var nilFilter *catalog.Dislikes
+	if got := nilFilter.Filter(context.Background(), tracks); len(got) != 3 {
+		t.Errorf("Expected a nil filter to keep all tracks, got %+v", got)
+	}
+}
+
+// slowLibrary holds DislikedTrackIDs until release is closed
+type slowLibrary struct {
+	*catalog.Fake
+	started chan struct{}
+	release chan struct{}
+}
+
+func (l *slowLibrary) DislikedTrackIDs(ctx context.Context) ([]int, error) {
+	l.started <- struct{}{}
+	<-l.release
+	return l.Fake.DislikedTrackIDs(ctx)
+}
+
+func TestDislikesLoadUnlocked(t *testing.T) {
+	fake := catalog.NewFake()
+	fake.Disliked = []int{2}
+	lib := &slowLibrary{Fake: fake, started: make(chan struct{}, 1), release: make(chan struct{})}
+	d := catalog.NewDislikes(lib)
+	tracks := []catalog.Track{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	results := make(chan []catalog.Track, 2)
+	for i := 0; i < 2; i++ {
+		go func() { results <- d.Filter(context.Background(), tracks) }()
+	}
+	<-lib.started
+
+	// A dislike made while the list is loading neither waits for the load
+	// nor gets lost when the older list arrives
+	set := make(chan struct{})
+	go func() {
+		d.Set(3, true)
+		close(set)
+	}()
+	select {
+	case <-set:
+	case <-time.After(time.Second):
+		t.Fatal("Set waited for the load")
+	}
+
+	close(lib.release)
+	for i := 0; i < 2; i++ {
+		if got := <-results; len(got) != 1 || got[0].ID != 1 {
+			t.Errorf("Unexpected filtered tracks: %+v", got)
+		}
+	}
+	if fake.Calls["DislikedTrackIDs"] != 1 {
+		t.Errorf("Expected concurrent filters to share one load, got %d", fake.Calls["DislikedTrackIDs"])
+	}
+	if got := d.Filter(context.Background(), tracks); len(got) != 1 {
+		t.Errorf("Expected track 3 to stay disliked, got %+v", got)
+	}
+}
+
+// panickyLibrary panics in DislikedTrackIDs while panics is set
+type panickyLibrary struct {
+	*catalog.Fake
+	started chan struct{}
+	release chan struct{}
+	panics  atomic.Bool
+}
+
+func (l *panickyLibrary) DislikedTrackIDs(ctx context.Context) ([]int, error) {
+	if l.panics.Load() {
+		close(l.started)
+		<-l.release
+		panic("boom")
+	}
+	return l.Fake.DislikedTrackIDs(ctx)
+}
+
+func TestDislikesLoadPanics(t *testing.T) {
+	fake := catalog.NewFake()
+	fake.Disliked = []int{2}
+	lib := &panickyLibrary{Fake: fake, started: make(chan struct{}), release: make(chan struct{})}
+	lib.panics.Store(true)
+	d := catalog.NewDislikes(lib)
+	tracks := []catalog.Track{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	loader := make(chan interface{})
+	go func() {
+		defer func() { loader <- recover() }()
+		d.Filter(context.Background(), tracks)
+	}()
+	<-lib.started
+
+	// A caller waiting for the load is let go once it has panicked
+	waiter := make(chan []catalog.Track)
+	go func() { waiter <- d.Filter(context.Background(), tracks) }()
+	time.Sleep(20 * time.Millisecond)
+	close(lib.release)
+	if v := <-loader; v != "boom" {
+		t.Errorf("Expected the panic to reach the loader, got %v", v)
+	}
+	select {
+	case got := <-waiter:
+		if len(got) != 3 {
+			t.Errorf("Expected the waiter to get the tracks unfiltered, got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The waiter is still waiting for the panicked load")
+	}
+
+	// The next caller loads again
+	lib.panics.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if got := d.Filter(ctx, tracks); len(got) != 2 {
+		t.Errorf("Expected track 2 to be filtered after a new load, got %+v", got)
+	}
+}
+
+func TestYandexRadio(t *testing.T) {
+	srv, c := newEmulator(t)
+
+	stations, err := c.Stations(context.Background())
+	if err != nil {
+		t.Fatalf("Stations failed: %v", err)
+	}
+	if len(stations) != 3 || stations[0].ID != catalog.MyWave || stations[1].ID != "genre:jazz" || stations[1].Type() != catalog.StationGenre || stations[1].IconURI == "" {
+		t.Errorf("Unexpected stations: %+v", stations)
+	}
+
+	var query url.Values
+	srv.Handle("/rotor/station/genre:jazz/tracks", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"result": {"id": {"type": "genre", "tag": "jazz"}, "batchId": "b-1", "sequence": [
+			{"type": "track", "track": {"id": "1001", "title": "Spain", "albums": [{"id": 3001}]}},
+			{"type": "ad"}
+		]}}`))
+	})
+	batch, err := c.StationTracks(context.Background(), "genre:jazz", 1002)
+	if err != nil {
+		t.Fatalf("StationTracks failed: %v", err)
+	}
+	if batch.BatchID != "b-1" || len(batch.Tracks) != 1 || batch.Tracks[0].ID != 1001 || query.Get("queue") != "1002" {
+		t.Errorf("Unexpected batch %+v for query %v", batch, query)
+	}
+
+	var body map[string]interface{}
+	var batchID string
+	srv.Handle("/rotor/station/genre:jazz/feedback", func(w http.ResponseWriter, r *http.Request) {
+		batchID = r.URL.Query().Get("batch-id")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"result": "ok"}`))
+	})
+	fb := catalog.Feedback{Type: catalog.FeedbackSkip, BatchID: "b-1", Track: catalog.TrackRef{ID: 1001, AlbumID: 3001}, PlayedSeconds: 12.5}
+	if err := c.RadioFeedback(context.Background(), "genre:jazz", fb); err != nil {
+		t.Fatalf("RadioFeedback failed: %v", err)
+	}
+	if batchID != "b-1" || body["type"] != "skip" || body["trackId"] != "1001:3001" || body["totalPlayedSeconds"] != 12.5 || body["timestamp"] == nil {
+		t.Errorf("Unexpected feedback %v (batch %q)", body, batchID)
+	}
+
+	if _, err := c.StationTracks(context.Background(), "../admin", 0); err == nil {
+		t.Error("Expected an error for an invalid station")
+	}
+}
+
+func TestParseLRC(t *testing.T) {
+	lrc := "[ar:Chick Corea]\n[00:12.50]First line\n[00:05.1][01:02.003] Chorus \nno timestamp\n[00:20.00]"
+	lines := catalog.ParseLRC(lrc)
+
+	want := []catalog.LyricLine{
+		{Time: 5100 * time.Millisecond, Text: "Chorus"},
+		{Time: 12500 * time.Millisecond, Text: "First line"},
+		{Time: 20 * time.Second, Text: ""},
+		{Time: 62003 * time.Millisecond, Text: "Chorus"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines, got %+v", len(want), lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("Line %d: expected %+v, got %+v", i, want[i], lines[i])
+		}
+	}
+
+	l := &catalog.Lyrics{Lines: lines}
+	if l.LineAt(time.Second) != -1 || l.LineAt(13*time.Second) != 1 || l.LineAt(time.Hour) != 3 {
+		t.Errorf("Unexpected LineAt results: %d %d %d", l.LineAt(time.Second), l.LineAt(13*time.Second), l.LineAt(time.Hour))
+	}
+}
+
+func TestYandexLyrics(t *testing.T) {
+	srv, c := newEmulator(t)
+	srv.Handle("/tracks/1003", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result": [{"id": "1003", "title": "Sometime Ago", "lyricsInfo": {"hasAvailableSyncLyrics": true, "hasAvailableTextLyrics": true}}]}`))
+	})
+	var query url.Values
+	srv.Handle("/tracks/1003/lyrics", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"result": {"downloadUrl": "https://lyrics.example/1003.lrc", "writers": ["Chick Corea"]}}`))
+	})
+	srv.Handle("/1003.lrc", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[00:01.00]Sometime ago\n[00:04.00]there was a dream"))
+	})
+
+	lyrics, err := c.Lyrics(context.Background(), 1003)
+	if err != nil {
+		t.Fatalf("Lyrics failed: %v", err)
+	}
+	if !lyrics.Synced() || len(lyrics.Lines) != 2 || lyrics.Text != "Sometime ago\nthere was a dream" || len(lyrics.Writers) != 1 {
+		t.Errorf("Unexpected lyrics: %+v", lyrics)
+	}
+	if query.Get("format") != "LRC" || query.Get("sign") == "" || query.Get("timeStamp") == "" {
+		t.Errorf("Unexpected lyrics query: %v", query)
+	}
+
+	if _, err := c.Lyrics(context.Background(), 1001); !errors.Is(err, catalog.ErrNoLyrics) {
+		t.Errorf("Expected ErrNoLyrics for a track without lyrics, got %v", err)
+	}
+}
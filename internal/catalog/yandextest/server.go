@@ -0,0 +1,115 @@
+// Package yandextest runs an in-process emulation of the Yandex Music API
+// for offline tests. It answers requests with canned JSON fixtures, so the
+// real yamusic-backed catalog can be exercised without a token.
+package yandextest
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"pkg.botr.me/yamusic"
+)
+
+// Server is a fake api.music.yandex.net.
+type Server struct {
+	*httptest.Server
+
+	// Audio is returned for any request under /get-mp3/.
+	Audio []byte
+
+	fixtures fs.FS
+
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	requests []string
+}
+
+// NewServer serves fixtures from fsys. A request for /albums/1/with-tracks
+// is answered with the file albums/1/with-tracks.json; the query string is
+// ignored. Requests without a fixture get a 404 in the API's error format.
+func NewServer(fsys fs.FS) *Server {
+	s := &Server{
+		fixtures: fsys,
+		handlers: make(map[string]http.HandlerFunc),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Handle overrides the response for an exact path, e.g. to inject errors.
+func (s *Server) Handle(path string, h http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[path] = h
+}
+
+// Requests returns the paths requested so far, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Client returns a yamusic client whose requests are routed to the emulator.
+func (s *Server) Client() *yamusic.Client {
+	return yamusic.NewClient(
+		yamusic.HTTPClient(s.HTTPClient()),
+		yamusic.AccessToken(1, "test-token"),
+	)
+}
+
+// HTTPClient returns an http.Client that sends every request, whatever its
+// host, to the emulator.
+func (s *Server) HTTPClient() *http.Client {
+	return &http.Client{Transport: rewriteTransport{host: s.Listener.Addr().String()}}
+}
+
+type rewriteTransport struct {
+	host string
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	req.URL.Host = t.host
+	req.Host = t.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Path)
+	h := s.handlers[r.URL.Path]
+	s.mu.Unlock()
+
+	if h != nil {
+		h(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/get-mp3/") {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(s.Audio)
+		return
+	}
+
+	data, err := fs.ReadFile(s.fixtures, strings.TrimPrefix(r.URL.Path, "/")+".json")
+	if err != nil {
+		Error(w, http.StatusNotFound, "not-found", "no fixture for "+r.URL.Path)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Error writes an error in the shape the API uses.
+func Error(w http.ResponseWriter, status int, name, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"name": name, "message": message},
+	})
+}
@@ -0,0 +1,39 @@
+package id3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxCoverSize caps how much image data is embedded into a single file.
+const maxCoverSize = 5 << 20
+
+// FetchCover downloads the image at url for use as Tag.Cover.
+func FetchCover(ctx context.Context, client *http.Client, url string) (*Picture, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cover: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCoverSize))
+	if err != nil {
+		return nil, err
+	}
+	mime := resp.Header.Get("Content-Type")
+	if mime == "" || mime == "application/octet-stream" {
+		mime = http.DetectContentType(data)
+	}
+	return &Picture{MIME: mime, Data: data}, nil
+}
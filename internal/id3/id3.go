@@ -0,0 +1,180 @@
+// Package id3 writes ID3v2.4 tags in front of MP3 streams.
+//
+// Tags are written in a single pass, so audio can be tagged while it is
+// being downloaded without buffering the whole file.
+package id3
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Tag holds the metadata written into an ID3v2.4 header.
+// Zero-valued fields are omitted.
+type Tag struct {
+	Title       string
+	Artists     []string
+	Album       string
+	AlbumArtist string
+	Track       int // Track number within the disc
+	TrackTotal  int // Number of tracks on the disc
+	Disc        int
+	DiscTotal   int
+	Year        int
+	Genre       string
+	Cover       *Picture
+}
+
+// Picture is an embedded image, written as the front cover.
+type Picture struct {
+	MIME string // e.g. "image/jpeg"
+	Data []byte
+}
+
+const (
+	headerSize       = 10
+	encodingUTF8     = 0x03
+	pictureTypeFront = 0x03
+	flagFooter       = 0x10
+)
+
+// Bytes encodes the tag, including the 10-byte ID3 header.
+func (t *Tag) Bytes() []byte {
+	var frames bytes.Buffer
+	writeText(&frames, "TIT2", t.Title)
+	writeText(&frames, "TPE1", t.Artists...)
+	writeText(&frames, "TALB", t.Album)
+	writeText(&frames, "TPE2", t.AlbumArtist)
+	writeText(&frames, "TRCK", position(t.Track, t.TrackTotal))
+	writeText(&frames, "TPOS", position(t.Disc, t.DiscTotal))
+	if t.Year > 0 {
+		writeText(&frames, "TDRC", strconv.Itoa(t.Year))
+	}
+	writeText(&frames, "TCON", t.Genre)
+	if t.Cover != nil && len(t.Cover.Data) > 0 {
+		var apic bytes.Buffer
+		apic.WriteByte(encodingUTF8)
+		apic.WriteString(t.Cover.MIME)
+		apic.WriteByte(0)
+		apic.WriteByte(pictureTypeFront)
+		apic.WriteByte(0) // empty description
+		apic.Write(t.Cover.Data)
+		writeFrame(&frames, "APIC", apic.Bytes())
+	}
+
+	out := make([]byte, headerSize, headerSize+frames.Len())
+	copy(out, "ID3")
+	out[3] = 4 // version 2.4.0
+	putSyncsafe(out[6:], frames.Len())
+	return append(out, frames.Bytes()...)
+}
+
+// WriteTo writes the encoded tag to w.
+func (t *Tag) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(t.Bytes())
+	return int64(n), err
+}
+
+// Copy writes t to w followed by the MP3 data from r. An ID3v2 tag already
+// present at the start of r is dropped so the file doesn't carry two.
+// A nil tag copies the audio untouched.
+func Copy(w io.Writer, r io.Reader, t *Tag) (int64, error) {
+	var written int64
+	if t != nil {
+		n, err := t.WriteTo(w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		r, err = skipTag(r)
+		if err != nil {
+			return written, err
+		}
+	}
+	n, err := io.Copy(w, r)
+	return written + n, err
+}
+
+// skipTag discards a leading ID3v2 tag from r, if there is one.
+func skipTag(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	hdr, err := br.Peek(headerSize)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return br, nil
+		}
+		return nil, err
+	}
+	if string(hdr[:3]) != "ID3" || hdr[3] == 0xff || hdr[4] == 0xff {
+		return br, nil
+	}
+	size, ok := syncsafe(hdr[6:10])
+	if !ok {
+		return br, nil
+	}
+	size += headerSize
+	if hdr[5]&flagFooter != 0 {
+		size += headerSize
+	}
+	if _, err := br.Discard(size); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+func writeText(buf *bytes.Buffer, id string, values ...string) {
+	var nonEmpty []string
+	for _, v := range values {
+		if v != "" {
+			nonEmpty = append(nonEmpty, v)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return
+	}
+	// ID3v2.4 separates multiple values of a text frame with a null byte.
+	data := append([]byte{encodingUTF8}, strings.Join(nonEmpty, "\x00")...)
+	writeFrame(buf, id, data)
+}
+
+func writeFrame(buf *bytes.Buffer, id string, data []byte) {
+	var hdr [headerSize]byte
+	copy(hdr[:4], id)
+	putSyncsafe(hdr[4:8], len(data))
+	buf.Write(hdr[:])
+	buf.Write(data)
+}
+
+func position(n, total int) string {
+	switch {
+	case n <= 0:
+		return ""
+	case total > 0:
+		return strconv.Itoa(n) + "/" + strconv.Itoa(total)
+	default:
+		return strconv.Itoa(n)
+	}
+}
+
+// putSyncsafe stores n as a 28-bit syncsafe integer (7 bits per byte).
+func putSyncsafe(b []byte, n int) {
+	b[0] = byte(n>>21) & 0x7f
+	b[1] = byte(n>>14) & 0x7f
+	b[2] = byte(n>>7) & 0x7f
+	b[3] = byte(n) & 0x7f
+}
+
+func syncsafe(b []byte) (int, bool) {
+	n := 0
+	for _, c := range b {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		n = n<<7 | int(c)
+	}
+	return n, true
+}
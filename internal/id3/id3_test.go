@@ -0,0 +1,96 @@
+package id3
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// frames parses the frames of an encoded tag into id -> payload.
+func frames(t *testing.T, tag []byte) map[string][]byte {
+	t.Helper()
+	if string(tag[:3]) != "ID3" || tag[3] != 4 {
+		t.Fatalf("Not an ID3v2.4 header: %q", tag[:5])
+	}
+	size, ok := syncsafe(tag[6:10])
+	if !ok || size != len(tag)-headerSize {
+		t.Fatalf("Header size %d does not match body %d", size, len(tag)-headerSize)
+	}
+	out := map[string][]byte{}
+	body := tag[headerSize:]
+	for len(body) >= headerSize {
+		n, _ := syncsafe(body[4:8])
+		out[string(body[:4])] = body[headerSize : headerSize+n]
+		body = body[headerSize+n:]
+	}
+	return out
+}
+
+func TestTagFrames(t *testing.T) {
+	tag := &Tag{
+		Title:       "Песня",
+		Artists:     []string{"A", "B"},
+		Album:       "Album",
+		AlbumArtist: "A",
+		Track:       3,
+		TrackTotal:  12,
+		Disc:        1,
+		Year:        2001,
+		Cover:       &Picture{MIME: "image/jpeg", Data: []byte{0xff, 0xd8, 0xff}},
+	}
+	f := frames(t, tag.Bytes())
+
+	if got := string(f["TIT2"][1:]); got != "Песня" {
+		t.Errorf("TIT2 = %q", got)
+	}
+	if got := string(f["TPE1"][1:]); got != "A\x00B" {
+		t.Errorf("TPE1 = %q, want null-separated artists", got)
+	}
+	if got := string(f["TRCK"][1:]); got != "3/12" {
+		t.Errorf("TRCK = %q", got)
+	}
+	if got := string(f["TPOS"][1:]); got != "1" {
+		t.Errorf("TPOS = %q", got)
+	}
+	if got := string(f["TDRC"][1:]); got != "2001" {
+		t.Errorf("TDRC = %q", got)
+	}
+	if _, ok := f["TCON"]; ok {
+		t.Error("Empty genre should not produce a TCON frame")
+	}
+	if apic := f["APIC"]; !bytes.HasSuffix(apic, tag.Cover.Data) || !bytes.Contains(apic, []byte("image/jpeg\x00")) {
+		t.Errorf("APIC frame malformed: %q", apic)
+	}
+}
+
+func TestCopyReplacesExistingTag(t *testing.T) {
+	old := (&Tag{Title: "old"}).Bytes()
+	audio := []byte("\xff\xfbaudio-frames")
+	src := bytes.NewReader(append(old, audio...))
+
+	var out bytes.Buffer
+	if _, err := Copy(&out, src, &Tag{Title: "new"}); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+
+	if strings.Count(out.String(), "ID3") != 1 {
+		t.Errorf("Expected exactly one ID3 header, got %q", out.String())
+	}
+	if !bytes.HasSuffix(out.Bytes(), audio) {
+		t.Errorf("Audio data not preserved: %q", out.Bytes())
+	}
+	if !bytes.Contains(out.Bytes(), []byte("new")) || bytes.Contains(out.Bytes(), []byte("old")) {
+		t.Errorf("Expected only the new tag, got %q", out.Bytes())
+	}
+}
+
+func TestCopyWithoutTag(t *testing.T) {
+	audio := []byte("ID3-looking-but-short")
+	var out bytes.Buffer
+	if _, err := Copy(&out, bytes.NewReader(audio), nil); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), audio) {
+		t.Errorf("Expected audio untouched, got %q", out.Bytes())
+	}
+}
@@ -0,0 +1,276 @@
+// Package metrics is a minimal Prometheus client: labelled counters and
+// histograms kept in memory and written in the text exposition format, so
+// the web server can be scraped without pulling in client_golang.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds, from 5ms to 10s.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metric families and writes them out. It is safe for
+// concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	names    map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// family is one metric name with its label names and series.
+type family struct {
+	name    string
+	help    string
+	typ     string // "counter", "gauge" or "histogram"
+	labels  []string
+	buckets []float64      // Histograms only
+	value   func() float64 // Gauge functions only
+
+	mu     sync.Mutex
+	series map[string]*series // By label values joined with labelSep
+}
+
+// labelSep joins label values into a series key; it can't occur in UTF-8.
+const labelSep = "\xff"
+
+type series struct {
+	values []string
+	mu     sync.Mutex
+	count  float64   // Counter value, or number of observations
+	sum    float64   // Histograms only
+	counts []float64 // Per bucket, not cumulative
+}
+
+func (r *Registry) register(f *family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[f.name] {
+		panic("metrics: " + f.name + " registered twice")
+	}
+	r.names[f.name] = true
+	f.series = make(map[string]*series)
+	r.families = append(r.families, f)
+}
+
+// with returns the series for the label values, creating it on first use.
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, labelSep)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.typ == "histogram" {
+			s.counts = make([]float64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// CounterVec is a counter with labels.
+type CounterVec struct{ f *family }
+
+// Counter is one series of a CounterVec.
+type Counter struct{ s *series }
+
+// Counter registers a counter. The name should end in _total.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	f := &family{name: name, help: help, typ: "counter", labels: labels}
+	r.register(f)
+	return &CounterVec{f}
+}
+
+// With returns the counter for the given label values, in the order the
+// labels were registered.
+func (v *CounterVec) With(values ...string) Counter {
+	return Counter{v.f.with(values)}
+}
+
+// Inc adds 1.
+func (c Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds n, which must not be negative.
+func (c Counter) Add(n float64) {
+	if n < 0 {
+		panic("metrics: counters can't decrease")
+	}
+	c.s.mu.Lock()
+	c.s.count += n
+	c.s.mu.Unlock()
+}
+
+// HistogramVec is a histogram with labels.
+type HistogramVec struct{ f *family }
+
+// Histogram is one series of a HistogramVec.
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// Histogram registers a histogram with the given upper bucket bounds, in
+// increasing order; +Inf is implied.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: " + name + " buckets are not sorted")
+	}
+	f := &family{name: name, help: help, typ: "histogram", labels: labels, buckets: buckets}
+	r.register(f)
+	return &HistogramVec{f}
+}
+
+// With returns the histogram for the given label values.
+func (v *HistogramVec) With(values ...string) Histogram {
+	return Histogram{v.f.with(values), v.f.buckets}
+}
+
+// Observe records a value.
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.s.mu.Lock()
+	if i < len(h.s.counts) {
+		h.s.counts[i]++
+	}
+	h.s.count++
+	h.s.sum += v
+	h.s.mu.Unlock()
+}
+
+// GaugeFunc registers a gauge without labels whose value is read from f at
+// every scrape.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(&family{name: name, help: help, typ: "gauge", value: f})
+}
+
+// WriteTo writes all metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// Handler serves the metrics for scraping.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+func (f *family) write(w *countingWriter) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ)
+	if f.value != nil {
+		fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.value()))
+		return
+	}
+
+	f.mu.Lock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].values, labelSep) < strings.Join(all[j].values, labelSep)
+	})
+
+	for _, s := range all {
+		s.mu.Lock()
+		labels := f.labelPairs(s.values)
+		if f.typ != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, braces(labels), formatFloat(s.count))
+			s.mu.Unlock()
+			continue
+		}
+		var cumulative float64
+		for i, le := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %s\n", f.name, braces(append(labels, `le="`+formatFloat(le)+`"`)), formatFloat(cumulative))
+		}
+		fmt.Fprintf(w, "%s_bucket%s %s\n", f.name, braces(append(labels, `le="+Inf"`)), formatFloat(s.count))
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, braces(labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", f.name, braces(labels), formatFloat(s.count))
+		s.mu.Unlock()
+	}
+}
+
+// labelPairs renders name="value" pairs. The result has spare capacity so
+// appending le doesn't share memory between calls.
+func (f *family) labelPairs(values []string) []string {
+	pairs := make([]string, len(values), len(values)+1)
+	for i, v := range values {
+		pairs[i] = f.labels[i] + `="` + escapeLabel(v) + `"`
+	}
+	return pairs
+}
+
+func braces(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+// countingWriter remembers the bytes written and the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
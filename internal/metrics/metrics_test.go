@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// TestWriteTo tests the text format of counters, histograms and gauges
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests served.", "route", "status")
+	requests.With("/b", "200").Inc()
+	requests.With("/a", "500").Add(2)
+	requests.With("/a", "500").Inc()
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.With("/a").Observe(0.05)
+	latency.With("/a").Observe(0.5)
+	latency.With("/a").Observe(5)
+	r.GaugeFunc("up", "Always one.", func() float64 { return 1 })
+
+	var b strings.Builder
+	n, err := r.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) {
+		t.Fatalf("WriteTo returned %d, %v for %d bytes", n, err, b.Len())
+	}
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a",status="500"} 3
+requests_total{route="/b",status="200"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 5.55
+latency_seconds_count{route="/a"} 3
+# HELP up Always one.
+# TYPE up gauge
+up 1
+`
+	if b.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+// TestEscaping tests that label values and help text are escaped
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("c_total", "Line one\nline two \\ done.", "v").With("say \"hi\"\n\\").Inc()
+
+	var b strings.Builder
+	r.WriteTo(&b)
+	for _, want := range []string{
+		`# HELP c_total Line one\nline two \\ done.`,
+		`c_total{v="say \"hi\"\n\\"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, b.String())
+		}
+	}
+}
+
+// TestRegistryPanics tests that misuse is caught early
+func TestRegistryPanics(t *testing.T) {
+	for name, f := range map[string]func(r *Registry){
+		"duplicate name":   func(r *Registry) { r.Counter("x_total", ""); r.Counter("x_total", "") },
+		"unsorted buckets": func(r *Registry) { r.Histogram("h", "", []float64{1, 0.5}) },
+		"label count":      func(r *Registry) { r.Counter("y_total", "", "a").With("1", "2") },
+		"negative add":     func(r *Registry) { r.Counter("z_total", "").With().Add(-1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			f(NewRegistry())
+		}()
+	}
+}
+
+// TestHandler tests the scrape endpoint's content type
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("c_total", "A counter.").With().Inc()
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "c_total 1\n") {
+		t.Errorf("Unexpected body %q", w.Body.String())
+	}
+}
+
+// TestParse tests that Prometheus' own parser reads the output back
+func TestParse(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests \"served\"\\\nby route.", "route", "status")
+	requests.With("/a", "200").Add(2)
+	requests.With("say \"hi\"\n\\", "500").Inc()
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.With("/a").Observe(0.05)
+	latency.With("/a").Observe(5)
+	r.GaugeFunc("up", "Always one.", func() float64 { return 1 })
+	r.Counter("unused_total", "Never incremented.", "route")
+
+	var b strings.Builder
+	r.WriteTo(&b)
+	var p expfmt.TextParser
+	families, err := p.TextToMetricFamilies(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("Failed to parse:\n%s\n%v", b.String(), err)
+	}
+
+	c := families["requests_total"]
+	if c.GetType() != dto.MetricType_COUNTER || c.GetHelp() != "Requests \"served\"\\\nby route." || len(c.Metric) != 2 {
+		t.Fatalf("Unexpected counter %v", c)
+	}
+	values := map[string]float64{}
+	for _, m := range c.Metric {
+		values[m.Label[0].GetValue()] = m.GetCounter().GetValue()
+	}
+	if values["/a"] != 2 || values["say \"hi\"\n\\"] != 1 {
+		t.Errorf("Unexpected counter values %v", values)
+	}
+
+	h := families["latency_seconds"]
+	if h.GetType() != dto.MetricType_HISTOGRAM || len(h.Metric) != 1 {
+		t.Fatalf("Unexpected histogram %v", h)
+	}
+	hist := h.Metric[0].GetHistogram()
+	if hist.GetSampleCount() != 2 || hist.GetSampleSum() != 5.05 || len(hist.Bucket) != 3 {
+		t.Fatalf("Unexpected histogram %v", hist)
+	}
+	for i, want := range []uint64{1, 1, 2} {
+		if got := hist.Bucket[i].GetCumulativeCount(); got != want {
+			t.Errorf("Bucket %v has count %d, want %d", hist.Bucket[i].GetUpperBound(), got, want)
+		}
+	}
+
+	if g := families["up"]; g.GetType() != dto.MetricType_GAUGE || g.Metric[0].GetGauge().GetValue() != 1 {
+		t.Errorf("Unexpected gauge %v", g)
+	}
+}
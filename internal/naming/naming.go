@@ -0,0 +1,262 @@
+// Package naming turns track metadata into file names through templates
+// such as "{albumartist}/{year} - {album}/{disc}-{track} {title}".
+//
+// Placeholders are {artist}, {albumartist}, {album}, {year}, {disc},
+// {track}, {title} and {version}. A "/" in the template starts a
+// directory. Text in square brackets is left out when a placeholder in it
+// has no value, so "{title}[ ({version})]" only adds the parentheses for
+// tracks that have a version. Every path element is sanitized so the
+// result is a valid relative path on Windows, macOS and Linux, whatever
+// the metadata contains.
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go_yandex_music/internal/catalog"
+)
+
+// maxElement is the longest path element produced, in bytes. It leaves
+// room for an extension within the usual 255 byte limit.
+const maxElement = 200
+
+// Fields are the values a template can refer to. Zero values render as
+// nothing.
+type Fields struct {
+	Artist      string // The track's artists
+	AlbumArtist string // The album's artists
+	Album       string
+	Year        int
+	Disc        int
+	Track       int // Position on the disc
+	TrackTotal  int // Tracks on the disc; {track} is padded to its width
+	Title       string
+	Version     string // e.g. "Live", "Remastered 2011"
+}
+
+// TrackFields returns the fields of a track, taking the album details from
+// the first album it appears on.
+func TrackFields(t catalog.Track) Fields {
+	f := Fields{
+		Artist:  catalog.ArtistNames(t.Artists),
+		Title:   t.Title,
+		Version: t.Version,
+	}
+	if len(t.Albums) > 0 {
+		a := t.Albums[0]
+		f.AlbumArtist = catalog.ArtistNames(a.Artists)
+		f.Album = a.Title
+		f.Year = a.Year
+		f.Disc = a.Position.Volume
+		f.Track = a.Position.Index
+	}
+	return f
+}
+
+// AlbumFields returns the fields of the track at album.Volumes[vol][idx].
+func AlbumFields(album *catalog.Album, vol, idx int) Fields {
+	t := album.Volumes[vol][idx]
+	f := TrackFields(t)
+	f.AlbumArtist = catalog.ArtistNames(album.Artists)
+	f.Album = album.Title
+	f.Year = album.Year
+	f.Disc = vol + 1
+	f.Track = idx + 1
+	f.TrackTotal = len(album.Volumes[vol])
+	return f
+}
+
+// Template is a parsed naming template. It is safe for concurrent use.
+type Template struct {
+	src      string
+	elements [][]part // One per path element
+}
+
+// part is a piece of a path element: literal text, a placeholder, or an
+// optional group of parts.
+type part struct {
+	text     string
+	field    string
+	optional []part
+}
+
+var placeholders = map[string]func(Fields) string{
+	"artist":      func(f Fields) string { return f.Artist },
+	"albumartist": func(f Fields) string { return f.AlbumArtist },
+	"album":       func(f Fields) string { return f.Album },
+	"year":        func(f Fields) string { return number(f.Year, 0) },
+	"disc":        func(f Fields) string { return number(f.Disc, 0) },
+	"track":       func(f Fields) string { return number(f.Track, max(2, len(strconv.Itoa(f.TrackTotal)))) },
+	"title":       func(f Fields) string { return f.Title },
+	"version":     func(f Fields) string { return f.Version },
+}
+
+func number(n, width int) string {
+	if n <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+// Parse parses a template. Templates must be relative paths, so they may
+// not start with "/" or contain empty, "." or ".." elements.
+func Parse(src string) (*Template, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, errors.New("naming: empty template")
+	}
+	t := &Template{src: src}
+	for _, elem := range strings.Split(src, "/") {
+		switch strings.TrimSpace(elem) {
+		case "", ".", "..":
+			return nil, fmt.Errorf("naming: template %q: path elements may not be empty, \".\" or \"..\"", src)
+		}
+		parts, rest, err := parseParts(elem, false)
+		if err != nil {
+			return nil, fmt.Errorf("naming: template %q: %w", src, err)
+		}
+		if rest != "" {
+			return nil, fmt.Errorf("naming: template %q: unexpected ]", src)
+		}
+		t.elements = append(t.elements, parts)
+	}
+	return t, nil
+}
+
+// MustParse is Parse for templates known to be valid.
+func MustParse(src string) *Template {
+	t, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// parseParts parses s up to the end or, inside a group, up to the closing
+// bracket. rest is what follows that bracket, starting with it.
+func parseParts(s string, inGroup bool) (parts []part, rest string, err error) {
+	for s != "" {
+		switch s[0] {
+		case '{':
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, "", errors.New("unclosed {")
+			}
+			name := s[1:end]
+			if _, ok := placeholders[name]; !ok {
+				return nil, "", fmt.Errorf("unknown placeholder {%s}", name)
+			}
+			parts = append(parts, part{field: name})
+			s = s[end+1:]
+		case '[':
+			if inGroup {
+				return nil, "", errors.New("nested [")
+			}
+			group, after, err := parseParts(s[1:], true)
+			if err != nil {
+				return nil, "", err
+			}
+			if after == "" {
+				return nil, "", errors.New("unclosed [")
+			}
+			parts = append(parts, part{optional: group})
+			s = after[1:]
+		case ']':
+			return parts, s, nil
+		case '}':
+			return nil, "", errors.New("unexpected }")
+		default:
+			end := strings.IndexAny(s, "{}[]")
+			if end < 0 {
+				end = len(s)
+			}
+			parts = append(parts, part{text: s[:end]})
+			s = s[end:]
+		}
+	}
+	return parts, "", nil
+}
+
+// String returns the template as it was parsed.
+func (t *Template) String() string {
+	return t.src
+}
+
+// Execute renders the template for f as a relative, "/"-separated path
+// without an extension. Use filepath.FromSlash for a local path.
+func (t *Template) Execute(f Fields) string {
+	elems := make([]string, len(t.elements))
+	for i, parts := range t.elements {
+		s, _ := render(parts, f)
+		elems[i] = Sanitize(s)
+	}
+	return strings.Join(elems, "/")
+}
+
+// render renders parts. ok is false if a placeholder had no value.
+func render(parts []part, f Fields) (s string, ok bool) {
+	var b strings.Builder
+	ok = true
+	for _, p := range parts {
+		switch {
+		case p.field != "":
+			v := placeholders[p.field](f)
+			if v == "" {
+				ok = false
+			}
+			// A value can't add path elements
+			b.WriteString(strings.NewReplacer("/", "_", "\\", "_").Replace(v))
+		case p.optional != nil:
+			if v, complete := render(p.optional, f); complete {
+				b.WriteString(v)
+			}
+		default:
+			b.WriteString(p.text)
+		}
+	}
+	return b.String(), ok
+}
+
+// reserved are names Windows doesn't allow for files, with or without an
+// extension.
+var reserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Sanitize makes s usable as a single file or directory name on every OS:
+// separators, characters Windows forbids and control characters become
+// "_", leading and trailing spaces and trailing dots are dropped, reserved
+// device names get a "_" prefix and the result is at most 200 bytes. An
+// empty result is "_".
+func Sanitize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > maxElement {
+		cut := maxElement
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut]
+	}
+	s = strings.TrimLeft(s, " ")
+	s = strings.TrimRight(s, " .")
+	if s == "" {
+		return "_"
+	}
+	base, _, _ := strings.Cut(s, ".")
+	if reserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+		s = "_" + s
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+
+	"go_yandex_music/internal/catalog"
+)
+
+var fields = Fields{
+	Artist:      "Queen, David Bowie",
+	AlbumArtist: "Queen",
+	Album:       "Hot Space",
+	Year:        1982,
+	Disc:        1,
+	Track:       11,
+	TrackTotal:  11,
+	Title:       "Under Pressure",
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		template string
+		fields   Fields
+		want     string
+	}{
+		{"{albumartist}/{year} - {album}/{disc}-{track} {title}", fields, "Queen/1982 - Hot Space/1-11 Under Pressure"},
+		{"{track}. {artist} - {title}", Fields{Track: 3, Artist: "A", Title: "B"}, "03. A - B"},
+		{"{track}", Fields{Track: 7, TrackTotal: 120}, "007"},
+		{"{title}[ ({version})]", Fields{Title: "Song"}, "Song"},
+		{"{title}[ ({version})]", Fields{Title: "Song", Version: "Live"}, "Song (Live)"},
+		{"[{disc}-]{track}", Fields{Track: 2}, "02"},
+		// Values never add directories
+		{"{artist}/{title}", Fields{Artist: "AC/DC", Title: "T.N.T."}, "AC_DC/T.N.T"},
+		// Missing values don't leave empty path elements
+		{"{album}/{title}", Fields{Title: "Loose"}, "_/Loose"},
+	}
+	for _, tt := range tests {
+		got := MustParse(tt.template).Execute(tt.fields)
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"/{title}",
+		"{album}//{title}",
+		"../{title}",
+		"{album}/./{title}",
+		"{name}",
+		"{title",
+		"title}",
+		"[{title}",
+		"{title}]",
+		"[[{title}]]",
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Parse(%q) succeeded", src)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain name", "plain name"},
+		{`a/b\c:d*e?f"g<h>i|j`, "a_b_c_d_e_f_g_h_i_j"},
+		{"tab\there\x00", "tab_here_"},
+		{"  dots...  ", "dots"},
+		{"..", "_"},
+		{"", "_"},
+		{"CON", "_CON"},
+		{"nul.mp3", "_nul.mp3"},
+		{"Console", "Console"},
+		{"Кино", "Кино"},
+	}
+	for _, tt := range tests {
+		if got := Sanitize(tt.in); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	long := Sanitize(strings.Repeat("я", 150))
+	if len(long) > maxElement || !strings.HasPrefix(strings.Repeat("я", 150), long) {
+		t.Errorf("Long name cut badly: %d bytes", len(long))
+	}
+}
+
+func TestAlbumFields(t *testing.T) {
+	album := &catalog.Album{
+		Title:   "Double",
+		Year:    2001,
+		Artists: []catalog.Artist{{Name: "Band"}},
+		Volumes: [][]catalog.Track{
+			{{Title: "One", Artists: []catalog.Artist{{Name: "Band"}}}},
+			{{Title: "Two", Version: "Demo", Artists: []catalog.Artist{{Name: "Band"}, {Name: "Guest"}}}, {Title: "Three"}},
+		},
+	}
+	got := MustParse("{albumartist} - {album} ({year})/{disc}-{track} {artist} - {title}[ ({version})]").Execute(AlbumFields(album, 1, 0))
+	if want := "Band - Double (2001)/2-01 Band, Guest - Two (Demo)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	track := catalog.Track{Title: "Solo", Artists: []catalog.Artist{{Name: "Artist"}}, Albums: []catalog.Album{{Title: "LP", Position: catalog.TrackPosition{Volume: 1, Index: 4}}}}
+	if got := MustParse("{album}/{track} {title}").Execute(TrackFields(track)); got != "LP/04 Solo" {
+		t.Errorf("TrackFields: got %q", got)
+	}
+}
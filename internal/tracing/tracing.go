@@ -0,0 +1,360 @@
+// Package tracing is a minimal OpenTelemetry-compatible tracer: spans with
+// attributes and parents, W3C traceparent propagation, and batched export
+// to stdout or to an OTLP collector (see export.go), without pulling in the
+// OpenTelemetry SDK.
+//
+// A nil *Tracer is valid and traces nothing, and so are the nil spans it
+// starts, so instrumented code doesn't need to check whether tracing is on.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxQueue      = 2048            // Ended spans waiting for export; more are dropped
+	maxBatch      = 512             // Spans per export
+	batchInterval = 5 * time.Second // Longest a span waits for export
+	exportTimeout = 10 * time.Second
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// SpanContext is what a span passes on to its children, in this process or,
+// through a traceparent header, in another one.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool // Whether spans of the trace are exported
+}
+
+// IsValid reports whether sc has a trace and span ID.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := 0
+	if sc.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01". Versions
+// after 00 are read as far as version 00 goes, as the spec asks.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, false
+	}
+	version := s[:2]
+	switch {
+	case !lowerHex(version) || version == "ff":
+		return sc, false
+	case version == "00" && len(s) != 55:
+		return sc, false
+	case len(s) > 55 && s[55] != '-':
+		return sc, false
+	}
+	traceID, spanID, flags := s[3:35], s[36:52], s[53:55]
+	if !lowerHex(traceID) || !lowerHex(spanID) || !lowerHex(flags) {
+		return sc, false
+	}
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Sampled = f[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+func lowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !strings.ContainsRune("0123456789abcdef", rune(s[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Kind says which side of a call a span is on. Values match OTLP's.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2 // Handling an incoming request
+	KindClient   Kind = 3 // Making an outgoing request
+)
+
+// StatusCode is a span's outcome. Values match OTLP's.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attr is a span attribute. Values are strings, int64s or bools.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attr { return Attr{key, value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attr { return Attr{key, int64(value)} }
+
+// Int64 returns an integer attribute.
+func Int64(key string, value int64) Attr { return Attr{key, value} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// SpanData is a finished span, as handed to an Exporter.
+type SpanData struct {
+	Name          string
+	Kind          Kind
+	SpanContext   SpanContext
+	Parent        SpanID // Zero for the root span of a trace
+	Start, End    time.Time
+	Attrs         []Attr
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Tracer starts spans and exports them in batches in the background.
+type Tracer struct {
+	exporter Exporter
+
+	mu     sync.RWMutex // Guards queue against sends after Shutdown
+	closed bool
+	queue  chan SpanData
+	done   chan struct{}
+}
+
+// NewTracer returns a tracer exporting to exp. Call Shutdown to export the
+// spans still queued.
+func NewTracer(exp Exporter) *Tracer {
+	t := &Tracer{
+		exporter: exp,
+		queue:    make(chan SpanData, maxQueue),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithRemoteParent returns a context whose next span continues the
+// trace of sc, typically parsed from an incoming traceparent header.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFrom returns the context of the span in ctx, or the remote
+// parent stored in it. It is invalid if there is neither.
+func SpanContextFrom(ctx context.Context) SpanContext {
+	if s, ok := ctx.Value(spanKey{}).(*Span); ok {
+		return s.data.SpanContext
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Start starts a span as a child of the span in ctx, or of its remote
+// parent, or as the root of a new trace. The returned context carries the
+// span; End it when the work is done.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind, attrs ...Attr) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFrom(ctx)
+	s := &Span{tracer: t, data: SpanData{
+		Name:  name,
+		Kind:  kind,
+		Start: time.Now(),
+		Attrs: append([]Attr(nil), attrs...),
+	}}
+	sc := &s.data.SpanContext
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+		s.data.Parent = parent.SpanID
+	} else {
+		putRandom(sc.TraceID[:])
+		sc.Sampled = true
+	}
+	putRandom(sc.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// putRandom fills b with random bytes, never all zero.
+func putRandom(b []byte) {
+	for {
+		rand.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return
+			}
+		}
+	}
+}
+
+// Span is an operation being traced. Its methods may be called on a nil
+// Span and from several goroutines.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext returns the span's IDs; it is invalid for a nil Span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetName renames the span, e.g. once the route of a request is known.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttrs adds attributes to the span.
+func (s *Span) SetAttrs(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Attrs = append(s.data.Attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed with err's message. A nil err leaves
+// the span as it is.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Status = StatusError
+	s.data.StatusMessage = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	if data.SpanContext.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+// enqueue hands a span to the export loop, dropping it if the loop is
+// behind or shut down rather than blocking the traced code.
+func (t *Tracer) enqueue(data SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+	}
+}
+
+// run exports spans in batches until the queue is closed.
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			slog.Warn("exporting spans failed", "spans", len(batch), "error", err)
+		}
+		cancel()
+		batch = nil
+	}
+	for {
+		select {
+		case s, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Shutdown exports the queued spans and stops the tracer. Spans ended
+// afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
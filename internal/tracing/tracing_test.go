@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingTracer returns a tracer and a function that shuts it down and
+// returns the spans it exported.
+func recordingTracer(t *testing.T) (*Tracer, func() []SpanData) {
+	var mu sync.Mutex
+	var spans []SpanData
+	tr := NewTracer(ExporterFunc(func(_ context.Context, batch []SpanData) error {
+		mu.Lock()
+		spans = append(spans, batch...)
+		mu.Unlock()
+		return nil
+	}))
+	return tr, func() []SpanData {
+		if err := tr.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+// TestParseTraceparent tests W3C traceparent parsing and formatting
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(valid)
+	if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Fatalf("Unexpected result for %q: %+v, %v", valid, sc, ok)
+	}
+	if got := sc.Traceparent(); got != valid {
+		t.Errorf("Traceparent() = %q, want %q", got, valid)
+	}
+
+	for _, s := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",       // not sampled
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", // later version
+	} {
+		if _, ok := ParseTraceparent(s); !ok {
+			t.Errorf("Expected %q to parse", s)
+		}
+	}
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", // version 00 has no more fields
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01",
+	} {
+		if _, ok := ParseTraceparent(s); ok {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+// TestSpanParents tests that spans join the trace of their parent, local
+// or remote, and that unsampled traces aren't exported
+func TestSpanParents(t *testing.T) {
+	tr, exported := recordingTracer(t)
+
+	ctx, root := tr.Start(context.Background(), "root", KindServer, String("a", "b"))
+	_, child := tr.Start(ctx, "child", KindClient)
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.SetName("renamed")
+	root.End()
+	root.End()
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, fromRemote := tr.Start(ContextWithRemoteParent(context.Background(), remote), "remote", KindServer)
+	fromRemote.End()
+
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, dropped := tr.Start(ContextWithRemoteParent(context.Background(), unsampled), "unsampled", KindServer)
+	dropped.End()
+
+	spans := exported()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %+v", spans)
+	}
+	c, r, rem := spans[0], spans[1], spans[2]
+	if r.Name != "renamed" || r.Parent != (SpanID{}) || len(r.Attrs) != 1 || r.End.Before(r.Start) {
+		t.Errorf("Unexpected root span %+v", r)
+	}
+	if c.SpanContext.TraceID != r.SpanContext.TraceID || c.Parent != r.SpanContext.SpanID {
+		t.Errorf("Expected the child in the root's trace, got %+v", c)
+	}
+	if c.Status != StatusError || c.StatusMessage != "boom" || c.Kind != KindClient {
+		t.Errorf("Unexpected child status %v %q or kind %v", c.Status, c.StatusMessage, c.Kind)
+	}
+	if rem.SpanContext.TraceID != remote.TraceID || rem.Parent != remote.SpanID {
+		t.Errorf("Expected the span to continue the remote trace, got %+v", rem)
+	}
+
+	// Spans ended after shutdown are dropped, not sent on a closed queue
+	_, late := tr.Start(context.Background(), "late", KindInternal)
+	late.End()
+}
+
+// TestNilTracer tests that a nil tracer and its spans do nothing
+func TestNilTracer(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "x", KindInternal)
+	span.SetName("y")
+	span.SetAttrs(Int("n", 1))
+	span.SetError(errors.New("boom"))
+	span.End()
+	if span != nil || SpanContextFrom(ctx).IsValid() || span.SpanContext().IsValid() {
+		t.Error("Expected no span")
+	}
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+// TestStdoutExporter tests the JSON lines written for spans
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tr := NewTracer(NewStdoutExporter(&buf, "svc"))
+	ctx, parent := tr.Start(context.Background(), "parent", KindServer)
+	_, child := tr.Start(ctx, "child", KindInternal, Int("n", 3))
+	child.End()
+	parent.End()
+	tr.Shutdown(context.Background())
+
+	dec := json.NewDecoder(&buf)
+	var first map[string]any
+	if err := dec.Decode(&first); err != nil {
+		t.Fatalf("Output is not JSON: %v", err)
+	}
+	want := map[string]any{"service": "svc", "name": "child", "kind": "internal", "parent_span_id": parent.SpanContext().SpanID.String(), "trace_id": parent.SpanContext().TraceID.String()}
+	for k, v := range want {
+		if first[k] != v {
+			t.Errorf("%s = %v, want %v", k, first[k], v)
+		}
+	}
+	if attrs, _ := first["attributes"].(map[string]any); attrs["n"] != 3.0 {
+		t.Errorf("Unexpected attributes %v", first["attributes"])
+	}
+}
+
+// TestOTLPExporter tests the OTLP/HTTP JSON request sent to a collector
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	var contentType string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	tr := NewTracer(NewOTLPExporter(collector.URL+"/v1/traces", "svc"))
+	_, span := tr.Start(context.Background(), "GET /api/search", KindServer, String("url.path", "/api/search"), Int("http.response.status_code", 500), Bool("ok", false))
+	span.SetError(errors.New("500 Internal Server Error"))
+	span.End()
+	tr.Shutdown(context.Background())
+
+	if contentType != "application/json" {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]any
+			}
+			ScopeSpans []struct {
+				Spans []map[string]any
+			}
+		}
+	}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.ResourceSpans) != 1 {
+		t.Fatalf("Unexpected request %s: %v", body, err)
+	}
+	rs := req.ResourceSpans[0]
+	if !strings.Contains(string(body), `{"key":"service.name","value":{"stringValue":"svc"}}`) {
+		t.Errorf("Expected the service name resource attribute in %s", body)
+	}
+	if len(rs.ScopeSpans) != 1 || len(rs.ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("Expected one span in %s", body)
+	}
+	s := rs.ScopeSpans[0].Spans[0]
+	if s["traceId"] != span.SpanContext().TraceID.String() || s["name"] != "GET /api/search" || s["kind"] != 2.0 {
+		t.Errorf("Unexpected span %v", s)
+	}
+	if _, ok := s["parentSpanId"]; ok {
+		t.Errorf("Expected no parent for a root span, got %v", s)
+	}
+	for _, want := range []string{
+		`{"key":"http.response.status_code","value":{"intValue":"500"}}`,
+		`{"key":"ok","value":{"boolValue":false}}`,
+		`"status":{"code":2,"message":"500 Internal Server Error"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %s in %s", want, body)
+		}
+	}
+}
+
+// TestOTLPExporterError tests that a collector's error status is reported
+func TestOTLPExporterError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer collector.Close()
+
+	err := NewOTLPExporter(collector.URL, "svc").Export(context.Background(), []SpanData{{Name: "x"}})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Expected a 400 error, got %v", err)
+	}
+}
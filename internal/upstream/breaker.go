@@ -0,0 +1,93 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the host while its breaker
+// is open.
+var ErrCircuitOpen = errors.New("upstream: circuit open")
+
+// breakers tracks one circuit breaker per host. A breaker opens after
+// threshold consecutive failures (transport errors or 5xx responses) and
+// rejects requests for cooldown. After that a single probe is let through:
+// success closes the breaker, failure opens it again. A threshold below one
+// never opens it.
+type breakers struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*breaker
+}
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (bs *breakers) get(host string) *breaker {
+	if bs.hosts == nil {
+		bs.hosts = make(map[string]*breaker)
+	}
+	b, ok := bs.hosts[host]
+	if !ok {
+		b = &breaker{}
+		bs.hosts[host] = b
+	}
+	return b
+}
+
+func (bs *breakers) clock() time.Time {
+	if bs.now != nil {
+		return bs.now()
+	}
+	return time.Now()
+}
+
+// allow reports whether a request to host may go out.
+func (bs *breakers) allow(host string) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b := bs.get(host)
+	if b.openUntil.IsZero() {
+		return nil
+	}
+	if bs.clock().Before(b.openUntil) || b.probing {
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	}
+	b.probing = true
+	return nil
+}
+
+// record registers the outcome of a request allowed by allow.
+func (bs *breakers) record(host string, ok bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b := bs.get(host)
+	if ok {
+		*b = breaker{}
+		return
+	}
+	if bs.threshold < 1 {
+		return
+	}
+	b.failures++
+	if b.probing || b.failures >= bs.threshold {
+		b.openUntil = bs.clock().Add(bs.cooldown)
+		b.probing = false
+	}
+}
+
+// release gives up a probe slot without recording an outcome, e.g. when the
+// caller cancelled the request.
+func (bs *breakers) release(host string) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.get(host).probing = false
+}
@@ -0,0 +1,69 @@
+package upstream
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request that
+// caused the upstream calls made with it, for their log entries.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored by WithRequestID, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logAttempt logs one attempt at req: failures as warnings, everything else
+// at debug level. The query is left out, since CDN URLs carry signatures.
+func (t *Transport) logAttempt(req *http.Request, attempt int, resp *http.Response, err error, start time.Time) {
+	if t.cfg.Logger == nil {
+		return
+	}
+	level := slog.LevelDebug
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("host", req.URL.Host),
+		slog.String("path", req.URL.Path),
+		slog.Int("attempt", attempt+1),
+		slog.Duration("latency", time.Since(start)),
+	}
+	switch {
+	case err != nil:
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	case resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests:
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	default:
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if id := RequestID(req.Context()); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	t.cfg.Logger.LogAttrs(req.Context(), level, "upstream request", attrs...)
+}
+
+// pathTemplate replaces the path segments of p that look like IDs or CDN
+// signatures, those starting with a digit or 16 bytes or longer, with
+// {id}, so span names stay few: e.g. "/albums/{id}/with-tracks".
+func pathTemplate(p string) string {
+	if p == "" {
+		return "/"
+	}
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		if len(seg) >= 16 || seg != "" && seg[0] >= '0' && seg[0] <= '9' {
+			segs[i] = "{id}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
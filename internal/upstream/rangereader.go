@@ -0,0 +1,229 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// rangeSkip is how far ahead a Seek may land and still be served by reading
+// through the open response instead of issuing a new Range request.
+const rangeSkip = 64 << 10
+
+// ErrURLExpired is returned by RangeReader when the server rejects the URL
+// and it has no way, or no further way, to get a fresh one.
+var ErrURLExpired = errors.New("upstream: URL rejected as expired")
+
+// RefreshFunc returns a fresh URL for the same resource, e.g. a new
+// download link for a track once the CDN has expired the old one.
+type RefreshFunc func(ctx context.Context) (string, error)
+
+// RangeReader reads an HTTP resource as an io.ReadSeekCloser. Reads stream
+// from a single response; a Seek drops it and the next Read asks for the
+// rest of the resource from the new offset with a Range request. A URL the
+// server rejects with 403, 404 or 410 is replaced through the RefreshFunc
+// once per request.
+//
+// A RangeReader is not safe for concurrent use.
+type RangeReader struct {
+	client  *http.Client
+	url     string
+	refresh RefreshFunc
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	size    int64 // -1 if the server didn't tell
+	off     int64 // Offset of the next Read
+	body    io.ReadCloser
+	bodyOff int64 // Offset body is at
+}
+
+// NewRangeReader opens url from the start to learn its size. refresh may
+// be nil if the URL doesn't expire.
+func NewRangeReader(client *http.Client, url string, refresh RefreshFunc) (*RangeReader, error) {
+	return NewRangeReaderContext(context.Background(), client, url, refresh)
+}
+
+// NewRangeReaderContext is like NewRangeReader, but once ctx is done the
+// request in progress is aborted and Reads fail. Unlike Close, which must
+// not be called during a Read, cancelling ctx may happen at any time.
+func NewRangeReaderContext(ctx context.Context, client *http.Client, url string, refresh RefreshFunc) (*RangeReader, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r := &RangeReader{client: client, url: url, refresh: refresh, ctx: ctx, cancel: cancel, size: -1}
+	if err := r.open(0); err != nil {
+		cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Size returns the length of the resource, or -1 if it is unknown.
+func (r *RangeReader) Size() int64 {
+	return r.size
+}
+
+// Read implements io.Reader.
+func (r *RangeReader) Read(p []byte) (int, error) {
+	if r.size >= 0 && r.off >= r.size {
+		return 0, io.EOF
+	}
+	if r.body != nil && r.bodyOff != r.off {
+		if skip := r.off - r.bodyOff; skip > 0 && skip <= rangeSkip {
+			n, err := io.CopyN(io.Discard, r.body, skip)
+			r.bodyOff += n
+			if err != nil {
+				r.closeBody()
+			}
+		} else {
+			r.closeBody()
+		}
+	}
+	if r.body == nil {
+		if err := r.open(r.off); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.body.Read(p)
+	r.off += int64(n)
+	r.bodyOff += int64(n)
+	if err == io.EOF && r.size >= 0 && r.off < r.size {
+		// The connection ended early; the next Read resumes from here
+		r.closeBody()
+		if n == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker. It only moves the offset; the request is made
+// by the next Read.
+func (r *RangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		if r.size < 0 {
+			return 0, errors.New("upstream: seek from end of a resource of unknown size")
+		}
+		offset += r.size
+	default:
+		return 0, errors.New("upstream: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("upstream: negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// Close implements io.Closer. It aborts any request in progress.
+func (r *RangeReader) Close() error {
+	r.closeBody()
+	r.cancel()
+	return nil
+}
+
+func (r *RangeReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+// open requests the resource from off onwards.
+func (r *RangeReader) open(off int64) error {
+	for refreshed := false; ; refreshed = true {
+		req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+		if err != nil {
+			return err
+		}
+		if off > 0 {
+			req.Header.Set("Range", "bytes="+strconv.FormatInt(off, 10)+"-")
+		}
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			// No Range, or the server ignored it: the body starts at 0
+			if resp.ContentLength >= 0 {
+				r.size = resp.ContentLength
+			}
+			if off > 0 {
+				if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+					resp.Body.Close()
+					return fmt.Errorf("upstream: skipping to %d: %w", off, err)
+				}
+			}
+		case http.StatusPartialContent:
+			start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+			if !ok || start != off || (r.size >= 0 && size >= 0 && size != r.size) {
+				resp.Body.Close()
+				return fmt.Errorf("upstream: unexpected Content-Range %q for offset %d", resp.Header.Get("Content-Range"), off)
+			}
+			r.size = size
+		case http.StatusRequestedRangeNotSatisfiable:
+			// Seeked to or past the end
+			resp.Body.Close()
+			r.body, r.bodyOff = http.NoBody, off
+			return nil
+		case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+			resp.Body.Close()
+			if r.refresh == nil || refreshed {
+				return fmt.Errorf("%w: %s", ErrURLExpired, resp.Status)
+			}
+			url, err := r.refresh(r.ctx)
+			if err != nil {
+				return fmt.Errorf("upstream: refreshing URL: %w", err)
+			}
+			r.url = url
+			continue
+		default:
+			resp.Body.Close()
+			return fmt.Errorf("upstream: GET returned %s", resp.Status)
+		}
+
+		r.body, r.bodyOff = resp.Body, off
+		return nil
+	}
+}
+
+// parseContentRange parses "bytes start-end/size". size is -1 for "*".
+func parseContentRange(v string) (start, size int64, ok bool) {
+	v, ok = strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	rng, total, ok := strings.Cut(v, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	first, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size = -1
+	if total != "*" {
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, size, true
+}
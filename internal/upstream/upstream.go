@@ -0,0 +1,343 @@
+// Package upstream provides the HTTP client both binaries use to talk to the
+// Yandex Music API and its CDN. It adds connect and read timeouts, bounded
+// retries with jittered backoff for idempotent requests, and a per-host
+// circuit breaker that fails fast while a host keeps erroring.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go_yandex_music/internal/tracing"
+)
+
+// ErrReadTimeout is returned by a response body whose Read stalls for longer
+// than Config.ReadTimeout.
+var ErrReadTimeout = errors.New("upstream: read timeout")
+
+// Config tunes the transport. Zero fields take the values from DefaultConfig.
+type Config struct {
+	DialTimeout           time.Duration // TCP connect and TLS handshake
+	ResponseHeaderTimeout time.Duration // waiting for the status line
+	ReadTimeout           time.Duration // a single stalled body Read
+
+	MaxRetries    int           // extra attempts after the first one; negative disables retries
+	BaseDelay     time.Duration // backoff before the first retry
+	MaxDelay      time.Duration // backoff cap
+	MaxRetryAfter time.Duration // longer Retry-After values are not waited for
+
+	BreakerThreshold int           // consecutive failures that open a host's breaker; negative disables it
+	BreakerCooldown  time.Duration // how long an open breaker rejects requests
+
+	Logger *slog.Logger    // logs every attempt, see WithRequestID; nil logs nothing
+	Tracer *tracing.Tracer // traces every request, retries included; nil traces nothing
+}
+
+// DefaultConfig returns the settings used by the web server and the CLI.
+func DefaultConfig() Config {
+	return Config{
+		DialTimeout:           10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ReadTimeout:           30 * time.Second,
+		MaxRetries:            3,
+		BaseDelay:             250 * time.Millisecond,
+		MaxDelay:              5 * time.Second,
+		MaxRetryAfter:         30 * time.Second,
+		BreakerThreshold:      5,
+		BreakerCooldown:       30 * time.Second,
+	}
+}
+
+// withDefaults fills zero fields from DefaultConfig. Negative MaxRetries
+// and BreakerThreshold are kept: they turn retries and the breaker off.
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.DialTimeout == 0 {
+		c.DialTimeout = d.DialTimeout
+	}
+	if c.ResponseHeaderTimeout == 0 {
+		c.ResponseHeaderTimeout = d.ResponseHeaderTimeout
+	}
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = d.ReadTimeout
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = d.MaxRetries
+	}
+	if c.BaseDelay == 0 {
+		c.BaseDelay = d.BaseDelay
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = d.MaxDelay
+	}
+	if c.MaxRetryAfter == 0 {
+		c.MaxRetryAfter = d.MaxRetryAfter
+	}
+	if c.BreakerThreshold == 0 {
+		c.BreakerThreshold = d.BreakerThreshold
+	}
+	if c.BreakerCooldown == 0 {
+		c.BreakerCooldown = d.BreakerCooldown
+	}
+	return c
+}
+
+// NewClient returns an http.Client using a Transport built from cfg. It has
+// no overall timeout, since audio downloads can legitimately take minutes;
+// callers bound requests with their context instead.
+func NewClient(cfg Config) *http.Client {
+	return &http.Client{Transport: NewTransport(cfg, nil)}
+}
+
+// Transport is an http.RoundTripper with retries and a circuit breaker.
+type Transport struct {
+	cfg      Config
+	base     http.RoundTripper
+	breakers breakers
+
+	// sleep waits between attempts; tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewTransport wraps base, or a new http.Transport with cfg's connect and
+// header timeouts when base is nil.
+func NewTransport(cfg Config, base http.RoundTripper) *Transport {
+	cfg = cfg.withDefaults()
+	if base == nil {
+		dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}
+		base = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   cfg.DialTimeout,
+			ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+			ExpectContinueTimeout: time.Second,
+		}
+	}
+	return &Transport{
+		cfg:      cfg,
+		base:     base,
+		breakers: breakers{threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown},
+		sleep:    sleep,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.cfg.Tracer.Start(req.Context(), req.Method+" "+pathTemplate(req.URL.Path), tracing.KindClient,
+		tracing.String("http.request.method", req.Method),
+		tracing.String("server.address", req.URL.Host),
+		tracing.String("url.path", req.URL.Path),
+	)
+	if span == nil {
+		resp, _, err := t.roundTrip(req)
+		return resp, err
+	}
+	defer span.End()
+	resp, attempts, err := t.roundTrip(req.WithContext(ctx))
+	span.SetAttrs(tracing.Int("http.request.resend_count", attempts-1))
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttrs(tracing.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(errors.New(resp.Status))
+	}
+	return resp, nil
+}
+
+// roundTrip does the work of RoundTrip and also returns how many attempts
+// it made.
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, int, error) {
+	host := req.URL.Host
+	attempts := 1
+	if retryable(req) && t.cfg.MaxRetries > 0 {
+		attempts += t.cfg.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := t.breakers.allow(host); err != nil {
+			t.logAttempt(req, attempt, nil, err, time.Now())
+			return nil, attempt, err
+		}
+
+		start := time.Now()
+		resp, err := t.try(req, attempt)
+		t.logAttempt(req, attempt, resp, err, start)
+		if req.Context().Err() != nil {
+			// The caller gave up; that says nothing about the host.
+			t.breakers.release(host)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, attempt + 1, req.Context().Err()
+		}
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		t.breakers.record(host, !failed)
+
+		if attempt+1 >= attempts || !shouldRetry(resp, err) {
+			return resp, attempt + 1, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if after > t.cfg.MaxRetryAfter {
+					return resp, attempt + 1, nil
+				}
+				delay = after
+			}
+			drain(resp.Body)
+		}
+		if err := t.sleep(req.Context(), delay); err != nil {
+			return nil, attempt + 1, err
+		}
+	}
+}
+
+// try performs a single attempt. The response body is wrapped so a stalled
+// Read fails after ReadTimeout instead of hanging forever.
+func (t *Transport) try(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	r := req.Clone(ctx)
+	if attempt > 0 && req.Body != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = newWatchedBody(resp.Body, t.cfg.ReadTimeout, cancel)
+	return resp, nil
+}
+
+// backoff returns a full-jitter delay for the given attempt.
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := t.cfg.BaseDelay << attempt
+	if d <= 0 || d > t.cfg.MaxDelay {
+		d = t.cfg.MaxDelay
+	}
+	return rand.N(d) + 1
+}
+
+// retryable reports whether req may be sent again: the method must be
+// idempotent and the body, if any, must be replayable.
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		d := at.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// drain reads a little of a discarded body so the connection can be reused.
+func drain(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, 4096))
+	body.Close()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// watchedBody cancels the request when a single Read blocks for longer than
+// timeout. Time spent between reads doesn't count, so a paused player or a
+// slow downstream client doesn't trip it.
+type watchedBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	expired atomic.Bool
+}
+
+func newWatchedBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *watchedBody {
+	b := &watchedBody{ReadCloser: body, timeout: timeout, cancel: cancel}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.expired.Store(true)
+		cancel()
+	})
+	b.timer.Stop()
+	return b
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	if err != nil && err != io.EOF && b.expired.Load() {
+		err = fmt.Errorf("%w after %s", ErrReadTimeout, b.timeout)
+	}
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
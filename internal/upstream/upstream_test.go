@@ -0,0 +1,490 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go_yandex_music/internal/tracing"
+)
+
+// newTestTransport returns a transport whose waits are recorded instead of
+// slept.
+func newTestTransport(cfg Config) (*Transport, *[]time.Duration) {
+	t := NewTransport(cfg, nil)
+	var delays []time.Duration
+	t.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return t, &delays
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	tr, delays := newTestTransport(Config{})
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("Unexpected response %d %q", resp.StatusCode, body)
+	}
+	if hits.Load() != 3 || len(*delays) != 2 {
+		t.Errorf("Expected 3 attempts with 2 waits, got %d attempts and %v", hits.Load(), *delays)
+	}
+	for i, d := range *delays {
+		if d <= 0 || d > DefaultConfig().BaseDelay<<i {
+			t.Errorf("Backoff %d out of range: %v", i, d)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	tr, delays := newTestTransport(Config{})
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent || len(*delays) != 1 || (*delays)[0] != 2*time.Second {
+		t.Errorf("Expected one 2s wait before success, got %d after %v", resp.StatusCode, *delays)
+	}
+
+	// A Retry-After beyond the cap is returned to the caller instead
+	hits.Store(0)
+	tr, delays = newTestTransport(Config{MaxRetryAfter: time.Second})
+	resp, err = (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || len(*delays) != 0 {
+		t.Errorf("Expected the 429 without waiting, got %d after %v", resp.StatusCode, *delays)
+	}
+}
+
+func TestNoRetryForPost(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	tr, _ := newTestTransport(Config{})
+	resp, err := (&http.Client{Transport: tr}).Post(srv.URL, "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 1 {
+		t.Errorf("Expected a single attempt for POST, got %d", hits.Load())
+	}
+}
+
+func TestLogsAttemptsWithRequestID(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	tr, _ := newTestTransport(Config{Logger: slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))})
+	req, _ := http.NewRequestWithContext(WithRequestID(context.Background(), "req-1"), http.MethodGet, srv.URL+"/track?sign=secret", nil)
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one entry per attempt, got %q", logs.String())
+	}
+	for i, want := range []string{`"level":"WARN"`, `"level":"DEBUG"`} {
+		for _, part := range []string{want, `"request_id":"req-1"`, `"path":"/track"`, fmt.Sprintf(`"attempt":%d`, i+1)} {
+			if !strings.Contains(lines[i], part) {
+				t.Errorf("Entry %d lacks %s: %s", i, part, lines[i])
+			}
+		}
+	}
+	if strings.Contains(logs.String(), "secret") {
+		t.Errorf("The query must not be logged: %s", logs.String())
+	}
+}
+
+func TestTracesRequests(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	var spans []tracing.SpanData
+	tracer := tracing.NewTracer(tracing.ExporterFunc(func(_ context.Context, batch []tracing.SpanData) error {
+		spans = append(spans, batch...)
+		return nil
+	}))
+	tr, _ := newTestTransport(Config{Tracer: tracer})
+	ctx, parent := tracer.Start(context.Background(), "parent", tracing.KindInternal)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/albums/123/with-tracks?sign=secret", nil)
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+	tracer.Shutdown(context.Background())
+
+	if len(spans) != 2 {
+		t.Fatalf("Expected one span for the request and the parent, got %+v", spans)
+	}
+	s := spans[0]
+	if s.Name != "GET /albums/{id}/with-tracks" || s.Kind != tracing.KindClient || s.Parent != parent.SpanContext().SpanID {
+		t.Errorf("Unexpected span %+v", s)
+	}
+	attrs := make(map[string]any)
+	for _, a := range s.Attrs {
+		attrs[a.Key] = a.Value
+	}
+	if attrs["http.request.resend_count"] != int64(1) || attrs["http.response.status_code"] != int64(http.StatusOK) || attrs["url.path"] != "/albums/123/with-tracks" {
+		t.Errorf("Unexpected attributes %v", attrs)
+	}
+	if s.Status == tracing.StatusError {
+		t.Errorf("Expected a successful span after the retry, got %q", s.StatusMessage)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits atomic.Int32
+	healthy := atomic.Bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	tr, _ := newTestTransport(Config{MaxRetries: 1, BreakerThreshold: 3, BreakerCooldown: time.Minute})
+	now := time.Now()
+	tr.breakers.now = func() time.Time { return now }
+	client := &http.Client{Transport: tr}
+
+	// Two requests with one retry each: the third failure opens the breaker
+	// and the fourth attempt is rejected without a request
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	if hits.Load() != 3 {
+		t.Fatalf("Expected 3 requests before the breaker opened, got %d", hits.Load())
+	}
+
+	_, err := client.Get(srv.URL)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("Open breaker must not contact the host, got %d requests", hits.Load())
+	}
+
+	// After the cooldown a successful probe closes it again
+	healthy.Store(true)
+	now = now.Add(time.Minute)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp, err = client.Get(srv.URL); err != nil {
+		t.Fatalf("Expected the breaker to be closed, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRetriesAndBreakerDisabled(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	tr, delays := newTestTransport(Config{MaxRetries: -1, BreakerThreshold: -1})
+	client := &http.Client{Transport: tr}
+	for i := 0; i < 2*DefaultConfig().BreakerThreshold; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	if n := int(hits.Load()); n != 2*DefaultConfig().BreakerThreshold || len(*delays) != 0 {
+		t.Errorf("Expected one attempt per request and no waits, got %d attempts and %v", n, *delays)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	tr, _ := newTestTransport(Config{ReadTimeout: 50 * time.Millisecond})
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Waiting between reads must not count against the timeout
+	time.Sleep(100 * time.Millisecond)
+	_, err = io.ReadAll(resp.Body)
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Errorf("Expected ErrReadTimeout, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second, true},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.in, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRangeReader(t *testing.T) {
+	content := strings.Repeat("0123456789", 20000)
+	var requests, rangeRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Range") != "" {
+			rangeRequests.Add(1)
+		}
+		http.ServeContent(w, r, "track.mp3", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	r, err := NewRangeReader(srv.Client(), srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRangeReader: %v", err)
+	}
+	defer r.Close()
+	if r.Size() != int64(len(content)) {
+		t.Fatalf("Size() = %d, want %d", r.Size(), len(content))
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "01234" {
+		t.Fatalf("First read = %q, %v", buf, err)
+	}
+
+	// A short hop forward reads through the open response
+	if _, err := r.Seek(3, io.SeekCurrent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "89012" {
+		t.Fatalf("Read after short seek = %q, %v", buf, err)
+	}
+	if n := rangeRequests.Load(); n != 0 {
+		t.Errorf("Short seek made %d Range requests", n)
+	}
+
+	// Going back needs a Range request
+	if _, err := r.Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "12345" {
+		t.Fatalf("Read after seek back = %q, %v", buf, err)
+	}
+	if n := rangeRequests.Load(); n != 1 {
+		t.Errorf("Expected 1 Range request, got %d", n)
+	}
+
+	pos, err := r.Seek(-3, io.SeekEnd)
+	if err != nil || pos != int64(len(content))-3 {
+		t.Fatalf("Seek from end = %d, %v", pos, err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil || string(rest) != "789" {
+		t.Errorf("Tail = %q, %v", rest, err)
+	}
+	if n, err := r.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read at end = %d, %v; want EOF", n, err)
+	}
+}
+
+func TestRangeReaderRefreshesExpiredURL(t *testing.T) {
+	content := strings.Repeat("abcdefghij", 10000)
+	var expired atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" && expired.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "track.mp3", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	var refreshes int
+	refresh := func(ctx context.Context) (string, error) {
+		refreshes++
+		return srv.URL + "/new", nil
+	}
+	r, err := NewRangeReader(srv.Client(), srv.URL+"/old", refresh)
+	if err != nil {
+		t.Fatalf("NewRangeReader: %v", err)
+	}
+	defer r.Close()
+
+	expired.Store(true)
+	if _, err := r.Seek(90000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "abc" {
+		t.Fatalf("Read after refresh = %q, %v", buf, err)
+	}
+	if refreshes != 1 {
+		t.Errorf("Expected 1 refresh, got %d", refreshes)
+	}
+
+	// Without a way to refresh, the rejection is reported
+	r2, err := NewRangeReader(srv.Client(), srv.URL+"/old", nil)
+	if err == nil {
+		r2.Close()
+	}
+	if !errors.Is(err, ErrURLExpired) {
+		t.Errorf("Expected ErrURLExpired, got %v", err)
+	}
+}
+
+func TestRangeReaderContext(t *testing.T) {
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100000")
+		w.Write(make([]byte, 1000))
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := NewRangeReaderContext(ctx, srv.Client(), srv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRangeReaderContext: %v", err)
+	}
+	defer r.Close()
+	<-started
+
+	// Cancelling from another goroutine ends a Read waiting for data
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, r)
+		read <- err
+	}()
+	cancel()
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Error("Expected the Read to fail once cancelled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read still blocked after cancel")
+	}
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the request to be aborted")
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		in          string
+		start, size int64
+		ok          bool
+	}{
+		{"bytes 0-99/100", 0, 100, true},
+		{"bytes 50-99/*", 50, -1, true},
+		{"bytes */100", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, size, ok := parseContentRange(tt.in)
+		if start != tt.start || size != tt.size || ok != tt.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v; want %d, %d, %v", tt.in, start, size, ok, tt.start, tt.size, tt.ok)
+		}
+	}
+}
@@ -184,9 +184,15 @@ class YandexMusicApp {
             return;
         }
 
+        await this.runSearch(query, 0);
+    }
+
+    // Fetches one page of search results and shows it
+    async runSearch(query, page) {
+        this.lastQuery = query;
         this.showLoading();
         try {
-            const resp = await fetch(`api/search?q=${encodeURIComponent(query)}`);
+            const resp = await fetch(`api/search?q=${encodeURIComponent(query)}&page=${page}`);
             if (!resp.ok) throw new Error('Search failed');
             const data = await resp.json();
 
@@ -247,6 +253,38 @@ class YandexMusicApp {
             this.appendHeader(`Artists (${this.artists.length})`);
             this.artists.forEach(artist => this.appendArtistItem(artist));
         }
+
+        this.appendPageNav(data);
+    }
+
+    // Previous/next page buttons for search results
+    appendPageNav(data) {
+        const page = data.page || 0;
+        if (page === 0 && !data.hasMore) return;
+
+        const nav = document.createElement('nav');
+        nav.className = 'page-nav';
+        nav.setAttribute('aria-label', 'Search result pages');
+        nav.style.cssText = 'display:flex;gap:1rem;align-items:center;margin-top:1rem;';
+
+        if (page > 0) {
+            const prev = document.createElement('button');
+            prev.className = 'back-button';
+            prev.textContent = '← Previous page';
+            prev.onclick = () => this.runSearch(this.lastQuery, page - 1);
+            nav.appendChild(prev);
+        }
+        const label = document.createElement('span');
+        label.textContent = `Page ${page + 1}`;
+        nav.appendChild(label);
+        if (data.hasMore) {
+            const next = document.createElement('button');
+            next.className = 'back-button';
+            next.textContent = 'Next page →';
+            next.onclick = () => this.runSearch(this.lastQuery, data.nextPage);
+            nav.appendChild(next);
+        }
+        this.searchResultsContainer.appendChild(nav);
     }
 
     appendHeader(text) {
@@ -509,17 +547,20 @@ class YandexMusicApp {
         }
     }
 
-    // ── Load artist tracks ────────────────────────────────────────────────────
+    // ── Load artist page ──────────────────────────────────────────────────────
     async loadArtistTracks(artistId, artistName) {
         this.showLoading();
-        this.showStatus(`Loading tracks by: ${artistName}`);
+        this.showStatus(`Loading artist${artistName ? ': ' + artistName : '…'}`);
 
         try {
-            const resp = await fetch(`api/artist-tracks?id=${artistId}&name=${encodeURIComponent(artistName)}`);
-            if (!resp.ok) throw new Error('Failed to load artist tracks');
+            const resp = await fetch(`api/artist?id=${artistId}`);
+            if (!resp.ok) throw new Error('Failed to load artist');
             const data = await resp.json();
+            artistName = data.artist?.name || artistName || 'Artist';
 
-            this.searchResults = data.tracks || [];
+            // Popular tracks first, then the full list; one playable list
+            const popular = data.popularTracks || [];
+            this.searchResults = [...popular, ...(data.tracks?.tracks || [])];
             this.currentAlbumInfo = null;
             this.updateAlbumDownloadBtn();
 
@@ -553,22 +594,93 @@ class YandexMusicApp {
 
             this.searchResultsContainer.appendChild(artistHeaderRow);
 
+            if (popular.length > 0) {
+                this.appendHeader('Popular tracks');
+                popular.forEach((track, i) => this.appendTrackItem(track, i));
+            }
+
+            const allTracks = data.tracks?.tracks || [];
+            if (allTracks.length > 0) {
+                this.appendHeader(`All tracks (${data.tracks.total})`);
+                allTracks.forEach((track, i) => this.appendTrackItem(track, popular.length + i));
+                if (data.tracks.hasMore) {
+                    this.appendLoadMoreTracks(artistId, data.tracks.page + 1, data.tracks.pageSize);
+                }
+            }
+
+            const sections = [
+                ['Albums', data.albums],
+                ['Singles', data.singles],
+                ['Compilations', data.compilations],
+                ['Appears on', data.appearsOn],
+            ];
+            for (const [title, albums] of sections) {
+                if (albums?.length > 0) {
+                    this.appendHeader(`${title} (${albums.length})`);
+                    albums.forEach(album => this.appendAlbumItem(album));
+                }
+            }
+
+            if (data.similarArtists?.length > 0) {
+                this.appendHeader('Similar artists');
+                data.similarArtists.forEach(artist => this.appendArtistItem(artist));
+            }
+
             if (this.searchResults.length === 0) {
                 const empty = document.createElement('div');
                 empty.className = 'empty-state';
                 empty.textContent = 'No tracks found for this artist.';
-                this.searchResultsContainer.appendChild(empty);
+                artistHeaderRow.after(empty);
                 return;
             }
 
-            this.searchResults.forEach((track, i) => this.appendTrackItem(track, i));
-            this.showStatus(`Loaded ${this.searchResults.length} tracks by: ${artistName}`);
+            this.showStatus(`Loaded artist: ${artistName}`);
         } catch (err) {
             console.error(err);
-            this.showError('Failed to load artist tracks. Please try again.');
+            this.showError('Failed to load artist. Please try again.');
         }
     }
 
+    // Adds a button below the artist's track list that fetches the next page
+    // and inserts it in place of the button.
+    appendLoadMoreTracks(artistId, page, pageSize) {
+        const btn = document.createElement('button');
+        btn.className = 'back-button load-more-btn';
+        btn.textContent = 'Load more tracks';
+        btn.onclick = async () => {
+            btn.disabled = true;
+            try {
+                const resp = await fetch(`api/artist-tracks?id=${artistId}&page=${page}&pageSize=${pageSize}`);
+                if (!resp.ok) throw new Error('Failed to load tracks');
+                const data = await resp.json();
+
+                // Render the new items, then move them where the button was
+                const marker = document.createComment('more');
+                btn.replaceWith(marker);
+                const start = this.searchResults.length;
+                const tracks = data.tracks || [];
+                this.searchResults.push(...tracks);
+                const added = [];
+                tracks.forEach((track, i) => {
+                    this.appendTrackItem(track, start + i);
+                    added.push(this.searchResultsContainer.lastElementChild);
+                });
+                marker.replaceWith(...added);
+                if (data.hasMore) {
+                    const before = added[added.length - 1];
+                    this.appendLoadMoreTracks(artistId, data.page + 1, data.pageSize);
+                    before.after(this.searchResultsContainer.lastElementChild);
+                }
+                this.showStatus(`Loaded ${tracks.length} more tracks`);
+            } catch (err) {
+                console.error(err);
+                btn.disabled = false;
+                this.showError('Failed to load more tracks.');
+            }
+        };
+        this.searchResultsContainer.appendChild(btn);
+    }
+
     // ── Playback ──────────────────────────────────────────────────────────────
     async playTrack(index) {
         if (index < 0 || index >= this.searchResults.length) return;
@@ -587,11 +699,8 @@ class YandexMusicApp {
         this.showStatus(`Loading: ${this.currentTrack.title}…`);
 
         try {
-            const resp = await fetch(`api/download-url?id=${this.currentTrack.id}`);
-            if (!resp.ok) throw new Error('Failed to get track URL');
-            const data = await resp.json();
-
-            this.audioPlayer.src = data.url;
+            // Stream through the server so the URL never expires mid-playback
+            this.audioPlayer.src = `api/stream?id=${this.currentTrack.id}`;
             this.audioPlayer.load();
             await this.audioPlayer.play();
 
@@ -682,28 +791,17 @@ class YandexMusicApp {
     }
 
     // ── Single track download ─────────────────────────────────────────────────
-    async downloadTrack() {
+    downloadTrack() {
         if (!this.currentTrack) { this.showError('No track selected'); return; }
-        try {
-            const resp = await fetch(`api/download-url?id=${this.currentTrack.id}`);
-            if (!resp.ok) throw new Error('Failed to get download URL');
-            const { url } = await resp.json();
-
-            this.showStatus(`Downloading: ${this.currentTrack.title}…`);
-            const blob = await (await fetch(url)).blob();
-            const blobUrl = URL.createObjectURL(blob);
-            const a = document.createElement('a');
-            a.href = blobUrl;
-            a.download = `${this.currentTrack.title} - ${this.currentTrack.artist}.mp3`;
-            document.body.appendChild(a);
-            a.click();
-            document.body.removeChild(a);
-            setTimeout(() => URL.revokeObjectURL(blobUrl), 100);
-            this.showStatus(`Downloaded: ${this.currentTrack.title}`);
-        } catch (err) {
-            console.error(err);
-            this.showError('Download failed. Please try again.');
-        }
+        // The server tags the file (title, artists, album, cover) while streaming it
+        const url = `api/download?id=${this.currentTrack.id}`;
+        this.showStatus(`Downloading: ${this.currentTrack.title}…`);
+        const a = document.createElement('a');
+        a.href = url;
+        a.download = `${this.currentTrack.title} - ${this.currentTrack.artist}.mp3`;
+        document.body.appendChild(a);
+        a.click();
+        document.body.removeChild(a);
     }
 
     // ── Album ZIP download ────────────────────────────────────────────────────
@@ -0,0 +1,11 @@
+// Package static holds the web app's files so they can be compiled into the
+// web server.
+package static
+
+import "embed"
+
+// FS holds the web app: index.html and sw.js, which the server renders as
+// templates, and the assets they refer to.
+//
+//go:embed index.html sw.js manifest.json *.png css js
+var FS embed.FS
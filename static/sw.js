@@ -1,5 +1,9 @@
 // Service Worker for Yandex Music PWA
-const CACHE_NAME = 'yandex-music-pwa-v6';
+// The server renders this file: VERSION is the build version and ASSETS the
+// content-hashed URLs of the app's files
+const VERSION = {{.Version}};
+const ASSETS = {{.Assets}};
+const CACHE_NAME = 'yandex-music-pwa-' + VERSION;
 
 // Get base path from the service worker's location
 // The service worker is registered from the page which has the base path
@@ -14,9 +18,8 @@ const BASE_PATH = getBasePath();
 const urlsToCache = [
   BASE_PATH + '/',
   BASE_PATH + '/index.html',
-  BASE_PATH + '/css/styles.css',
-  BASE_PATH + '/js/app.js',
-  BASE_PATH + '/manifest.json'
+  BASE_PATH + '/manifest.json',
+  ...ASSETS.map(asset => BASE_PATH + '/' + asset)
 ].map(url => url.replace('//', '/')); // Clean up double slashes
 
 // Install event - cache static assets
@@ -71,6 +74,11 @@ self.addEventListener('fetch', (event) => {
     return;
   }
   
+  // Audio streams use Range requests - let the browser talk to the server directly
+  if (url.includes('/api/stream')) {
+    return;
+  }
+
   // Skip API calls and audio streams - always fetch from network without caching
   if (url.includes('/api/') || 
       url.includes('.mp3') ||